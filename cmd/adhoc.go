@@ -1,7 +1,11 @@
 package cmd
 
 import (
+	"io/ioutil"
 	"log"
+	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/spf13/cobra"
@@ -9,16 +13,49 @@ import (
 )
 
 var (
-	duration     time.Duration
-	qps          int
-	max          int
-	domain       string
-	server       string
-	port         string
-	random       int
-	querytype    string
-	enableEDNS   bool
-	enableDNSSEC bool
+	duration        time.Duration
+	qps             int
+	max             int
+	domain          string
+	server          string
+	family          string
+	targets         string
+	resolveInterval time.Duration
+	targetPolicy    string
+	port            string
+	random          int
+	querytype       string
+	enableEDNS      bool
+	enableDNSSEC    bool
+	ecsSubnet       string
+	ecsMode         string
+	ecsPrefix       int
+	ednsUDPSize     int
+	ednsVersion     int
+	ednsNSID        bool
+	ednsCookie      string
+	ednsPadding     int
+	ednsKeepalive   bool
+	tsigKeyName     string
+	tsigAlgorithm   string
+	tsigSecret      string
+	tsigKeyFile     string
+	clients         int
+	sourceIPs       string
+	sourcePolicy    string
+	protocol        string
+	ephemeral       int
+	fdBudget        int
+	validate        bool
+	expectFile      string
+	tcpFallback     bool
+	reportFile      string
+	assertions      []string
+	junitFile       string
+	abortTimeout    float64
+	abortServfail   float64
+	abortError      float64
+	abortSeconds    int
 )
 
 func init() {
@@ -26,12 +63,45 @@ func init() {
 	adhocCmd.Flags().IntVarP(&qps, "qps", "Q", 100, "qps for dns traffic")
 	adhocCmd.Flags().IntVarP(&max, "max", "m", 0, "the maximum number of queries outstanding (set 0 means no limit)")
 	adhocCmd.Flags().StringVarP(&domain, "domain", "d", "", "domain name")
-	adhocCmd.Flags().StringVarP(&server, "server", "s", "", "dns server ip")
+	adhocCmd.Flags().StringVarP(&server, "server", "s", "", "dns server ip, hostname, ns://zone or srv://name")
+	adhocCmd.Flags().StringVar(&family, "family", core.AddressFamilyAny, "address family of server [any, ipv4, ipv6, alternate]")
+	adhocCmd.Flags().StringVar(&targets, "targets", "", "target list in host[:port][=weight] format separated by comma, override the server")
+	adhocCmd.Flags().DurationVar(&resolveInterval, "resolve-interval", 0, "re-resolve the targets every interval (set 0 means resolve once)")
+	adhocCmd.Flags().StringVar(&targetPolicy, "target-policy", core.TargetPolicyRoundRobin, "how the target of each query is selected [rr, weighted, qname]")
+	adhocCmd.Flags().StringVarP(&protocol, "protocol", "P", "udp", "protocol used to send the queries [udp, tcp]")
+	adhocCmd.Flags().IntVarP(&clients, "clients", "c", 1, "number of connections to dns server")
+	adhocCmd.Flags().StringVar(&sourceIPs, "source", "", "source ip or interface list, e.g. 192.0.2.1,192.0.2.2 or eth0")
+	adhocCmd.Flags().IntVar(&ephemeral, "ephemeral", 0, "open a new udp socket with random source port every N queries (set 0 means disable)")
+	adhocCmd.Flags().IntVar(&fdBudget, "fd-budget", core.DefaultFDBudget, "the maximum number of open ephemeral sockets")
+	adhocCmd.Flags().StringVar(&sourcePolicy, "source-policy", core.SourcePolicyConnection, "source ip policy [connection, query]")
 	adhocCmd.Flags().StringVarP(&port, "port", "p", "53", "the server to query")
 	adhocCmd.Flags().IntVarP(&random, "random", "r", 5, "prefix random subdomain length")
 	adhocCmd.Flags().StringVarP(&querytype, "querytype", "q", "", "random dns query type empty is random type")
 	adhocCmd.Flags().BoolVarP(&enableEDNS, "edns", "e", false, "enable edns0")
 	adhocCmd.Flags().BoolVarP(&enableDNSSEC, "dnssec", "o", false, "set dnssec ok bit")
+	adhocCmd.Flags().StringVar(&ecsSubnet, "ecs-subnet", "", "edns client subnet list, e.g. 192.0.2.0/24,2001:db8::/32")
+	adhocCmd.Flags().StringVar(&ecsMode, "ecs-mode", "fixed", "edns client subnet mode [fixed, random]")
+	adhocCmd.Flags().IntVar(&ecsPrefix, "ecs-prefix", 0, "source prefix length of random client subnet (0 is 24 for ipv4 and 56 for ipv6)")
+	adhocCmd.Flags().IntVar(&ednsUDPSize, "edns-udp-size", 0, "edns udp payload size (0 is 4096)")
+	adhocCmd.Flags().IntVar(&ednsVersion, "edns-version", 0, "edns version")
+	adhocCmd.Flags().BoolVar(&ednsNSID, "edns-nsid", false, "request the name server identifier")
+	adhocCmd.Flags().StringVar(&ednsCookie, "edns-cookie", "none", "dns cookie mode [none, client, echo]")
+	adhocCmd.Flags().IntVar(&ednsPadding, "edns-padding", 0, "pad queries to a multiple of block size (0 is no padding, 128 is recommended, not with tsig)")
+	adhocCmd.Flags().BoolVar(&ednsKeepalive, "edns-keepalive", false, "send edns-tcp-keepalive option")
+	adhocCmd.Flags().StringVar(&tsigKeyName, "tsig-key", "", "tsig key name")
+	adhocCmd.Flags().StringVar(&tsigAlgorithm, "tsig-algorithm", "hmac-sha256", "tsig algorithm [hmac-md5, hmac-sha1, hmac-sha256]")
+	adhocCmd.Flags().StringVar(&tsigSecret, "tsig-secret", "", "base64 encoded tsig secret")
+	adhocCmd.Flags().StringVar(&tsigKeyFile, "tsig-keyfile", "", "tsig key file in bind format")
+	adhocCmd.Flags().BoolVar(&validate, "validate", false, "validate the responses match the queries")
+	adhocCmd.Flags().StringVar(&expectFile, "expect", "", "expectations file of the responses, enable validation")
+	adhocCmd.Flags().BoolVar(&tcpFallback, "tcp-fallback", false, "retry the truncated udp responses over tcp")
+	adhocCmd.Flags().StringVar(&reportFile, "report", "", "write the report of job in json format to file")
+	adhocCmd.Flags().StringArrayVar(&assertions, "assert", nil, "assertion of the result like \"p99 <= 20ms\", exit with status 1 when fail (can be repeated)")
+	adhocCmd.Flags().StringVar(&junitFile, "junit", "", "write the assertion results in JUnit XML format to file")
+	adhocCmd.Flags().Float64Var(&abortTimeout, "abort-timeout", 0, "abort the job when the timeout ratio in percent exceed the value (set 0 means disable)")
+	adhocCmd.Flags().Float64Var(&abortServfail, "abort-servfail", 0, "abort the job when the servfail ratio in percent exceed the value (set 0 means disable)")
+	adhocCmd.Flags().Float64Var(&abortError, "abort-error", 0, "abort the job when the send error ratio in percent exceed the value (set 0 means disable)")
+	adhocCmd.Flags().IntVar(&abortSeconds, "abort-seconds", core.DefaultAbortSeconds, "consecutive seconds the ratio must exceed before the job is aborted")
 }
 
 var adhocCmd = &cobra.Command{
@@ -46,7 +116,19 @@ var adhocCmd = &cobra.Command{
 		app.JobConfig.MaxQuery = uint64(max)
 		app.JobConfig.Duration = duration.String()
 		app.JobConfig.Server = server
+		app.JobConfig.AddressFamily = family
+		app.JobConfig.TargetList = targets
+		if resolveInterval > 0 {
+			app.JobConfig.ResolveInterval = resolveInterval.String()
+		}
+		app.JobConfig.TargetPolicy = targetPolicy
 		app.JobConfig.Port = port
+		app.JobConfig.Protocol = protocol
+		app.JobConfig.ClientNumber = clients
+		app.JobConfig.SourceIPs = sourceIPs
+		app.JobConfig.SourcePolicy = sourcePolicy
+		app.JobConfig.EphemeralQueries = ephemeral
+		app.JobConfig.FDBudget = fdBudget
 		if enableEDNS == true {
 			app.JobConfig.EnableEDNS = "true"
 		} else {
@@ -58,9 +140,41 @@ var adhocCmd = &cobra.Command{
 			app.JobConfig.EnableDNSSEC = "false"
 		}
 		app.JobConfig.QueryType = querytype
+		app.JobConfig.ECSSubnet = ecsSubnet
+		app.JobConfig.ECSMode = ecsMode
+		app.JobConfig.ECSPrefixLength = ecsPrefix
+		app.JobConfig.EDNSUDPSize = ednsUDPSize
+		app.JobConfig.EDNSVersion = ednsVersion
+		app.JobConfig.EDNSNSID = strconv.FormatBool(ednsNSID)
+		app.JobConfig.EDNSCookie = ednsCookie
+		app.JobConfig.EDNSPadding = ednsPadding
+		app.JobConfig.EDNSKeepalive = strconv.FormatBool(ednsKeepalive)
+		app.JobConfig.TSIGKeyName = tsigKeyName
+		app.JobConfig.TSIGAlgorithm = tsigAlgorithm
+		app.JobConfig.TSIGSecret = tsigSecret
+		app.JobConfig.TSIGKeyFile = tsigKeyFile
+		app.JobConfig.EnableValidation = strconv.FormatBool(validate)
+		app.JobConfig.TCPFallback = strconv.FormatBool(tcpFallback)
+		app.JobConfig.Assertions = strings.Join(assertions, "\n")
+		if expectFile != "" {
+			content, err := ioutil.ReadFile(expectFile)
+			if err != nil {
+				log.Panicf("read expectations file error:%s", err)
+			}
+			app.JobConfig.Expectations = string(content)
+		}
+		app.JobConfig.AbortTimeoutRatio = abortTimeout
+		app.JobConfig.AbortServfailRatio = abortServfail
+		app.JobConfig.AbortErrorRatio = abortError
+		app.JobConfig.AbortSeconds = abortSeconds
 		if err := app.JobConfig.ValidateJob(); err != nil {
 			log.Panicf("argument validation error:%s", err)
 		}
-		core.GenTrafficFromConfig(app)
+		if err := core.GenTrafficFromConfig(app); err != nil {
+			log.Printf("generate traffic error:%s", err)
+			os.Exit(1)
+		}
+		writeReport(app, reportFile)
+		checkAssertions(app, junitFile)
 	},
 }
@@ -1,25 +1,38 @@
 package cmd
 
 import (
+	"net"
+
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+	"github.com/zhangmingkai4315/dns-loader/core"
 	"github.com/zhangmingkai4315/dns-loader/web"
 )
 
 var agentHost string
 var agentPort string
+var agentAllowedTargets string
+var agentMaxQPS uint32
 var agentCmd = &cobra.Command{
 	Use:   "agent",
 	Short: "Run dnsloader in agent mode",
 	Long:  `Run dnsloader in agent mode, receive job from master and gen dns packets`,
 	Run: func(cmd *cobra.Command, args []string) {
-		log.Printf("start agent server at %s:%s", agentHost, agentPort)
+		policy, err := core.NewSafetyPolicy(agentAllowedTargets, agentMaxQPS)
+		if err != nil {
+			log.Fatalf("safety policy error: %s", err)
+		}
+		core.GetGlobalAppController().Safety = policy
+		log.Printf("safety policy: %s", policy)
+		log.Printf("start agent server at %s", net.JoinHostPort(agentHost, agentPort))
 		web.NewAgentServer(agentHost, agentPort)
 		return
 	},
 }
 
 func init() {
-	agentCmd.Flags().StringVar(&agentHost, "host", "0.0.0.0", "ipaddress for start agent")
+	agentCmd.Flags().StringVar(&agentHost, "host", "0.0.0.0", "ipaddress for start agent (use :: for ipv6)")
 	agentCmd.Flags().StringVar(&agentPort, "port", "8998", "port to listen")
+	agentCmd.Flags().StringVar(&agentAllowedTargets, "allowed-targets", "", "networks the jobs can send to separated by comma, e.g. 192.0.2.0/24,2001:db8::/32 (default allow any)")
+	agentCmd.Flags().Uint32Var(&agentMaxQPS, "max-qps", 0, "the maximum qps of each target (set 0 means no limit)")
 }
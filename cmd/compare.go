@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/zhangmingkai4315/dns-loader/core"
+)
+
+var compareThresholds = core.DefaultCompareThresholds
+
+func init() {
+	compareCmd.Flags().Float64Var(&compareThresholds.QPSDrop, "max-qps-drop", core.DefaultCompareThresholds.QPSDrop, "the maximum drop of achieved qps in percent")
+	compareCmd.Flags().Float64Var(&compareThresholds.RcodeChange, "max-rcode-change", core.DefaultCompareThresholds.RcodeChange, "the maximum drop of success ratio or rise of other rcode ratios in percentage points")
+	compareCmd.Flags().Float64Var(&compareThresholds.TimeoutIncrease, "max-timeout-increase", core.DefaultCompareThresholds.TimeoutIncrease, "the maximum rise of timeout ratio in percentage points")
+	compareCmd.Flags().Float64Var(&compareThresholds.LatencyIncrease, "max-latency-increase", core.DefaultCompareThresholds.LatencyIncrease, "the maximum rise of latency in percent")
+}
+
+var compareCmd = &cobra.Command{
+	Use:   "compare [base report] [report]",
+	Short: "Compare the reports of two runs",
+	Long:  `Compare the report of a run with the base run, show the config changes and the metrics and exit with status 1 when any metric regress beyond the thresholds`,
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		base, err := core.LoadReportFromFile(args[0])
+		if err != nil {
+			log.Panicf("load report error:%s", err)
+		}
+		report, err := core.LoadReportFromFile(args[1])
+		if err != nil {
+			log.Panicf("load report error:%s", err)
+		}
+		comparison := core.CompareReports(base, report, compareThresholds)
+		for _, diff := range comparison.ConfigDiff {
+			fmt.Printf("config %s: %s -> %s\n", diff.Field, diff.A, diff.B)
+		}
+		fmt.Printf("  %-16s %14s %14s %10s\n", "metric", args[0], args[1], "delta")
+		for _, row := range comparison.Rows {
+			mark := " "
+			if row.Regression {
+				mark = "!"
+			}
+			fmt.Printf("%s %-16s %14s %14s %10s\n", mark, row.Metric, row.A, row.B, row.Delta)
+		}
+		if comparison.Regressions > 0 {
+			fmt.Printf("%d regressions found\n", comparison.Regressions)
+			os.Exit(1)
+		}
+	},
+}
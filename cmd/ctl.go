@@ -0,0 +1,187 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// ctlConfig is the master and the token saved by ctl login
+type ctlConfig struct {
+	Server string `yaml:"server"`
+	Token  string `yaml:"token"`
+}
+
+var ctlConfigFile string
+var ctlServer string
+var ctlToken string
+var ctlUsername string
+var ctlPassword string
+var ctlTokenName string
+
+var ctlCmd = &cobra.Command{
+	Use:   "ctl",
+	Short: "Control a remote master by its api",
+	Long:  `Control a remote master by its api, run ctl login once to save the master and the token, or set them by --server and --token (or DNSLOADER_SERVER and DNSLOADER_TOKEN)`,
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Help()
+	},
+}
+
+var ctlLoginCmd = &cobra.Command{
+	Use:   "login",
+	Short: "Create a token on master and save it",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		config := loadCtlConfig()
+		if config.Server == "" {
+			log.Fatalf("the master is not set, e.g. --server http://127.0.0.1:9889")
+		}
+		if ctlUsername == "" {
+			ctlUsername = prompt("Username: ")
+		}
+		if ctlPassword == "" {
+			ctlPassword = prompt("Password: ")
+		}
+		if ctlTokenName == "" {
+			ctlTokenName, _ = os.Hostname()
+		}
+		client := &ctlClient{server: config.Server}
+		var response struct {
+			Token string `json:"token"`
+		}
+		err := client.do("POST", "/tokens", map[string]string{
+			"username": ctlUsername,
+			"password": ctlPassword,
+			"name":     ctlTokenName,
+		}, &response)
+		if err != nil {
+			log.Fatalf("login error: %s", err)
+		}
+		config.Token = response.Token
+		content, err := yaml.Marshal(config)
+		if err == nil {
+			err = os.MkdirAll(filepath.Dir(ctlConfigFile), 0700)
+		}
+		if err == nil {
+			err = ioutil.WriteFile(ctlConfigFile, content, 0600)
+		}
+		if err != nil {
+			log.Fatalf("save token error: %s", err)
+		}
+		fmt.Printf("login %s success, the token is saved in %s\n", config.Server, ctlConfigFile)
+	},
+}
+
+func init() {
+	home, _ := os.UserHomeDir()
+	ctlCmd.PersistentFlags().StringVar(&ctlConfigFile, "ctl-config", filepath.Join(home, ".dnsloader", "ctl.yaml"), "file to save the master and the token")
+	ctlCmd.PersistentFlags().StringVar(&ctlServer, "server", "", "url of master, e.g. http://127.0.0.1:9889")
+	ctlCmd.PersistentFlags().StringVar(&ctlToken, "token", "", "api token of master")
+	ctlLoginCmd.Flags().StringVar(&ctlUsername, "username", "", "username of master (default prompt)")
+	ctlLoginCmd.Flags().StringVar(&ctlPassword, "password", "", "password of master (default prompt)")
+	ctlLoginCmd.Flags().StringVar(&ctlTokenName, "name", "", "name of the token (default hostname)")
+	ctlCmd.AddCommand(ctlLoginCmd)
+	ctlCmd.AddCommand(ctlJobsCmd)
+	ctlCmd.AddCommand(ctlAgentsCmd)
+	ctlCmd.AddCommand(ctlTemplatesCmd)
+}
+
+// prompt read a line from stdin
+func prompt(message string) string {
+	fmt.Print(message)
+	line, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	return strings.TrimSpace(line)
+}
+
+// loadCtlConfig return the saved config overridden by the environment
+// and the flags
+func loadCtlConfig() *ctlConfig {
+	config := &ctlConfig{}
+	if content, err := ioutil.ReadFile(ctlConfigFile); err == nil {
+		if err := yaml.Unmarshal(content, config); err != nil {
+			log.Fatalf("load %s error: %s", ctlConfigFile, err)
+		}
+	}
+	for _, value := range []struct {
+		field *string
+		env   string
+		flag  string
+	}{
+		{&config.Server, os.Getenv("DNSLOADER_SERVER"), ctlServer},
+		{&config.Token, os.Getenv("DNSLOADER_TOKEN"), ctlToken},
+	} {
+		if value.env != "" {
+			*value.field = value.env
+		}
+		if value.flag != "" {
+			*value.field = value.flag
+		}
+	}
+	config.Server = strings.TrimSuffix(config.Server, "/")
+	return config
+}
+
+// ctlClient send the requests to the api of master
+type ctlClient struct {
+	server string
+	token  string
+}
+
+// newCtlClient return the client of the saved master and token
+func newCtlClient() *ctlClient {
+	config := loadCtlConfig()
+	if config.Server == "" || config.Token == "" {
+		log.Fatalf("the master or the token is not set, please run dns-loader ctl login first")
+	}
+	return &ctlClient{server: config.Server, token: config.Token}
+}
+
+// do send the request with body in json format to the api and decode the
+// response into out
+func (client *ctlClient) do(method, path string, body interface{}, out interface{}) error {
+	var data []byte
+	if body != nil {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequest(method, client.server+"/api/v1"+path, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if client.token != "" {
+		req.Header.Set("Authorization", "Bearer "+client.token)
+	}
+	response, err := (&http.Client{Timeout: 15 * time.Second}).Do(req)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode >= 300 {
+		apiError := struct {
+			Error string `json:"error"`
+		}{}
+		if json.NewDecoder(response.Body).Decode(&apiError) != nil || apiError.Error == "" {
+			apiError.Error = response.Status
+		}
+		return fmt.Errorf("%s (%d)", apiError.Error, response.StatusCode)
+	}
+	if out == nil || response.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	return json.NewDecoder(response.Body).Decode(out)
+}
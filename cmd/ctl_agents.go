@@ -0,0 +1,113 @@
+package cmd
+
+import (
+	"fmt"
+	"net/url"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/zhangmingkai4315/dns-loader/core"
+)
+
+// defaultAgentPort is the port of agent when it is not set
+const defaultAgentPort = "8998"
+
+var ctlAgentsCmd = &cobra.Command{
+	Use:   "agents",
+	Short: "List, add, enable, disable and remove the agents of master",
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Help()
+	},
+}
+
+var ctlAgentsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the agents with their status",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		var response struct {
+			Data []core.NodeInfo `json:"data"`
+		}
+		if err := newCtlClient().do("GET", "/agents", nil, &response); err != nil {
+			log.Fatalf("list agents error: %s", err)
+		}
+		fmt.Printf("%-40s %-7s %-5s %-9s %s\n", "AGENT", "ENABLE", "LIVE", "STATUS", "JOB ID")
+		for _, agent := range response.Data {
+			fmt.Printf("%-40s %-7v %-5v %-9s %s\n", agent.IPAddrWithPort(), agent.Enable, agent.Live, agent.Status, agent.JobID)
+		}
+	},
+}
+
+var ctlAgentsAddCmd = &cobra.Command{
+	Use:   "add <ip> [port]",
+	Short: "Add an agent",
+	Args:  cobra.RangeArgs(1, 2),
+	Run: func(cmd *cobra.Command, args []string) {
+		ip, port := agentArgs(args)
+		err := newCtlClient().do("POST", "/agents", map[string]string{"ipaddress": ip, "port": port}, nil)
+		if err != nil {
+			log.Fatalf("add agent error: %s", err)
+		}
+		fmt.Printf("agent %s:%s added\n", ip, port)
+	},
+}
+
+var ctlAgentsEnableCmd = &cobra.Command{
+	Use:   "enable <ip> [port]",
+	Short: "Enable an agent to run the jobs",
+	Args:  cobra.RangeArgs(1, 2),
+	Run: func(cmd *cobra.Command, args []string) {
+		updateAgent(args, true)
+	},
+}
+
+var ctlAgentsDisableCmd = &cobra.Command{
+	Use:   "disable <ip> [port]",
+	Short: "Disable an agent, it will not run the jobs",
+	Args:  cobra.RangeArgs(1, 2),
+	Run: func(cmd *cobra.Command, args []string) {
+		updateAgent(args, false)
+	},
+}
+
+var ctlAgentsRemoveCmd = &cobra.Command{
+	Use:     "rm <ip> [port]",
+	Aliases: []string{"remove"},
+	Short:   "Remove an agent",
+	Args:    cobra.RangeArgs(1, 2),
+	Run: func(cmd *cobra.Command, args []string) {
+		ip, port := agentArgs(args)
+		if err := newCtlClient().do("DELETE", agentPath(ip, port), nil, nil); err != nil {
+			log.Fatalf("remove agent error: %s", err)
+		}
+		fmt.Printf("agent %s:%s removed\n", ip, port)
+	},
+}
+
+func init() {
+	ctlAgentsCmd.AddCommand(ctlAgentsListCmd)
+	ctlAgentsCmd.AddCommand(ctlAgentsAddCmd)
+	ctlAgentsCmd.AddCommand(ctlAgentsEnableCmd)
+	ctlAgentsCmd.AddCommand(ctlAgentsDisableCmd)
+	ctlAgentsCmd.AddCommand(ctlAgentsRemoveCmd)
+}
+
+// agentArgs return the ip and port of agent from args
+func agentArgs(args []string) (string, string) {
+	if len(args) == 2 {
+		return args[0], args[1]
+	}
+	return args[0], defaultAgentPort
+}
+
+func agentPath(ip, port string) string {
+	return "/agents/" + url.PathEscape(ip) + "/" + url.PathEscape(port)
+}
+
+func updateAgent(args []string, enable bool) {
+	ip, port := agentArgs(args)
+	if err := newCtlClient().do("PATCH", agentPath(ip, port), map[string]bool{"enable": enable}, nil); err != nil {
+		log.Fatalf("update agent error: %s", err)
+	}
+	fmt.Printf("agent %s:%s enable: %v\n", ip, port, enable)
+}
@@ -0,0 +1,254 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/zhangmingkai4315/dns-loader/core"
+	"github.com/zhangmingkai4315/dns-loader/web"
+)
+
+var ctlJobFile string
+var ctlWatch bool
+var ctlWatchInterval time.Duration
+var ctlOutput string
+var ctlLimit int
+var ctlSearch string
+
+var ctlJobsCmd = &cobra.Command{
+	Use:   "jobs",
+	Short: "Start, stop and check the jobs of master",
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Help()
+	},
+}
+
+var ctlJobsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the jobs of history",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		query := url.Values{}
+		query.Set("limit", strconv.Itoa(ctlLimit))
+		query.Set("search", ctlSearch)
+		var response struct {
+			Data []web.APIJob `json:"data"`
+		}
+		if err := newCtlClient().do("GET", "/jobs?"+query.Encode(), nil, &response); err != nil {
+			log.Fatalf("list jobs error: %s", err)
+		}
+		printJobHeader()
+		for _, job := range response.Data {
+			printJob(job)
+		}
+	},
+}
+
+var ctlJobsStartCmd = &cobra.Command{
+	Use:   "start",
+	Short: "Start a job from the job file in yaml format or a template of master",
+	Long:  `Start a job from the job file in yaml format or a template of master, the keys of job file are the same as the job config of api, e.g. server, port, duration, qps, client_number, domain and query_type`,
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if (ctlJobFile == "") == (ctlTemplate == "") {
+			log.Fatalf("either the job file by -f or the template by --template should be set")
+		}
+		client := newCtlClient()
+		var started web.APIJob
+		if ctlTemplate != "" {
+			path := templatePath(ctlTemplate) + "/jobs"
+			if ctlTemplateVersion > 0 {
+				path += "?version=" + strconv.Itoa(ctlTemplateVersion)
+			}
+			if err := client.do("POST", path, nil, &started); err != nil {
+				log.Fatalf("start job error: %s", err)
+			}
+		} else {
+			content, err := ioutil.ReadFile(ctlJobFile)
+			if err != nil {
+				log.Fatalf("read job file error: %s", err)
+			}
+			job := core.NewDefaultJobConfig()
+			if err := core.ParseJobYAML(content, job); err != nil {
+				log.Fatalf("%s: %s", ctlJobFile, err)
+			}
+			if err := client.do("POST", "/jobs", job, &started); err != nil {
+				log.Fatalf("start job error: %s", err)
+			}
+		}
+		fmt.Printf("job %d started, job id %s\n", started.ID, started.JobID)
+		if started.AgentErrors != "" {
+			fmt.Printf("agents fail to start the job: %s\n", started.AgentErrors)
+		}
+		if ctlWatch {
+			watchJob(client, strconv.Itoa(int(started.ID)))
+		}
+	},
+}
+
+var ctlJobsStopCmd = &cobra.Command{
+	Use:   "stop [id]",
+	Short: "Stop the running job",
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		client := newCtlClient()
+		id := ""
+		if len(args) == 1 {
+			id = args[0]
+		} else {
+			var status struct {
+				JobID string `json:"job_id"`
+			}
+			if err := client.do("GET", "/status", nil, &status); err != nil {
+				log.Fatalf("get status error: %s", err)
+			}
+			id = status.JobID
+		}
+		if id == "" {
+			log.Fatalf("no job is running")
+		}
+		var job web.APIJob
+		if err := client.do("POST", "/jobs/"+url.PathEscape(id)+"/stop", nil, &job); err != nil {
+			log.Fatalf("stop job error: %s", err)
+		}
+		fmt.Printf("job %d stopped\n", job.ID)
+	},
+}
+
+var ctlJobsStatusCmd = &cobra.Command{
+	Use:   "status <id>",
+	Short: "Show the status of job by the history id or the job id",
+	Long:  `Show the status of job by the history id or the job id, --watch wait the job done and exit with status 1 when the job fail the assertions or stop without results`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		client := newCtlClient()
+		if ctlWatch {
+			watchJob(client, args[0])
+			return
+		}
+		var job web.APIJob
+		if err := client.do("GET", "/jobs/"+url.PathEscape(args[0]), nil, &job); err != nil {
+			log.Fatalf("get job error: %s", err)
+		}
+		printJobHeader()
+		printJob(job)
+	},
+}
+
+var ctlJobsResultsCmd = &cobra.Command{
+	Use:   "results <id>",
+	Short: "Show the results of finished job",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		report := &core.Report{}
+		if err := newCtlClient().do("GET", "/jobs/"+url.PathEscape(args[0])+"/results", nil, report); err != nil {
+			log.Fatalf("get results error: %s", err)
+		}
+		switch ctlOutput {
+		case "json":
+			content, err := report.JSON()
+			if err != nil {
+				log.Fatalf("get results error: %s", err)
+			}
+			fmt.Println(content)
+		case "text":
+			printReport(report)
+		default:
+			log.Fatalf("unknown output format %s", ctlOutput)
+		}
+	},
+}
+
+func init() {
+	ctlJobsListCmd.Flags().IntVar(&ctlLimit, "limit", 20, "number of jobs to show")
+	ctlJobsListCmd.Flags().StringVar(&ctlSearch, "search", "", "only show the jobs match the server, domain, targets or user")
+	ctlJobsStartCmd.Flags().StringVarP(&ctlJobFile, "file", "f", "", "job file in yaml format")
+	ctlJobsStartCmd.Flags().StringVar(&ctlTemplate, "template", "", "name of the template saved in master")
+	ctlJobsStartCmd.Flags().IntVar(&ctlTemplateVersion, "version", 0, "version of the template, the last version when it is not set")
+	ctlJobsStartCmd.Flags().BoolVar(&ctlWatch, "watch", false, "wait the job done like jobs status --watch")
+	ctlJobsStartCmd.Flags().DurationVar(&ctlWatchInterval, "interval", 2*time.Second, "interval to check the job status")
+	ctlJobsStatusCmd.Flags().BoolVar(&ctlWatch, "watch", false, "show the status changes until the job done")
+	ctlJobsStatusCmd.Flags().DurationVar(&ctlWatchInterval, "interval", 2*time.Second, "interval to check the job status")
+	ctlJobsResultsCmd.Flags().StringVarP(&ctlOutput, "output", "o", "text", "output format [text, json]")
+	ctlJobsCmd.AddCommand(ctlJobsListCmd)
+	ctlJobsCmd.AddCommand(ctlJobsStartCmd)
+	ctlJobsCmd.AddCommand(ctlJobsStopCmd)
+	ctlJobsCmd.AddCommand(ctlJobsStatusCmd)
+	ctlJobsCmd.AddCommand(ctlJobsResultsCmd)
+}
+
+func printJobHeader() {
+	fmt.Printf("%-6s %-36s %-9s %-4s %-12s %s\n", "ID", "JOB ID", "STATUS", "SLO", "USER", "CREATED")
+}
+
+func printJob(job web.APIJob) {
+	fmt.Printf("%-6d %-36s %-9s %-4s %-12s %s\n", job.ID, job.JobID, job.Status, job.SLO, job.User, job.CreatedAt.Local().Format("2006-01-02 15:04:05"))
+}
+
+// watchJob print the status of job when it changes until the job done,
+// and exit with status 1 when the job fail the assertions or stop
+// without results
+func watchJob(client *ctlClient, id string) {
+	printJobHeader()
+	last := ""
+	for {
+		var job web.APIJob
+		if err := client.do("GET", "/jobs/"+url.PathEscape(id), nil, &job); err != nil {
+			log.Fatalf("get job error: %s", err)
+		}
+		if job.Status != last {
+			printJob(job)
+		}
+		// the report is saved just after the job stopped, so the job is
+		// only taken as stopped without results when it stays stopped
+		done := job.Status == "finished" || (job.Status == "stopped" && last == "stopped")
+		if done {
+			if job.Status == "stopped" || job.SLO == "fail" {
+				os.Exit(1)
+			}
+			return
+		}
+		last = job.Status
+		time.Sleep(ctlWatchInterval)
+	}
+}
+
+// printReport print the summary of report
+func printReport(report *core.Report) {
+	fmt.Printf("job          %s\n", report.Job.JobID)
+	fmt.Printf("start time   %s\n", report.StartTime.Local().Format("2006-01-02 15:04:05"))
+	fmt.Printf("running time %s\n", report.RunningTime)
+	fmt.Printf("sent         %d\n", report.Sent)
+	fmt.Printf("received     %d\n", report.Received)
+	fmt.Printf("qps          %.2f (target %d)\n", report.QPS, report.TargetQPS)
+	fmt.Printf("timeout      %.2f%%\n", report.TimeoutRatio())
+	rcodes := []string{}
+	for rcode := range report.Rcodes {
+		rcodes = append(rcodes, rcode)
+	}
+	sort.Strings(rcodes)
+	for _, rcode := range rcodes {
+		fmt.Printf("%-12s %.2f%% (%d)\n", rcode, report.RcodeRatio(rcode), report.Rcodes[rcode])
+	}
+	latency := report.Latency
+	fmt.Printf("latency      min %s mean %s p50 %s p90 %s p99 %s max %s\n", latency.Min, latency.Mean, latency.P50, latency.P90, latency.P99, latency.Max)
+	printGroupResults("source", report.Sources)
+	printGroupResults("target", report.Targets)
+	for _, result := range report.Assertions {
+		status := "fail"
+		if result.Passed {
+			status = "pass"
+		}
+		fmt.Printf("assertion    %s %s (%s)\n", status, result.Assertion, result.Value)
+	}
+	if report.AbortReason != "" {
+		fmt.Printf("aborted      %s\n", report.AbortReason)
+	}
+}
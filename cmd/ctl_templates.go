@@ -0,0 +1,183 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"strconv"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/zhangmingkai4315/dns-loader/core"
+	"github.com/zhangmingkai4315/dns-loader/web"
+)
+
+var ctlTemplate string
+var ctlTemplateVersion int
+var ctlTemplateFile string
+var ctlTemplateDescription string
+var ctlTemplateHistory string
+
+var ctlTemplatesCmd = &cobra.Command{
+	Use:   "templates",
+	Short: "Save, export and import the job templates of master",
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Help()
+	},
+}
+
+var ctlTemplatesListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the last version of templates",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		var response struct {
+			Data []core.JobTemplate `json:"data"`
+		}
+		if err := newCtlClient().do("GET", "/templates", nil, &response); err != nil {
+			log.Fatalf("list templates error: %s", err)
+		}
+		printTemplates(response.Data)
+	},
+}
+
+var ctlTemplatesVersionsCmd = &cobra.Command{
+	Use:   "versions <name>",
+	Short: "List all versions of template",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		var response struct {
+			Data []core.JobTemplate `json:"data"`
+		}
+		if err := newCtlClient().do("GET", templatePath(args[0])+"/versions", nil, &response); err != nil {
+			log.Fatalf("list versions error: %s", err)
+		}
+		printTemplates(response.Data)
+	},
+}
+
+var ctlTemplatesSaveCmd = &cobra.Command{
+	Use:   "save <name>",
+	Short: "Save the job file or the job of history as a new version of template",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if (ctlTemplateFile == "") == (ctlTemplateHistory == "") {
+			log.Fatalf("either the job file by -f or the history job by --from-history should be set")
+		}
+		form := web.JobTemplateForm{
+			Name:        args[0],
+			Description: ctlTemplateDescription,
+			HistoryID:   ctlTemplateHistory,
+		}
+		if ctlTemplateFile != "" {
+			content, err := ioutil.ReadFile(ctlTemplateFile)
+			if err != nil {
+				log.Fatalf("read job file error: %s", err)
+			}
+			form.Job = core.NewDefaultJobConfig()
+			if err := core.ParseJobYAML(content, form.Job); err != nil {
+				log.Fatalf("%s: %s", ctlTemplateFile, err)
+			}
+		}
+		saveTemplate(&form)
+	},
+}
+
+var ctlTemplatesExportCmd = &cobra.Command{
+	Use:   "export <name>",
+	Short: "Export the template in yaml format",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		path := templatePath(args[0])
+		if ctlTemplateVersion > 0 {
+			path += "?version=" + strconv.Itoa(ctlTemplateVersion)
+		}
+		template := &core.JobTemplate{}
+		if err := newCtlClient().do("GET", path, nil, template); err != nil {
+			log.Fatalf("get template error: %s", err)
+		}
+		content, err := template.YAML()
+		if err != nil {
+			log.Fatalf("export template error: %s", err)
+		}
+		if ctlTemplateFile == "" {
+			os.Stdout.Write(content)
+			return
+		}
+		if err := ioutil.WriteFile(ctlTemplateFile, content, 0644); err != nil {
+			log.Fatalf("write template file error: %s", err)
+		}
+		fmt.Printf("template %s version %d exported to %s\n", template.Name, template.Version, ctlTemplateFile)
+	},
+}
+
+var ctlTemplatesImportCmd = &cobra.Command{
+	Use:   "import",
+	Short: "Import the template exported in yaml format as a new version",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if ctlTemplateFile == "" {
+			log.Fatalf("the template file is not set by -f")
+		}
+		content, err := ioutil.ReadFile(ctlTemplateFile)
+		if err != nil {
+			log.Fatalf("read template file error: %s", err)
+		}
+		template, err := core.ParseJobTemplateYAML(content)
+		if err != nil {
+			log.Fatalf("%s: %s", ctlTemplateFile, err)
+		}
+		saveTemplate(&web.JobTemplateForm{
+			Name:        template.Name,
+			Description: template.Description,
+			Job:         &template.Config,
+		})
+	},
+}
+
+var ctlTemplatesRemoveCmd = &cobra.Command{
+	Use:   "rm <name>",
+	Short: "Remove all versions of template",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := newCtlClient().do("DELETE", templatePath(args[0]), nil, nil); err != nil {
+			log.Fatalf("remove template error: %s", err)
+		}
+		fmt.Printf("template %s removed\n", args[0])
+	},
+}
+
+func init() {
+	ctlTemplatesSaveCmd.Flags().StringVarP(&ctlTemplateFile, "file", "f", "", "job file in yaml format")
+	ctlTemplatesSaveCmd.Flags().StringVar(&ctlTemplateHistory, "from-history", "", "history id or job id of the job to save")
+	ctlTemplatesSaveCmd.Flags().StringVar(&ctlTemplateDescription, "description", "", "description of the template")
+	ctlTemplatesExportCmd.Flags().StringVarP(&ctlTemplateFile, "file", "f", "", "write the template to file instead of stdout")
+	ctlTemplatesExportCmd.Flags().IntVar(&ctlTemplateVersion, "version", 0, "version of the template, the last version when it is not set")
+	ctlTemplatesImportCmd.Flags().StringVarP(&ctlTemplateFile, "file", "f", "", "template file in yaml format")
+	ctlTemplatesCmd.AddCommand(ctlTemplatesListCmd)
+	ctlTemplatesCmd.AddCommand(ctlTemplatesVersionsCmd)
+	ctlTemplatesCmd.AddCommand(ctlTemplatesSaveCmd)
+	ctlTemplatesCmd.AddCommand(ctlTemplatesExportCmd)
+	ctlTemplatesCmd.AddCommand(ctlTemplatesImportCmd)
+	ctlTemplatesCmd.AddCommand(ctlTemplatesRemoveCmd)
+}
+
+func templatePath(name string) string {
+	return "/templates/" + url.PathEscape(name)
+}
+
+func saveTemplate(form *web.JobTemplateForm) {
+	template := &core.JobTemplate{}
+	if err := newCtlClient().do("POST", "/templates", form, template); err != nil {
+		log.Fatalf("save template error: %s", err)
+	}
+	fmt.Printf("template %s version %d saved\n", template.Name, template.Version)
+}
+
+func printTemplates(templates []core.JobTemplate) {
+	fmt.Printf("%-24s %-7s %-12s %-19s %s\n", "NAME", "VERSION", "USER", "CREATED", "DESCRIPTION")
+	for _, template := range templates {
+		fmt.Printf("%-24s %-7d %-12s %-19s %s\n", template.Name, template.Version, template.User, template.CreatedAt.Local().Format("2006-01-02 15:04:05"), template.Description)
+	}
+}
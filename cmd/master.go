@@ -19,8 +19,8 @@ var masterCmd = &cobra.Command{
 		log.Infoln("start dnsloader in master mode")
 		config := initMasterMode(masterConfigFile, dbFile)
 		log.Infof("load config file from %s success", masterConfigFile)
+		log.Infof("safety policy: %s", config.Safety)
 		log.Printf("start web for dnsloader admin :%s", config.HTTPServer)
-		log.Printf("default User:%s Password:%s", config.User, config.Password)
 		err := web.NewServer()
 		if err != nil {
 			log.Printf("start web server fail: %s", err)
@@ -53,5 +53,10 @@ func initMasterMode(cfgFile string, dbfile string) *core.AppController {
 		log.Fatalf("create database connection error: %s", err.Error())
 	}
 	log.Infof("using sqlite as app database filename is %s", dbfile)
+	// the user of config file is the first admin
+	err = core.GetDBHandler().EnsureAdminUser(app.User, app.Password)
+	if err != nil {
+		log.Fatalf("create admin user error: %s", err.Error())
+	}
 	return app
 }
@@ -0,0 +1,101 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/zhangmingkai4315/dns-loader/core"
+)
+
+var (
+	notifyDuration        time.Duration
+	notifyQPS             int
+	notifyMax             int
+	notifyServer          string
+	notifyFamily          string
+	notifyTargets         string
+	notifyResolveInterval time.Duration
+	notifyTargetPolicy    string
+	notifyPort            string
+	notifyProtocol        string
+	notifyClients         int
+	notifyFile            string
+	notifyTSIGKeyName     string
+	notifyTSIGAlgorithm   string
+	notifyTSIGSecret      string
+	notifyTSIGKeyFile     string
+	notifyAbortTimeout    float64
+	notifyAbortServfail   float64
+	notifyAbortError      float64
+	notifyAbortSeconds    int
+)
+
+func init() {
+	notifyCmd.Flags().DurationVarP(&notifyDuration, "duration", "D", time.Second*60, "send out dns traffic duration")
+	notifyCmd.Flags().IntVarP(&notifyQPS, "qps", "Q", 100, "notify messages per second")
+	notifyCmd.Flags().IntVarP(&notifyMax, "max", "m", 0, "the maximum number of notify messages (set 0 means no limit)")
+	notifyCmd.Flags().StringVarP(&notifyServer, "server", "s", "", "dns server ip, hostname, ns://zone or srv://name")
+	notifyCmd.Flags().StringVar(&notifyFamily, "family", core.AddressFamilyAny, "address family of server [any, ipv4, ipv6, alternate]")
+	notifyCmd.Flags().StringVar(&notifyTargets, "targets", "", "target list in host[:port][=weight] format separated by comma, override the server")
+	notifyCmd.Flags().DurationVar(&notifyResolveInterval, "resolve-interval", 0, "re-resolve the targets every interval (set 0 means resolve once)")
+	notifyCmd.Flags().StringVar(&notifyTargetPolicy, "target-policy", core.TargetPolicyRoundRobin, "how the target of each query is selected [rr, weighted, qname]")
+	notifyCmd.Flags().StringVarP(&notifyPort, "port", "p", "53", "the server to query")
+	notifyCmd.Flags().StringVarP(&notifyProtocol, "protocol", "P", "udp", "protocol used to send the messages [udp, tcp]")
+	notifyCmd.Flags().IntVarP(&notifyClients, "clients", "c", 1, "number of connections to dns server")
+	notifyCmd.Flags().StringVarP(&notifyFile, "file", "f", "", "file with one zone per line")
+	notifyCmd.Flags().StringVar(&notifyTSIGKeyName, "tsig-key", "", "tsig key name")
+	notifyCmd.Flags().StringVar(&notifyTSIGAlgorithm, "tsig-algorithm", "hmac-sha256", "tsig algorithm [hmac-md5, hmac-sha1, hmac-sha256]")
+	notifyCmd.Flags().StringVar(&notifyTSIGSecret, "tsig-secret", "", "base64 encoded tsig secret")
+	notifyCmd.Flags().StringVar(&notifyTSIGKeyFile, "tsig-keyfile", "", "tsig key file in bind format")
+	notifyCmd.Flags().Float64Var(&notifyAbortTimeout, "abort-timeout", 0, "abort the job when the timeout ratio in percent exceed the value (set 0 means disable)")
+	notifyCmd.Flags().Float64Var(&notifyAbortServfail, "abort-servfail", 0, "abort the job when the servfail ratio in percent exceed the value (set 0 means disable)")
+	notifyCmd.Flags().Float64Var(&notifyAbortError, "abort-error", 0, "abort the job when the send error ratio in percent exceed the value (set 0 means disable)")
+	notifyCmd.Flags().IntVar(&notifyAbortSeconds, "abort-seconds", core.DefaultAbortSeconds, "consecutive seconds the ratio must exceed before the job is aborted")
+}
+
+var notifyCmd = &cobra.Command{
+	Use:   "notify [zone...]",
+	Short: "Send NOTIFY messages for a list of zones",
+	Long:  `Send NOTIFY messages for the zones at the configured rate to test how secondary servers handle a notify storm`,
+	Run: func(cmd *cobra.Command, args []string) {
+		app := core.GetGlobalAppController()
+		zones := strings.Join(args, ",")
+		if notifyFile != "" {
+			content, err := ioutil.ReadFile(notifyFile)
+			if err != nil {
+				log.Panicf("read zone file error:%s", err)
+			}
+			zones = zones + "\n" + string(content)
+		}
+		app.JobConfig.JobType = core.JobTypeNotify
+		app.JobConfig.NotifyZones = zones
+		app.JobConfig.QPS = uint32(notifyQPS)
+		app.JobConfig.MaxQuery = uint64(notifyMax)
+		app.JobConfig.Duration = notifyDuration.String()
+		app.JobConfig.Server = notifyServer
+		app.JobConfig.AddressFamily = notifyFamily
+		app.JobConfig.TargetList = notifyTargets
+		if notifyResolveInterval > 0 {
+			app.JobConfig.ResolveInterval = notifyResolveInterval.String()
+		}
+		app.JobConfig.TargetPolicy = notifyTargetPolicy
+		app.JobConfig.Port = notifyPort
+		app.JobConfig.Protocol = notifyProtocol
+		app.JobConfig.ClientNumber = notifyClients
+		app.JobConfig.TSIGKeyName = notifyTSIGKeyName
+		app.JobConfig.TSIGAlgorithm = notifyTSIGAlgorithm
+		app.JobConfig.TSIGSecret = notifyTSIGSecret
+		app.JobConfig.TSIGKeyFile = notifyTSIGKeyFile
+		app.JobConfig.AbortTimeoutRatio = notifyAbortTimeout
+		app.JobConfig.AbortServfailRatio = notifyAbortServfail
+		app.JobConfig.AbortErrorRatio = notifyAbortError
+		app.JobConfig.AbortSeconds = notifyAbortSeconds
+		if err := app.JobConfig.ValidateJob(); err != nil {
+			log.Panicf("argument validation error:%s", err)
+		}
+		core.GenTrafficFromConfig(app)
+	},
+}
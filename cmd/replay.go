@@ -0,0 +1,114 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/zhangmingkai4315/dns-loader/core"
+)
+
+var (
+	replayDuration        time.Duration
+	replayQPS             int
+	replayServer          string
+	replayFamily          string
+	replayTargets         string
+	replayResolveInterval time.Duration
+	replayTargetPolicy    string
+	replayPort            string
+	replayProtocol        string
+	replayClients         int
+	replayTiming          string
+	replaySpeed           float64
+	replayValidate        bool
+	replayExpectFile      string
+	replayTCPFallback     bool
+	replayReportFile      string
+	replayAssertions      []string
+	replayJUnitFile       string
+	replayAbortTimeout    float64
+	replayAbortServfail   float64
+	replayAbortError      float64
+	replayAbortSeconds    int
+)
+
+func init() {
+	replayCmd.Flags().DurationVarP(&replayDuration, "duration", "D", 0, "replay duration (set 0 means replay the whole capture)")
+	replayCmd.Flags().IntVarP(&replayQPS, "qps", "Q", 100, "qps for dns traffic when timing is qps")
+	replayCmd.Flags().StringVarP(&replayServer, "server", "s", "", "dns server ip, hostname, ns://zone or srv://name")
+	replayCmd.Flags().StringVar(&replayFamily, "family", core.AddressFamilyAny, "address family of server [any, ipv4, ipv6, alternate]")
+	replayCmd.Flags().StringVar(&replayTargets, "targets", "", "target list in host[:port][=weight] format separated by comma, override the server")
+	replayCmd.Flags().DurationVar(&replayResolveInterval, "resolve-interval", 0, "re-resolve the targets every interval (set 0 means resolve once)")
+	replayCmd.Flags().StringVar(&replayTargetPolicy, "target-policy", core.TargetPolicyRoundRobin, "how the target of each query is selected [rr, weighted, qname]")
+	replayCmd.Flags().StringVarP(&replayPort, "port", "p", "53", "the server to query")
+	replayCmd.Flags().StringVarP(&replayProtocol, "protocol", "P", "udp", "protocol used to send the queries [udp, tcp]")
+	replayCmd.Flags().IntVarP(&replayClients, "clients", "c", 1, "number of connections to dns server")
+	replayCmd.Flags().StringVarP(&replayTiming, "timing", "t", core.ReplayTimingOriginal, "replay timing [original, qps]")
+	replayCmd.Flags().Float64VarP(&replaySpeed, "speed", "x", 1, "speed factor of original timing (2 means twice as fast)")
+	replayCmd.Flags().BoolVar(&replayValidate, "validate", false, "validate the responses match the queries")
+	replayCmd.Flags().StringVar(&replayExpectFile, "expect", "", "expectations file of the responses, enable validation")
+	replayCmd.Flags().BoolVar(&replayTCPFallback, "tcp-fallback", false, "retry the truncated udp responses over tcp")
+	replayCmd.Flags().StringVar(&replayReportFile, "report", "", "write the report of job in json format to file")
+	replayCmd.Flags().StringArrayVar(&replayAssertions, "assert", nil, "assertion of the result like \"p99 <= 20ms\", exit with status 1 when fail (can be repeated)")
+	replayCmd.Flags().StringVar(&replayJUnitFile, "junit", "", "write the assertion results in JUnit XML format to file")
+	replayCmd.Flags().Float64Var(&replayAbortTimeout, "abort-timeout", 0, "abort the job when the timeout ratio in percent exceed the value (set 0 means disable)")
+	replayCmd.Flags().Float64Var(&replayAbortServfail, "abort-servfail", 0, "abort the job when the servfail ratio in percent exceed the value (set 0 means disable)")
+	replayCmd.Flags().Float64Var(&replayAbortError, "abort-error", 0, "abort the job when the send error ratio in percent exceed the value (set 0 means disable)")
+	replayCmd.Flags().IntVar(&replayAbortSeconds, "abort-seconds", core.DefaultAbortSeconds, "consecutive seconds the ratio must exceed before the job is aborted")
+}
+
+var replayCmd = &cobra.Command{
+	Use:   "replay [capture file]",
+	Short: "Replay dns queries from a pcap file",
+	Long:  `Replay dns queries extracted from a pcap or pcapng capture file with the original timing or the configured qps`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		app := core.GetGlobalAppController()
+		app.JobConfig.JobType = core.JobTypeReplay
+		app.JobConfig.ReplayFile = args[0]
+		app.JobConfig.ReplayTiming = replayTiming
+		app.JobConfig.ReplaySpeed = replaySpeed
+		app.JobConfig.QPS = uint32(replayQPS)
+		app.JobConfig.Server = replayServer
+		app.JobConfig.AddressFamily = replayFamily
+		app.JobConfig.TargetList = replayTargets
+		if replayResolveInterval > 0 {
+			app.JobConfig.ResolveInterval = replayResolveInterval.String()
+		}
+		app.JobConfig.TargetPolicy = replayTargetPolicy
+		app.JobConfig.Port = replayPort
+		app.JobConfig.Protocol = replayProtocol
+		app.JobConfig.ClientNumber = replayClients
+		if replayDuration != 0 {
+			app.JobConfig.Duration = replayDuration.String()
+		}
+		app.JobConfig.EnableValidation = strconv.FormatBool(replayValidate)
+		app.JobConfig.TCPFallback = strconv.FormatBool(replayTCPFallback)
+		app.JobConfig.Assertions = strings.Join(replayAssertions, "\n")
+		if replayExpectFile != "" {
+			content, err := ioutil.ReadFile(replayExpectFile)
+			if err != nil {
+				log.Panicf("read expectations file error:%s", err)
+			}
+			app.JobConfig.Expectations = string(content)
+		}
+		app.JobConfig.AbortTimeoutRatio = replayAbortTimeout
+		app.JobConfig.AbortServfailRatio = replayAbortServfail
+		app.JobConfig.AbortErrorRatio = replayAbortError
+		app.JobConfig.AbortSeconds = replayAbortSeconds
+		if err := app.JobConfig.ValidateJob(); err != nil {
+			log.Panicf("argument validation error:%s", err)
+		}
+		if err := core.GenTrafficFromConfig(app); err != nil {
+			log.Printf("generate traffic error:%s", err)
+			os.Exit(1)
+		}
+		writeReport(app, replayReportFile)
+		checkAssertions(app, replayJUnitFile)
+	},
+}
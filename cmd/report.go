@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/zhangmingkai4315/dns-loader/core"
+)
+
+// writeReport write the report of last job to file when file is set
+func writeReport(app *core.AppController, file string) {
+	if file == "" {
+		return
+	}
+	report := app.LastReport()
+	if report == nil {
+		log.Panicf("write report error:no report generated")
+	}
+	content, err := report.JSON()
+	if err == nil {
+		err = ioutil.WriteFile(file, []byte(content), 0644)
+	}
+	if err != nil {
+		log.Panicf("write report error:%s", err)
+	}
+}
+
+// printGroupResults print a line for each source or target of report
+func printGroupResults(kind string, results []core.GroupResult) {
+	for _, result := range results {
+		rcodes := []string{}
+		for rcode, count := range result.Rcodes {
+			rcodes = append(rcodes, fmt.Sprintf("%s:%d", rcode, count))
+		}
+		sort.Strings(rcodes)
+		fmt.Printf("%-12s %s sent %d received %d %s unknown:%d p99 %s\n", kind, result.Name,
+			result.Sent, result.Received, strings.Join(rcodes, " "), result.Unknown, result.Latency.P99)
+	}
+}
+
+// checkAssertions write the assertion results of last job in JUnit XML
+// format when file is set, and exit with status 1 when any assertion
+// failed or the job fail to generate the report
+func checkAssertions(app *core.AppController, file string) {
+	if strings.TrimSpace(app.JobConfig.Assertions) == "" {
+		return
+	}
+	report := app.LastReport()
+	if report == nil {
+		log.Println("assertion error:no report generated")
+		os.Exit(1)
+	}
+	if file != "" {
+		output, err := os.Create(file)
+		if err == nil {
+			err = report.WriteJUnit(output)
+			output.Close()
+		}
+		if err != nil {
+			log.Panicf("write junit file error:%s", err)
+		}
+	}
+	if !report.Passed() {
+		os.Exit(1)
+	}
+}
@@ -20,6 +20,12 @@ func init() {
 	rootCmd.AddCommand(masterCmd)
 	rootCmd.AddCommand(agentCmd)
 	rootCmd.AddCommand(adhocCmd)
+	rootCmd.AddCommand(replayCmd)
+	rootCmd.AddCommand(notifyCmd)
+	rootCmd.AddCommand(updateCmd)
+	rootCmd.AddCommand(xfrCmd)
+	rootCmd.AddCommand(compareCmd)
+	rootCmd.AddCommand(ctlCmd)
 	rootCmd.AddCommand(versionCmd)
 }
 
@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"log"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/zhangmingkai4315/dns-loader/core"
+)
+
+var (
+	updateDuration        time.Duration
+	updateQPS             int
+	updateMax             int
+	updateServer          string
+	updateFamily          string
+	updateTargets         string
+	updateResolveInterval time.Duration
+	updateTargetPolicy    string
+	updatePort            string
+	updateProtocol        string
+	updateClients         int
+	updateAction          string
+	updateType            string
+	updateTTL             int
+	updateRandom          int
+	updateTSIGKeyName     string
+	updateTSIGAlgorithm   string
+	updateTSIGSecret      string
+	updateTSIGKeyFile     string
+	updateAbortTimeout    float64
+	updateAbortServfail   float64
+	updateAbortError      float64
+	updateAbortSeconds    int
+)
+
+func init() {
+	updateCmd.Flags().DurationVarP(&updateDuration, "duration", "D", time.Second*60, "send out dns traffic duration")
+	updateCmd.Flags().IntVarP(&updateQPS, "qps", "Q", 100, "qps for dns traffic")
+	updateCmd.Flags().IntVarP(&updateMax, "max", "m", 0, "the maximum number of update messages (set 0 means no limit)")
+	updateCmd.Flags().StringVarP(&updateServer, "server", "s", "", "dns server ip, hostname, ns://zone or srv://name")
+	updateCmd.Flags().StringVar(&updateFamily, "family", core.AddressFamilyAny, "address family of server [any, ipv4, ipv6, alternate]")
+	updateCmd.Flags().StringVar(&updateTargets, "targets", "", "target list in host[:port][=weight] format separated by comma, override the server")
+	updateCmd.Flags().DurationVar(&updateResolveInterval, "resolve-interval", 0, "re-resolve the targets every interval (set 0 means resolve once)")
+	updateCmd.Flags().StringVar(&updateTargetPolicy, "target-policy", core.TargetPolicyRoundRobin, "how the target of each query is selected [rr, weighted, qname]")
+	updateCmd.Flags().StringVarP(&updatePort, "port", "p", "53", "the server to query")
+	updateCmd.Flags().StringVarP(&updateProtocol, "protocol", "P", "udp", "protocol used to send the messages [udp, tcp]")
+	updateCmd.Flags().IntVarP(&updateClients, "clients", "c", 1, "number of connections to dns server")
+	updateCmd.Flags().StringVarP(&updateAction, "action", "a", core.UpdateActionAdd, "update action [add, delete, mixed]")
+	updateCmd.Flags().StringVarP(&updateType, "type", "t", "A", "record type [A, AAAA, TXT]")
+	updateCmd.Flags().IntVar(&updateTTL, "ttl", core.DefaultUpdateTTL, "ttl of the added records")
+	updateCmd.Flags().IntVarP(&updateRandom, "random", "r", 8, "random label length of the records")
+	updateCmd.Flags().StringVar(&updateTSIGKeyName, "tsig-key", "", "tsig key name")
+	updateCmd.Flags().StringVar(&updateTSIGAlgorithm, "tsig-algorithm", "hmac-sha256", "tsig algorithm [hmac-md5, hmac-sha1, hmac-sha256]")
+	updateCmd.Flags().StringVar(&updateTSIGSecret, "tsig-secret", "", "base64 encoded tsig secret")
+	updateCmd.Flags().StringVar(&updateTSIGKeyFile, "tsig-keyfile", "", "tsig key file in bind format")
+	updateCmd.Flags().Float64Var(&updateAbortTimeout, "abort-timeout", 0, "abort the job when the timeout ratio in percent exceed the value (set 0 means disable)")
+	updateCmd.Flags().Float64Var(&updateAbortServfail, "abort-servfail", 0, "abort the job when the servfail ratio in percent exceed the value (set 0 means disable)")
+	updateCmd.Flags().Float64Var(&updateAbortError, "abort-error", 0, "abort the job when the send error ratio in percent exceed the value (set 0 means disable)")
+	updateCmd.Flags().IntVar(&updateAbortSeconds, "abort-seconds", core.DefaultAbortSeconds, "consecutive seconds the ratio must exceed before the job is aborted")
+}
+
+var updateCmd = &cobra.Command{
+	Use:   "update [zone]",
+	Short: "Send dynamic update messages to a zone",
+	Long:  `Send dynamic update (RFC 2136) messages which add or delete random records in the zone to benchmark the update throughput of primary servers`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		app := core.GetGlobalAppController()
+		app.JobConfig.JobType = core.JobTypeUpdate
+		app.JobConfig.UpdateZone = args[0]
+		app.JobConfig.UpdateAction = updateAction
+		app.JobConfig.UpdateType = updateType
+		app.JobConfig.UpdateTTL = updateTTL
+		app.JobConfig.DomainRandomLength = updateRandom
+		app.JobConfig.QPS = uint32(updateQPS)
+		app.JobConfig.MaxQuery = uint64(updateMax)
+		app.JobConfig.Duration = updateDuration.String()
+		app.JobConfig.Server = updateServer
+		app.JobConfig.AddressFamily = updateFamily
+		app.JobConfig.TargetList = updateTargets
+		if updateResolveInterval > 0 {
+			app.JobConfig.ResolveInterval = updateResolveInterval.String()
+		}
+		app.JobConfig.TargetPolicy = updateTargetPolicy
+		app.JobConfig.Port = updatePort
+		app.JobConfig.Protocol = updateProtocol
+		app.JobConfig.ClientNumber = updateClients
+		app.JobConfig.TSIGKeyName = updateTSIGKeyName
+		app.JobConfig.TSIGAlgorithm = updateTSIGAlgorithm
+		app.JobConfig.TSIGSecret = updateTSIGSecret
+		app.JobConfig.TSIGKeyFile = updateTSIGKeyFile
+		app.JobConfig.AbortTimeoutRatio = updateAbortTimeout
+		app.JobConfig.AbortServfailRatio = updateAbortServfail
+		app.JobConfig.AbortErrorRatio = updateAbortError
+		app.JobConfig.AbortSeconds = updateAbortSeconds
+		if err := app.JobConfig.ValidateJob(); err != nil {
+			log.Panicf("argument validation error:%s", err)
+		}
+		core.GenTrafficFromConfig(app)
+	},
+}
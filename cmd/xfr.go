@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"log"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/zhangmingkai4315/dns-loader/core"
+)
+
+var (
+	xfrDuration        time.Duration
+	xfrQPS             int
+	xfrMax             int
+	xfrServer          string
+	xfrFamily          string
+	xfrTargets         string
+	xfrResolveInterval time.Duration
+	xfrPort            string
+	xfrClients         int
+	xfrType            string
+	xfrSerial          uint32
+	xfrTSIGKeyName     string
+	xfrTSIGAlgorithm   string
+	xfrTSIGSecret      string
+	xfrTSIGKeyFile     string
+)
+
+func init() {
+	xfrCmd.Flags().DurationVarP(&xfrDuration, "duration", "D", time.Second*60, "send out zone transfer duration")
+	xfrCmd.Flags().IntVarP(&xfrQPS, "qps", "Q", 0, "the maximum number of transfers started per second (set 0 means no limit)")
+	xfrCmd.Flags().IntVarP(&xfrMax, "max", "m", 0, "the maximum number of transfers (set 0 means no limit)")
+	xfrCmd.Flags().StringVarP(&xfrServer, "server", "s", "", "dns server ip, hostname, ns://zone or srv://name")
+	xfrCmd.Flags().StringVar(&xfrFamily, "family", core.AddressFamilyAny, "address family of server [any, ipv4, ipv6, alternate]")
+	xfrCmd.Flags().StringVar(&xfrTargets, "targets", "", "target list in host[:port][=weight] format separated by comma, override the server")
+	xfrCmd.Flags().DurationVar(&xfrResolveInterval, "resolve-interval", 0, "re-resolve the targets every interval (set 0 means resolve once)")
+	xfrCmd.Flags().StringVarP(&xfrPort, "port", "p", "53", "the server to query")
+	xfrCmd.Flags().IntVarP(&xfrClients, "clients", "c", 1, "number of concurrent transfers")
+	xfrCmd.Flags().StringVarP(&xfrType, "type", "t", "AXFR", "transfer type [AXFR, IXFR]")
+	xfrCmd.Flags().Uint32Var(&xfrSerial, "serial", 0, "the current serial of client used by IXFR")
+	xfrCmd.Flags().StringVar(&xfrTSIGKeyName, "tsig-key", "", "tsig key name")
+	xfrCmd.Flags().StringVar(&xfrTSIGAlgorithm, "tsig-algorithm", "hmac-sha256", "tsig algorithm [hmac-md5, hmac-sha1, hmac-sha256]")
+	xfrCmd.Flags().StringVar(&xfrTSIGSecret, "tsig-secret", "", "base64 encoded tsig secret")
+	xfrCmd.Flags().StringVar(&xfrTSIGKeyFile, "tsig-keyfile", "", "tsig key file in bind format")
+}
+
+var xfrCmd = &cobra.Command{
+	Use:   "xfr [zone]",
+	Short: "Run zone transfers against a zone",
+	Long:  `Repeatedly transfer a zone with AXFR or IXFR over tcp to measure how many concurrent transfers the primary server can serve`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		app := core.GetGlobalAppController()
+		app.JobConfig.JobType = core.JobTypeXFR
+		app.JobConfig.TransferZone = args[0]
+		app.JobConfig.TransferType = xfrType
+		app.JobConfig.TransferSerial = xfrSerial
+		app.JobConfig.Protocol = "tcp"
+		app.JobConfig.QPS = uint32(xfrQPS)
+		app.JobConfig.MaxQuery = uint64(xfrMax)
+		app.JobConfig.Duration = xfrDuration.String()
+		app.JobConfig.Server = xfrServer
+		app.JobConfig.AddressFamily = xfrFamily
+		app.JobConfig.TargetList = xfrTargets
+		if xfrResolveInterval > 0 {
+			app.JobConfig.ResolveInterval = xfrResolveInterval.String()
+		}
+		app.JobConfig.Port = xfrPort
+		app.JobConfig.ClientNumber = xfrClients
+		app.JobConfig.TSIGKeyName = xfrTSIGKeyName
+		app.JobConfig.TSIGAlgorithm = xfrTSIGAlgorithm
+		app.JobConfig.TSIGSecret = xfrTSIGSecret
+		app.JobConfig.TSIGKeyFile = xfrTSIGKeyFile
+		if err := app.JobConfig.ValidateJob(); err != nil {
+			log.Panicf("argument validation error:%s", err)
+		}
+		core.GenTrafficFromConfig(app)
+	},
+}
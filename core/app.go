@@ -5,10 +5,12 @@ import (
 	"fmt"
 	"strings"
 	"sync"
+	"time"
 
 	uuid "github.com/nu7hatch/gouuid"
 
 	"github.com/asaskevich/govalidator"
+	"github.com/zhangmingkai4315/dns-loader/dns"
 	"gopkg.in/ini.v1"
 )
 
@@ -19,6 +21,11 @@ const (
 	DefaultQPS          = 100
 	DefaultMaxQuery     = 0
 	DefaultProtocol     = "udp"
+	DefaultUploadDir    = "uploads"
+	DefaultReplaySpeed  = 1.0
+	DefaultUpdateTTL    = 300
+	DefaultFDBudget     = 1024
+	DefaultAbortSeconds = 3
 )
 
 func init() {
@@ -31,6 +38,8 @@ type AppConfig struct {
 	Password          string
 	AppSecrect        string
 	HTTPServer        string
+	UploadDir         string
+	Safety            *SafetyPolicy
 	ConfigFileName    string
 	ConfigFileHandler *ini.File
 }
@@ -38,7 +47,9 @@ type AppConfig struct {
 // NewAppConfigFromFile read a appConfig.ini file from local file system
 // and return the AppConfig object
 func NewAppConfigFromFile(filename string) (*AppConfig, error) {
-	appConfig := AppConfig{}
+	appConfig := AppConfig{
+		UploadDir: DefaultUploadDir,
+	}
 	if strings.HasSuffix(filename, ".ini") == false {
 		return nil, errors.New("AppController file must be .ini file type")
 	}
@@ -62,24 +73,81 @@ func NewAppConfigFromFile(filename string) (*AppConfig, error) {
 	if appConfigSectionApp.HasKey("http_server") {
 		appConfig.HTTPServer = appConfigSectionApp.Key("http_server").String()
 	}
+	if appConfigSectionApp.HasKey("upload_dir") {
+		appConfig.UploadDir = appConfigSectionApp.Key("upload_dir").String()
+	}
+	// the optional [Safety] section limit the targets and qps of jobs
+	if appConfigSectionSafety, err := cfg.GetSection("Safety"); err == nil {
+		maxQPS, err := appConfigSectionSafety.Key("max_qps").Uint()
+		if appConfigSectionSafety.HasKey("max_qps") && err != nil {
+			return nil, fmt.Errorf("Load app appAppController file section [Safety] error:%s", err.Error())
+		}
+		appConfig.Safety, err = NewSafetyPolicy(appConfigSectionSafety.Key("allowed_targets").String(), uint32(maxQPS))
+		if err != nil {
+			return nil, fmt.Errorf("Load app appAppController file section [Safety] error:%s", err.Error())
+		}
+	}
 	return &appConfig, nil
 }
 
 // JobConfig hold the job appAppController
 type JobConfig struct {
-	JobID              string `json:"job_id" valid:"uuid,optional"`
-	Duration           string `json:"duration" valid:"-"`
-	Protocol           string `json:"protocol" valid:"in(tcp|udp),optional"`
-	QPS                uint32 `json:"qps" valid:"-"`
-	ClientNumber       int    `json:"client_number" valid:"-"`
-	MaxQuery           uint64 `json:"max_query" valid:"-"`
-	Server             string `json:"server" valid:"ip,optional"`
-	Port               string `json:"port" valid:"port,optional"`
-	Domain             string `json:"domain" valid:"-"`
-	EnableEDNS         string `json:"edns_enable" valid:"-"`
-	EnableDNSSEC       string `json:"dnssec_enable" valid:"-"`
-	DomainRandomLength int    `json:"domain_random_length" valid:"-"`
-	QueryType          string `json:"query_type" valid:"-"`
+	JobID              string  `json:"job_id" valid:"uuid,optional"`
+	JobType            string  `json:"job_type" valid:"in(query|replay|update|xfr|notify),optional"`
+	Duration           string  `json:"duration" valid:"-"`
+	Protocol           string  `json:"protocol" valid:"in(tcp|udp),optional"`
+	QPS                uint32  `json:"qps" valid:"-"`
+	ClientNumber       int     `json:"client_number" valid:"-"`
+	MaxQuery           uint64  `json:"max_query" valid:"-"`
+	Server             string  `json:"server" valid:"-"`
+	Port               string  `json:"port" valid:"port,optional"`
+	Domain             string  `json:"domain" valid:"-"`
+	EnableEDNS         string  `json:"edns_enable" valid:"-"`
+	EnableDNSSEC       string  `json:"dnssec_enable" valid:"-"`
+	DomainRandomLength int     `json:"domain_random_length" valid:"-"`
+	QueryType          string  `json:"query_type" valid:"-"`
+	ReplayFile         string  `json:"replay_file" valid:"-"`
+	ReplayTiming       string  `json:"replay_timing" valid:"in(original|qps),optional"`
+	ReplaySpeed        float64 `json:"replay_speed" valid:"-"`
+	ReplayData         []byte  `json:"replay_data,omitempty" valid:"-" gorm:"-"`
+	ECSSubnet          string  `json:"ecs_subnet" valid:"-"`
+	ECSMode            string  `json:"ecs_mode" valid:"in(fixed|random),optional"`
+	ECSPrefixLength    int     `json:"ecs_prefix_length" valid:"-"`
+	EDNSUDPSize        int     `json:"edns_udp_size" valid:"-"`
+	EDNSVersion        int     `json:"edns_version" valid:"-"`
+	EDNSNSID           string  `json:"edns_nsid" valid:"-"`
+	EDNSCookie         string  `json:"edns_cookie" valid:"in(none|client|echo),optional"`
+	EDNSPadding        int     `json:"edns_padding" valid:"-"`
+	EDNSKeepalive      string  `json:"edns_keepalive" valid:"-"`
+	TSIGKeyName        string  `json:"tsig_key_name" valid:"-"`
+	TSIGAlgorithm      string  `json:"tsig_algorithm" valid:"-"`
+	TSIGSecret         string  `json:"tsig_secret,omitempty" valid:"-" gorm:"-"`
+	TSIGKeyFile        string  `json:"tsig_key_file" valid:"-"`
+	UpdateZone         string  `json:"update_zone" valid:"-"`
+	UpdateAction       string  `json:"update_action" valid:"in(add|delete|mixed),optional"`
+	UpdateType         string  `json:"update_type" valid:"in(A|AAAA|TXT),optional"`
+	UpdateTTL          int     `json:"update_ttl" valid:"-"`
+	TransferZone       string  `json:"transfer_zone" valid:"-"`
+	TransferType       string  `json:"transfer_type" valid:"in(AXFR|IXFR),optional"`
+	TransferSerial     uint32  `json:"transfer_serial" valid:"-"`
+	NotifyZones        string  `json:"notify_zones" valid:"-"`
+	SourceIPs          string  `json:"source_ips" valid:"-"`
+	SourcePolicy       string  `json:"source_policy" valid:"in(connection|query),optional"`
+	EphemeralQueries   int     `json:"ephemeral_queries" valid:"-"`
+	FDBudget           int     `json:"fd_budget" valid:"-"`
+	AddressFamily      string  `json:"address_family" valid:"in(any|ipv4|ipv6|alternate),optional"`
+	TargetList         string  `json:"targets" valid:"-"`
+	TargetPolicy       string  `json:"target_policy" valid:"in(rr|weighted|qname),optional"`
+	ResolveInterval    string  `json:"resolve_interval" valid:"-"`
+	ResolvedTargets    string  `json:"resolved_targets" valid:"-"`
+	EnableValidation   string  `json:"validate_enable" valid:"-"`
+	Expectations       string  `json:"expectations" valid:"-"`
+	TCPFallback        string  `json:"tcp_fallback" valid:"-"`
+	Assertions         string  `json:"assertions" valid:"-"`
+	AbortTimeoutRatio  float64 `json:"abort_timeout_ratio" valid:"-"`
+	AbortServfailRatio float64 `json:"abort_servfail_ratio" valid:"-"`
+	AbortErrorRatio    float64 `json:"abort_error_ratio" valid:"-"`
+	AbortSeconds       int     `json:"abort_seconds" valid:"-"`
 }
 
 //NewDefaultJobConfig create a init job for appConfigration
@@ -90,11 +158,15 @@ func NewDefaultJobConfig() *JobConfig {
 		DomainRandomLength: DefaultRandomLength,
 		MaxQuery:           DefaultMaxQuery,
 		Protocol:           DefaultProtocol,
+		ReplaySpeed:        DefaultReplaySpeed,
+		UpdateTTL:          DefaultUpdateTTL,
 	}
 }
 
 // ValidateJob validate the job config
 func (jobConfig *JobConfig) ValidateJob() error {
+	// the ipv6 address of server can be written in brackets
+	jobConfig.Server = strings.TrimSuffix(strings.TrimPrefix(jobConfig.Server, "["), "]")
 	_, err := govalidator.ValidateStruct(jobConfig)
 	if err != nil {
 		return err
@@ -108,6 +180,119 @@ func (jobConfig *JobConfig) ValidateJob() error {
 	if jobConfig.MaxQuery < 0 {
 		return errors.New("maximum number of queries can't set to nagetive")
 	}
+	if jobConfig.JobType == JobTypeReplay {
+		if jobConfig.ReplayFile == "" && len(jobConfig.ReplayData) == 0 {
+			return errors.New("replay job must set the capture file")
+		}
+		if jobConfig.ReplaySpeed < 0 {
+			return errors.New("replay speed can't set to nagetive")
+		}
+	}
+	if jobConfig.JobType == JobTypeUpdate {
+		if jobConfig.UpdateZone == "" {
+			return errors.New("update job must set the zone")
+		}
+		if jobConfig.UpdateTTL < 0 {
+			return errors.New("update ttl can't set to nagetive")
+		}
+	}
+	if jobConfig.JobType == JobTypeXFR && jobConfig.TransferZone == "" {
+		return errors.New("transfer job must set the zone")
+	}
+	if jobConfig.JobType == JobTypeNotify && len(ParseZoneList(jobConfig.NotifyZones)) == 0 {
+		return errors.New("notify job must set the zones")
+	}
+	if jobConfig.SourceIPs != "" {
+		if _, err := ParseSourceIPs(jobConfig.SourceIPs); err != nil {
+			return err
+		}
+		if jobConfig.SourcePolicy == SourcePolicyQuery && jobConfig.Protocol == "tcp" {
+			return errors.New("per query source policy only support udp")
+		}
+	}
+	if jobConfig.TargetList == "" && jobConfig.Server == "" {
+		return errors.New("dns server or target list must be set")
+	}
+	if _, err := jobConfig.Targets(); err != nil {
+		return err
+	}
+	if jobConfig.TCPFallback == "true" && jobConfig.Protocol == "tcp" {
+		return errors.New("tcp fallback only work with udp")
+	}
+	if jobConfig.Expectations != "" {
+		if _, err := ParseExpectations(jobConfig.Expectations); err != nil {
+			return err
+		}
+	}
+	for _, ratio := range []float64{jobConfig.AbortTimeoutRatio, jobConfig.AbortServfailRatio, jobConfig.AbortErrorRatio} {
+		if ratio < 0 || ratio > 100 {
+			return errors.New("abort ratio must between 0 and 100")
+		}
+	}
+	if jobConfig.AbortSeconds < 0 {
+		return errors.New("abort seconds can't set to nagetive")
+	}
+	if _, err := ParseAssertions(jobConfig.Assertions); err != nil {
+		return err
+	}
+	if jobConfig.ResolveInterval != "" {
+		if _, err := time.ParseDuration(jobConfig.ResolveInterval); err != nil {
+			return fmt.Errorf("invalid resolve interval: %s", err)
+		}
+	}
+	if jobConfig.EphemeralQueries < 0 || jobConfig.FDBudget < 0 {
+		return errors.New("ephemeral queries and fd budget can't set to nagetive")
+	}
+	if jobConfig.EphemeralQueries > 0 && jobConfig.Protocol == "tcp" {
+		return errors.New("ephemeral sockets only support udp")
+	}
+	if jobConfig.EphemeralQueries > 0 && jobConfig.SourcePolicy == SourcePolicyQuery {
+		return errors.New("ephemeral sockets can't be used with per query source policy")
+	}
+	if jobConfig.EphemeralQueries > 0 {
+		// each connection need at least one socket of the budget
+		budget := jobConfig.FDBudget
+		if budget == 0 {
+			budget = DefaultFDBudget
+		}
+		clientNumber := jobConfig.ClientNumber
+		if clientNumber <= 0 {
+			clientNumber = 1
+		}
+		targets, _ := jobConfig.Targets()
+		if budget < clientNumber*len(targets) {
+			return fmt.Errorf("fd budget %d is less than the %d connections", budget, clientNumber*len(targets))
+		}
+	}
+	if jobConfig.ECSSubnet != "" {
+		_, err := dns.NewSubnetGenerator(jobConfig.ECSSubnet, jobConfig.ECSMode == ECSModeRandom, jobConfig.ECSPrefixLength)
+		if err != nil {
+			return err
+		}
+	}
+	if jobConfig.EDNSUDPSize < 0 || jobConfig.EDNSUDPSize > 65535 {
+		return errors.New("edns udp payload size must between 0 and 65535")
+	}
+	if jobConfig.EDNSVersion < 0 || jobConfig.EDNSVersion > 255 {
+		return errors.New("edns version must between 0 and 255")
+	}
+	if jobConfig.EDNSPadding < 0 || jobConfig.EDNSPadding > 65535 {
+		return errors.New("edns padding block size must between 0 and 65535")
+	}
+	tsig, err := jobConfig.NewTSIG()
+	if err != nil {
+		return err
+	}
+	// the padding is computed before the TSIG record is appended, so the
+	// signed message would not be a multiple of the block size
+	if tsig != nil && jobConfig.EDNSPadding > 0 {
+		return errors.New("edns padding can't be used with tsig")
+	}
+	if appController != nil {
+		if err := appController.Safety.Check(jobConfig, senders(appController)); err != nil {
+			return err
+		}
+	}
 	if jobConfig.JobID == "" {
 		id, _ := uuid.NewV4()
 		jobConfig.JobID = (*id).String()
@@ -115,6 +300,40 @@ func (jobConfig *JobConfig) ValidateJob() error {
 	return nil
 }
 
+// useEDNSOptions return true when any edns option is set in the job
+func (jobConfig *JobConfig) useEDNSOptions() bool {
+	return jobConfig.EDNSUDPSize > 0 ||
+		jobConfig.EDNSVersion > 0 ||
+		jobConfig.EDNSNSID == "true" ||
+		(jobConfig.EDNSCookie != "" && jobConfig.EDNSCookie != EDNSCookieNone) ||
+		jobConfig.EDNSPadding > 0 ||
+		jobConfig.EDNSKeepalive == "true"
+}
+
+// useValidation return true when the responses should be validated
+func (jobConfig *JobConfig) useValidation() bool {
+	return jobConfig.EnableValidation == "true" || jobConfig.Expectations != ""
+}
+
+// NewTSIG return the TSIG signer of the job, nil when TSIG is not used.
+// The key name and secret in job will be used before the key file
+func (jobConfig *JobConfig) NewTSIG() (*dns.TSIG, error) {
+	if jobConfig.TSIGSecret != "" {
+		algorithm := jobConfig.TSIGAlgorithm
+		if algorithm == "" {
+			algorithm = dns.HmacSHA256
+		}
+		return dns.NewTSIG(jobConfig.TSIGKeyName, algorithm, jobConfig.TSIGSecret)
+	}
+	if jobConfig.TSIGKeyFile != "" {
+		return dns.NewTSIGFromFile(jobConfig.TSIGKeyFile)
+	}
+	if jobConfig.TSIGKeyName != "" {
+		return nil, errors.New("tsig secret or key file is required")
+	}
+	return nil, nil
+}
+
 // AppController hold all infomation and control interface for this app
 type AppController struct {
 	sync.RWMutex
@@ -124,6 +343,9 @@ type AppController struct {
 	LoadCaller
 	Status   uint32
 	IsMaster bool
+	report   *Report
+	// abortReason is why the guard of master or an agent abort the job
+	abortReason string
 }
 
 var appController *AppController
@@ -140,9 +362,8 @@ func NewAppControllerFromFile(file string) (*AppController, error) {
 		IsMaster:  true,
 		Status:    StatusStopped,
 	}
-	if err = controller.ValidateJob(); err != nil {
-		return nil, err
-	}
+	// the default job has no dns server, each job is validated when it
+	// is submitted
 	appController = controller
 	return controller, nil
 }
@@ -150,7 +371,9 @@ func NewAppControllerFromFile(file string) (*AppController, error) {
 // GetGlobalAppController return current appAppController
 func GetGlobalAppController() *AppController {
 	if appController == nil {
+		// the agent has no config file, its safety policy is set by flags
 		appController = &AppController{
+			AppConfig: &AppConfig{UploadDir: DefaultUploadDir},
 			JobConfig: NewDefaultJobConfig(),
 			IsMaster:  false,
 			Status:    StatusStopped,
@@ -180,3 +403,15 @@ func (config *AppController) SetCurrentJobStatus(status uint32) error {
 	config.Status = status
 	return nil
 }
+
+// ClaimJobStatus change the status from stopped to start for a new job,
+// it return false when another job is running or has been claimed
+func (config *AppController) ClaimJobStatus() bool {
+	config.Lock()
+	defer config.Unlock()
+	if config.Status != StatusStopped {
+		return false
+	}
+	config.Status = StatusStart
+	return true
+}
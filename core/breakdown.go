@@ -0,0 +1,144 @@
+package core
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/zhangmingkai4315/dns-loader/dns"
+)
+
+// breakdownKey is the query type and the name pattern which generate
+// the query
+type breakdownKey struct {
+	pattern string
+	qtype   uint16
+}
+
+// breakdownRow hold the result of queries with the same key
+type breakdownRow struct {
+	sent    uint64
+	rcodes  map[uint8]uint64
+	latency *Histogram
+}
+
+// sentQuery is the row and sending time of a query waiting for response
+type sentQuery struct {
+	row  *breakdownRow
+	sent time.Time
+}
+
+// resultBreakdown count the result and the latency of queries by query
+// type and name pattern, the responses are matched to queries by id so
+// an id reused before the response arrived count the earlier query as
+// unknown
+type resultBreakdown struct {
+	lock     sync.Mutex
+	rows     map[breakdownKey]*breakdownRow
+	inflight [65536]sentQuery
+	// latency is the latency of all responses
+	latency *Histogram
+}
+
+func newResultBreakdown() *resultBreakdown {
+	return &resultBreakdown{rows: make(map[breakdownKey]*breakdownRow), latency: NewHistogram()}
+}
+
+// Sent record the query generated by the pattern
+func (breakdown *resultBreakdown) Sent(pattern string, msg []byte) {
+	if len(msg) < 2 {
+		return
+	}
+	qtype, _ := dns.QuestionType(msg)
+	key := breakdownKey{pattern: pattern, qtype: qtype}
+	now := time.Now()
+	breakdown.lock.Lock()
+	row, ok := breakdown.rows[key]
+	if !ok {
+		row = &breakdownRow{rcodes: make(map[uint8]uint64), latency: NewHistogram()}
+		breakdown.rows[key] = row
+	}
+	row.sent++
+	breakdown.inflight[binary.BigEndian.Uint16(msg)] = sentQuery{row: row, sent: now}
+	breakdown.lock.Unlock()
+}
+
+// Received record the rcode and the latency of response, it return the
+// latency and false when the response match no query
+func (breakdown *resultBreakdown) Received(msg []byte) (time.Duration, bool) {
+	if len(msg) < 4 {
+		return 0, false
+	}
+	now := time.Now()
+	id := binary.BigEndian.Uint16(msg)
+	breakdown.lock.Lock()
+	query := breakdown.inflight[id]
+	if query.row == nil {
+		breakdown.lock.Unlock()
+		return 0, false
+	}
+	breakdown.inflight[id] = sentQuery{}
+	query.row.rcodes[msg[3]&0x0f]++
+	breakdown.lock.Unlock()
+	latency := now.Sub(query.sent)
+	query.row.latency.Record(latency)
+	breakdown.latency.Record(latency)
+	return latency, true
+}
+
+// Rows return the result of each query type and pattern
+func (breakdown *resultBreakdown) Rows() []BreakdownRow {
+	breakdown.lock.Lock()
+	defer breakdown.lock.Unlock()
+	var rows []BreakdownRow
+	for key, row := range breakdown.rows {
+		result := BreakdownRow{
+			Qtype:   qtypeName(key.qtype),
+			Pattern: key.pattern,
+			Sent:    row.sent,
+			Rcodes:  make(map[string]uint64),
+			Latency: row.latency.Summary(),
+		}
+		var received uint64
+		for code, count := range row.rcodes {
+			result.Rcodes[dns.DNSRcodeReverse[code]] = count
+			received += count
+		}
+		if row.sent > received {
+			result.Unknown = row.sent - received
+		}
+		rows = append(rows, result)
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		return rows[i].Pattern < rows[j].Pattern || (rows[i].Pattern == rows[j].Pattern && rows[i].Qtype < rows[j].Qtype)
+	})
+	return rows
+}
+
+// Report log the rcodes and the latency of each query type and pattern
+func (breakdown *resultBreakdown) Report() {
+	result := log.WithFields(log.Fields{"result": true})
+	for _, row := range breakdown.Rows() {
+		var codes []string
+		for code, count := range row.Rcodes {
+			codes = append(codes, fmt.Sprintf("%s:%d", code, count))
+		}
+		sort.Strings(codes)
+		codes = append(codes, fmt.Sprintf("unknown:%d [%.2f]", row.Unknown, float64(row.Unknown*100)/float64(row.Sent)))
+		result.Infof("qtype %s pattern %s sent:%d %s latency mean:%v p50:%v p90:%v p99:%v max:%v",
+			row.Qtype, row.Pattern, row.Sent, strings.Join(codes, " "),
+			row.Latency.Mean, row.Latency.P50, row.Latency.P90, row.Latency.P99, row.Latency.Max)
+	}
+}
+
+func qtypeName(qtype uint16) string {
+	if name, ok := dns.DNSTypeUintToString[qtype]; ok {
+		return name
+	}
+	return fmt.Sprintf("TYPE%d", qtype)
+}
@@ -0,0 +1,78 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/zhangmingkai4315/dns-loader/dns"
+)
+
+func TestResultBreakdown(t *testing.T) {
+	breakdown := newResultBreakdown()
+	newQuery := func(id uint16, qtype uint16) []byte {
+		packet := new(dns.Packet)
+		packet.SetQuestion("www.example.com.", qtype)
+		packet.Header.ID = id
+		msg, _ := packet.ToBytes()
+		return msg
+	}
+	a := newQuery(1, dns.TypeA)
+	aaaa := newQuery(2, dns.TypeAAAA)
+	breakdown.Sent("*.example.com.", a)
+	breakdown.Sent("*.example.com.", aaaa)
+	breakdown.Sent("*.example.com.", newQuery(3, dns.TypeAAAA))
+	breakdown.Sent("notify", newQuery(4, dns.TypeSOA))
+	_, ok := breakdown.Received(buildTestResponse(a, 0))
+	Assert(t, ok, "expect response of query 1 matched")
+	breakdown.Received(buildTestResponse(aaaa, 2))
+	// duplicated and unknown responses are ignored
+	_, ok = breakdown.Received(buildTestResponse(aaaa, 2))
+	Assert(t, !ok, "expect duplicated response ignored")
+	_, ok = breakdown.Received(buildTestResponse(newQuery(5, dns.TypeA), 0))
+	Assert(t, !ok, "expect unknown response ignored")
+
+	Equals(t, 3, len(breakdown.rows))
+	row := breakdown.rows[breakdownKey{pattern: "*.example.com.", qtype: dns.TypeA}]
+	Equals(t, uint64(1), row.sent)
+	Equals(t, map[uint8]uint64{0: 1}, row.rcodes)
+	Equals(t, uint64(1), row.latency.Count())
+	row = breakdown.rows[breakdownKey{pattern: "*.example.com.", qtype: dns.TypeAAAA}]
+	Equals(t, uint64(2), row.sent)
+	Equals(t, map[uint8]uint64{2: 1}, row.rcodes)
+	row = breakdown.rows[breakdownKey{pattern: "notify", qtype: dns.TypeSOA}]
+	Equals(t, uint64(1), row.sent)
+	Equals(t, 0, len(row.rcodes))
+}
+
+func TestGroupResults(t *testing.T) {
+	client := &DNSClient{
+		Conn: []*ClientConn{
+			{Source: "10.0.0.1", Target: "192.0.2.1:53"},
+			{Source: "10.0.0.2", Target: "192.0.2.1:53"},
+			{Source: "10.0.0.1", Target: "192.0.2.2:53"},
+		},
+		sent: []uint64{10, 5, 4},
+	}
+	dlg := &dnsLoaderGen{
+		caller: client,
+		result: []map[uint8]uint64{{0: 8, 2: 1}, {0: 5}, {3: 2}},
+	}
+	for i := range client.Conn {
+		dlg.latency = append(dlg.latency, NewHistogram())
+		dlg.latency[i].Record(time.Duration(i+1) * time.Millisecond)
+	}
+	results := dlg.groupResults("source", func(conn *ClientConn) string { return conn.Source })
+	Equals(t, 2, len(results))
+	Equals(t, GroupResult{
+		Name:     "10.0.0.1",
+		Sent:     14,
+		Received: 11,
+		Rcodes:   map[string]uint64{"Success": 8, "ServerFail": 1, "NXDOMAIN": 2},
+		Unknown:  3,
+		Latency:  results[0].Latency,
+	}, results[0])
+	Equals(t, uint64(2), results[0].Latency.Count)
+	Equals(t, 3*time.Millisecond, results[0].Latency.Max)
+	Equals(t, "10.0.0.2", results[1].Name)
+	Equals(t, uint64(0), results[1].Unknown)
+}
@@ -0,0 +1,206 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/zhangmingkai4315/dns-loader/dns"
+)
+
+// CompareThresholds define the changes from the base run counted as
+// regressions, the qps and latency are in percent of the base value and
+// the rcode and timeout ratios are in percentage points
+type CompareThresholds struct {
+	QPSDrop         float64 `json:"qps_drop"`
+	RcodeChange     float64 `json:"rcode_change"`
+	TimeoutIncrease float64 `json:"timeout_increase"`
+	LatencyIncrease float64 `json:"latency_increase"`
+}
+
+// DefaultCompareThresholds is the thresholds used when not set
+var DefaultCompareThresholds = CompareThresholds{
+	QPSDrop:         5,
+	RcodeChange:     0.5,
+	TimeoutIncrease: 0.5,
+	LatencyIncrease: 20,
+}
+
+// ConfigDiff is a job setting different in the runs
+type ConfigDiff struct {
+	Field string `json:"field"`
+	A     string `json:"a"`
+	B     string `json:"b"`
+}
+
+// ComparisonRow is a metric of the runs
+type ComparisonRow struct {
+	Metric     string `json:"metric"`
+	A          string `json:"a"`
+	B          string `json:"b"`
+	Delta      string `json:"delta"`
+	Regression bool   `json:"regression"`
+}
+
+// Comparison is the result of comparing run b with the base run a
+type Comparison struct {
+	ConfigDiff  []ConfigDiff    `json:"config_diff"`
+	Rows        []ComparisonRow `json:"rows"`
+	Regressions int             `json:"regressions"`
+}
+
+// configIgnored is the job settings not compared
+var configIgnored = map[string]bool{
+	"job_id":           true,
+	"resolved_targets": true,
+}
+
+// CompareReports compare report b with the base report a
+func CompareReports(a, b *Report, thresholds CompareThresholds) *Comparison {
+	comparison := &Comparison{ConfigDiff: compareConfig(&a.Job, &b.Job)}
+	comparison.add(ComparisonRow{
+		Metric: "target qps",
+		A:      fmt.Sprintf("%d", a.TargetQPS),
+		B:      fmt.Sprintf("%d", b.TargetQPS),
+		Delta:  fmt.Sprintf("%+d", int64(b.TargetQPS)-int64(a.TargetQPS)),
+	})
+	comparison.add(ComparisonRow{
+		Metric:     "qps",
+		A:          fmt.Sprintf("%.2f", a.QPS),
+		B:          fmt.Sprintf("%.2f", b.QPS),
+		Delta:      percentChange(a.QPS, b.QPS),
+		Regression: a.QPS > 0 && (a.QPS-b.QPS)*100/a.QPS > thresholds.QPSDrop,
+	})
+	comparison.add(ComparisonRow{
+		Metric: "sent",
+		A:      fmt.Sprintf("%d", a.Sent),
+		B:      fmt.Sprintf("%d", b.Sent),
+		Delta:  fmt.Sprintf("%+d", int64(b.Sent)-int64(a.Sent)),
+	})
+	var rcodes []string
+	for rcode := range a.Rcodes {
+		rcodes = append(rcodes, rcode)
+	}
+	for rcode := range b.Rcodes {
+		if _, ok := a.Rcodes[rcode]; !ok {
+			rcodes = append(rcodes, rcode)
+		}
+	}
+	sort.Strings(rcodes)
+	success := a.SuccessRatio() - b.SuccessRatio()
+	for _, rcode := range rcodes {
+		change := b.RcodeRatio(rcode) - a.RcodeRatio(rcode)
+		// the success ratio is a regression when it drop and the other
+		// rcodes when they rise
+		if rcode == dns.DNSRcodeReverse[dns.RcodeSuccess] {
+			change = success
+		}
+		comparison.add(ComparisonRow{
+			Metric:     "rcode " + rcode,
+			A:          fmt.Sprintf("%.2f%%", a.RcodeRatio(rcode)),
+			B:          fmt.Sprintf("%.2f%%", b.RcodeRatio(rcode)),
+			Delta:      fmt.Sprintf("%+.2f", b.RcodeRatio(rcode)-a.RcodeRatio(rcode)),
+			Regression: change > thresholds.RcodeChange,
+		})
+	}
+	comparison.add(ComparisonRow{
+		Metric:     "timeout",
+		A:          fmt.Sprintf("%.2f%%", a.TimeoutRatio()),
+		B:          fmt.Sprintf("%.2f%%", b.TimeoutRatio()),
+		Delta:      fmt.Sprintf("%+.2f", b.TimeoutRatio()-a.TimeoutRatio()),
+		Regression: b.TimeoutRatio()-a.TimeoutRatio() > thresholds.TimeoutIncrease,
+	})
+	for _, latency := range []struct {
+		name string
+		a, b time.Duration
+	}{
+		{"latency mean", a.Latency.Mean, b.Latency.Mean},
+		{"latency p50", a.Latency.P50, b.Latency.P50},
+		{"latency p90", a.Latency.P90, b.Latency.P90},
+		{"latency p99", a.Latency.P99, b.Latency.P99},
+	} {
+		comparison.add(ComparisonRow{
+			Metric:     latency.name,
+			A:          latency.a.String(),
+			B:          latency.b.String(),
+			Delta:      percentChange(float64(latency.a), float64(latency.b)),
+			Regression: latency.a > 0 && float64(latency.b-latency.a)*100/float64(latency.a) > thresholds.LatencyIncrease,
+		})
+	}
+	comparison.compareTargets(a, b, thresholds)
+	return comparison
+}
+
+// compareTargets add the timeout and latency rows of targets in both runs
+func (comparison *Comparison) compareTargets(a, b *Report, thresholds CompareThresholds) {
+	targets := make(map[string]GroupResult)
+	for _, target := range a.Targets {
+		targets[target.Name] = target
+	}
+	for _, targetB := range b.Targets {
+		targetA, ok := targets[targetB.Name]
+		if !ok {
+			continue
+		}
+		comparison.add(ComparisonRow{
+			Metric:     "timeout " + targetB.Name,
+			A:          fmt.Sprintf("%.2f%%", targetA.TimeoutRatio()),
+			B:          fmt.Sprintf("%.2f%%", targetB.TimeoutRatio()),
+			Delta:      fmt.Sprintf("%+.2f", targetB.TimeoutRatio()-targetA.TimeoutRatio()),
+			Regression: targetB.TimeoutRatio()-targetA.TimeoutRatio() > thresholds.TimeoutIncrease,
+		})
+		latencyA, latencyB := targetA.Latency.P99, targetB.Latency.P99
+		comparison.add(ComparisonRow{
+			Metric:     "p99 " + targetB.Name,
+			A:          latencyA.String(),
+			B:          latencyB.String(),
+			Delta:      percentChange(float64(latencyA), float64(latencyB)),
+			Regression: latencyA > 0 && float64(latencyB-latencyA)*100/float64(latencyA) > thresholds.LatencyIncrease,
+		})
+	}
+}
+
+func (comparison *Comparison) add(row ComparisonRow) {
+	comparison.Rows = append(comparison.Rows, row)
+	if row.Regression {
+		comparison.Regressions++
+	}
+}
+
+func percentChange(a, b float64) string {
+	if a == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%+.2f%%", (b-a)*100/a)
+}
+
+// compareConfig return the job settings different in the runs
+func compareConfig(a, b *JobConfig) []ConfigDiff {
+	fieldsA, fieldsB := configFields(a), configFields(b)
+	var names []string
+	for name := range fieldsA {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var diff []ConfigDiff
+	for _, name := range names {
+		if configIgnored[name] || fieldsA[name] == fieldsB[name] {
+			continue
+		}
+		diff = append(diff, ConfigDiff{Field: name, A: fieldsA[name], B: fieldsB[name]})
+	}
+	return diff
+}
+
+// configFields return the job settings by json name
+func configFields(job *JobConfig) map[string]string {
+	fields := make(map[string]string)
+	data, _ := json.Marshal(job)
+	values := make(map[string]interface{})
+	json.Unmarshal(data, &values)
+	for name, value := range values {
+		fields[name] = fmt.Sprint(value)
+	}
+	return fields
+}
@@ -0,0 +1,76 @@
+package core
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCompareReports(t *testing.T) {
+	base := &Report{
+		Job:       JobConfig{Server: "192.0.2.1", QPS: 1000, JobID: "a"},
+		TargetQPS: 1000,
+		QPS:       1000,
+		Sent:      10000,
+		Rcodes:    map[string]uint64{"Success": 9990},
+		Unknown:   10,
+		Latency:   LatencySummary{Mean: time.Millisecond, P50: time.Millisecond, P90: 2 * time.Millisecond, P99: 4 * time.Millisecond},
+	}
+	content, err := base.JSON()
+	OK(t, err)
+	run, err := ParseReport([]byte(content))
+	OK(t, err)
+	run.Job.JobID = "b"
+	comparison := CompareReports(base, run, DefaultCompareThresholds)
+	Equals(t, 0, comparison.Regressions)
+	Equals(t, 0, len(comparison.ConfigDiff))
+
+	run.Job.Server = "192.0.2.2"
+	run.QPS = 900
+	run.Rcodes = map[string]uint64{"Success": 9800, "ServerFail": 100}
+	run.Unknown = 100
+	run.Latency.P99 = 5 * time.Millisecond
+	comparison = CompareReports(base, run, DefaultCompareThresholds)
+	Equals(t, []ConfigDiff{{Field: "server", A: "192.0.2.1", B: "192.0.2.2"}}, comparison.ConfigDiff)
+	var regressions []string
+	for _, row := range comparison.Rows {
+		if row.Regression {
+			regressions = append(regressions, row.Metric)
+		}
+	}
+	Equals(t, []string{"qps", "rcode ServerFail", "rcode Success", "timeout", "latency p99"}, regressions)
+	Equals(t, 5, comparison.Regressions)
+
+	thresholds := DefaultCompareThresholds
+	thresholds.LatencyIncrease = 50
+	Equals(t, 4, CompareReports(base, run, thresholds).Regressions)
+}
+
+func TestCompareTargets(t *testing.T) {
+	base := &Report{
+		Sent:    2000,
+		Rcodes:  map[string]uint64{"Success": 2000},
+		Latency: LatencySummary{P99: 4 * time.Millisecond},
+		Targets: []GroupResult{
+			{Name: "192.0.2.1:53", Sent: 1000, Received: 1000, Latency: LatencySummary{P99: 4 * time.Millisecond}},
+			{Name: "192.0.2.2:53", Sent: 1000, Received: 1000, Latency: LatencySummary{P99: 4 * time.Millisecond}},
+		},
+	}
+	run := &Report{
+		Sent:    2000,
+		Rcodes:  map[string]uint64{"Success": 2000},
+		Latency: LatencySummary{P99: 4 * time.Millisecond},
+		Targets: []GroupResult{
+			{Name: "192.0.2.1:53", Sent: 1000, Received: 980, Unknown: 20, Latency: LatencySummary{P99: 4 * time.Millisecond}},
+			{Name: "192.0.2.2:53", Sent: 1000, Received: 1000, Latency: LatencySummary{P99: 8 * time.Millisecond}},
+			{Name: "192.0.2.3:53", Sent: 1000, Unknown: 1000},
+		},
+	}
+	comparison := CompareReports(base, run, DefaultCompareThresholds)
+	var regressions []string
+	for _, row := range comparison.Rows {
+		if row.Regression {
+			regressions = append(regressions, row.Metric)
+		}
+	}
+	Equals(t, []string{"timeout 192.0.2.1:53", "p99 192.0.2.2:53"}, regressions)
+}
@@ -0,0 +1,151 @@
+package core
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronDescriptors are the short names of cron expressions
+var cronDescriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// cronMaxYears limit the search of next time, e.g. for 0 0 30 2 *
+const cronMaxYears = 5
+
+// CronSchedule is a cron expression with the fields minute, hour, day of
+// month, month and day of week, each field is a set of allowed values
+type CronSchedule struct {
+	minute uint64
+	hour   uint64
+	dom    uint64
+	month  uint64
+	dow    uint64
+	// the job run when either day of month or day of week match if both
+	// of them are restricted, like the cron daemon
+	domAny bool
+	dowAny bool
+}
+
+// ParseCron parse the cron expression like "0 2 * * *" (02:00 every day),
+// each field support *, lists (1,15), ranges (1-5) and steps (*/10), day
+// of week is 0-7 (0 and 7 are sunday). @daily, @hourly, @weekly,
+// @monthly and @yearly are supported too
+func ParseCron(spec string) (*CronSchedule, error) {
+	spec = strings.TrimSpace(spec)
+	if expression, ok := cronDescriptors[spec]; ok {
+		spec = expression
+	}
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron expression %q must have 5 fields", spec)
+	}
+	schedule := &CronSchedule{}
+	for i, field := range []struct {
+		bits     *uint64
+		min, max int
+	}{
+		{&schedule.minute, 0, 59},
+		{&schedule.hour, 0, 23},
+		{&schedule.dom, 1, 31},
+		{&schedule.month, 1, 12},
+		{&schedule.dow, 0, 7},
+	} {
+		bits, err := parseCronField(fields[i], field.min, field.max)
+		if err != nil {
+			return nil, fmt.Errorf("cron expression %q: %s", spec, err)
+		}
+		*field.bits = bits
+	}
+	if schedule.dow&(1<<7) != 0 {
+		schedule.dow |= 1
+	}
+	schedule.domAny = strings.HasPrefix(fields[2], "*")
+	schedule.dowAny = strings.HasPrefix(fields[4], "*")
+	return schedule, nil
+}
+
+// parseCronField return the allowed values of field as bits
+func parseCronField(field string, min, max int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if index := strings.Index(part, "/"); index >= 0 {
+			var err error
+			step, err = strconv.Atoi(part[index+1:])
+			if err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step %s", part)
+			}
+			part = part[:index]
+		}
+		start, end := min, max
+		if part != "*" {
+			bounds := strings.SplitN(part, "-", 2)
+			var err error
+			if start, err = strconv.Atoi(bounds[0]); err != nil {
+				return 0, fmt.Errorf("invalid value %s", part)
+			}
+			end = start
+			if len(bounds) == 2 {
+				if end, err = strconv.Atoi(bounds[1]); err != nil {
+					return 0, fmt.Errorf("invalid value %s", part)
+				}
+			} else if step > 1 {
+				// 5/10 means from 5 to the end every 10
+				end = max
+			}
+		}
+		if start < min || end > max || start > end {
+			return 0, fmt.Errorf("value %s out of range %d-%d", part, min, max)
+		}
+		for value := start; value <= end; value += step {
+			bits |= 1 << uint(value)
+		}
+	}
+	return bits, nil
+}
+
+// matchDay return true when the job run in the day
+func (schedule *CronSchedule) matchDay(t time.Time) bool {
+	dom := schedule.dom&(1<<uint(t.Day())) != 0
+	dow := schedule.dow&(1<<uint(t.Weekday())) != 0
+	if schedule.domAny || schedule.dowAny {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// Next return the first time after t the job run, the zero time is
+// returned when no time match in the next years
+func (schedule *CronSchedule) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	end := t.AddDate(cronMaxYears, 0, 0)
+	for t.Before(end) {
+		if schedule.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !schedule.matchDay(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if schedule.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if schedule.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
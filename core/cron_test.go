@@ -0,0 +1,62 @@
+package core
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCron(t *testing.T) {
+	for _, spec := range []string{
+		"0 2 * * *",
+		"*/15 * * * 1-5",
+		"0 0,12 1 */2 *",
+		"5/10 * * * 7",
+		"@daily",
+		"@hourly",
+	} {
+		_, err := ParseCron(spec)
+		OK(t, err)
+	}
+	for _, spec := range []string{
+		"",
+		"0 2 * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"a * * * *",
+		"@reboot",
+	} {
+		_, err := ParseCron(spec)
+		Assert(t, err != nil, "expect error for %q", spec)
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	// 2019-07-01 is monday
+	now := time.Date(2019, 7, 1, 10, 30, 20, 0, time.UTC)
+	for _, c := range []struct {
+		spec string
+		next time.Time
+	}{
+		{"0 2 * * *", time.Date(2019, 7, 2, 2, 0, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2019, 7, 1, 10, 45, 0, 0, time.UTC)},
+		{"31 10 * * *", time.Date(2019, 7, 1, 10, 31, 0, 0, time.UTC)},
+		{"30 10 * * *", time.Date(2019, 7, 2, 10, 30, 0, 0, time.UTC)},
+		{"0 9 * * 0", time.Date(2019, 7, 7, 9, 0, 0, 0, time.UTC)},
+		{"0 9 * * 7", time.Date(2019, 7, 7, 9, 0, 0, 0, time.UTC)},
+		{"0 0 1 1 *", time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"@monthly", time.Date(2019, 8, 1, 0, 0, 0, 0, time.UTC)},
+		// day of month or day of week when both are set
+		{"0 0 15 * 3", time.Date(2019, 7, 3, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2020, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 0 30 2 *", time.Time{}},
+	} {
+		schedule, err := ParseCron(c.spec)
+		OK(t, err)
+		Equals(t, c.next, schedule.Next(now))
+	}
+}
@@ -2,7 +2,9 @@ package core
 
 import (
 	"fmt"
+	"net"
 	"os"
+	"strconv"
 
 	log "github.com/sirupsen/logrus"
 
@@ -30,13 +32,20 @@ type Agent struct {
 
 //IPAddrWithPort return connect ip and port combination
 func (agent Agent) IPAddrWithPort() string {
-	return agent.IP + ":" + agent.Port
+	return net.JoinHostPort(agent.IP, agent.Port)
 }
 
-// DNSQuery save all query history
+// DNSQuery save all query history, the report of job in json format
+// is saved when the job done. SLO is pass or fail when the job has
+// assertions, User is the user launched the job
 type DNSQuery struct {
 	gorm.Model
 	JobConfig
+	Report string `json:"-" gorm:"type:text"`
+	SLO    string `json:"slo"`
+	User   string `json:"user"`
+	// AgentErrors is why the agents fail to start the job
+	AgentErrors string `json:"agent_errors"`
 }
 
 // NewDatabaseConnectionFromFile create database from file
@@ -53,7 +62,7 @@ func NewDatabaseConnectionFromFile(dbfile string) error {
 	if err != nil {
 		log.Fatalf("open dbfile error: %s", err.Error())
 	}
-	db.AutoMigrate(&Agent{}, &DNSQuery{})
+	db.AutoMigrate(&Agent{}, &DNSQuery{}, &User{}, &APIToken{}, &QueuedJob{}, &Schedule{}, &JobTemplate{})
 	dbHander = &DBHandler{
 		DB: db,
 	}
@@ -65,21 +74,66 @@ func GetDBHandler() *DBHandler {
 	return dbHander
 }
 
-// CreateDNSQueryHistory save a new dns query info
-func (dbHander *DBHandler) CreateDNSQueryHistory(appController *AppController) error {
+// CreateDNSQueryHistory save a new dns query info launched by the user
+// and return its id, agentErrors is why the agents fail to start it
+func (dbHander *DBHandler) CreateDNSQueryHistory(appController *AppController, user string, agentErrors string) (uint, error) {
 	jobConfig := appController.JobConfig
 	dnsQuery := DNSQuery{
-		JobConfig: *jobConfig,
+		JobConfig:   *jobConfig,
+		User:        user,
+		AgentErrors: agentErrors,
 	}
-	return dbHander.Model(&DNSQuery{}).Save(&dnsQuery).Error
+	err := dbHander.Model(&DNSQuery{}).Save(&dnsQuery).Error
+	return dnsQuery.ID, err
+}
+
+// SaveDNSQueryReport save the report of the dns query
+func (dbHander *DBHandler) SaveDNSQueryReport(id uint, report *Report) error {
+	content, err := report.JSON()
+	if err != nil {
+		return err
+	}
+	slo := ""
+	if len(report.Assertions) > 0 {
+		slo = "fail"
+		if report.Passed() {
+			slo = "pass"
+		}
+	}
+	return dbHander.Model(&DNSQuery{}).Where("id = ?", id).Updates(map[string]interface{}{"report": content, "slo": slo}).Error
+}
+
+// GetDNSQueryReport return the report of the dns query
+func (dbHander *DBHandler) GetDNSQueryReport(id uint) (*Report, error) {
+	dnsQuery := DNSQuery{}
+	if err := dbHander.First(&dnsQuery, id).Error; err != nil {
+		return nil, err
+	}
+	if dnsQuery.Report == "" {
+		return nil, fmt.Errorf("no report of query history %d", id)
+	}
+	return ParseReport([]byte(dnsQuery.Report))
 }
 
 // GetDNSQueryHistory return DNSQuery for datatables
 func (dbHander *DBHandler) GetDNSQueryHistory(start, length int, search string) ([]DNSQuery, error) {
 	data := []DNSQuery{}
-	err := dbHander.Order("id desc").Limit(length).Offset(start).Where("server LIKE ? or domain Like ?", "%"+search+"%", "%"+search+"%").Find(&data).Error
+	err := dbHander.Order("id desc").Limit(length).Offset(start).Where("server LIKE ? or domain Like ? or resolved_targets LIKE ? or user LIKE ?", "%"+search+"%", "%"+search+"%", "%"+search+"%", "%"+search+"%").Find(&data).Error
 	if err != nil && gorm.IsRecordNotFoundError(err) == false {
 		return data, err
 	}
 	return data, nil
 }
+
+// GetDNSQuery return the dns query by the history id or the job id
+func (dbHander *DBHandler) GetDNSQuery(id string) (*DNSQuery, error) {
+	dnsQuery := &DNSQuery{}
+	db := dbHander.Where("job_id = ?", id)
+	if historyID, err := strconv.ParseUint(id, 10, 32); err == nil {
+		db = dbHander.Where("id = ?", historyID)
+	}
+	if err := db.First(dnsQuery).Error; err != nil {
+		return nil, fmt.Errorf("job %s not exist", id)
+	}
+	return dnsQuery, nil
+}
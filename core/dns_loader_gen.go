@@ -1,9 +1,13 @@
 package core
 
 import (
+	"bufio"
 	"context"
 	"encoding/binary"
 	"fmt"
+	"io"
+	"net"
+	"sort"
 	"strings"
 	"sync/atomic"
 	"time"
@@ -23,6 +27,7 @@ type LoadParams struct {
 	ClientNumber int
 	Protocol     string
 	Duration     time.Duration
+	Replay       *ReplaySource
 }
 
 // Info return the basic info of lodaer params
@@ -73,7 +78,12 @@ type dnsLoaderGen struct {
 	callCount      uint64
 	workers        int
 	startTime      time.Time
+	replay         *ReplaySource
 	result         []map[uint8]uint64
+	latency        []*Histogram
+	notifyAcks     uint64
+	stats          *ResponseStats
+	guard          *abortGuard
 }
 
 func (dlg *dnsLoaderGen) Start() bool {
@@ -96,33 +106,17 @@ func (dlg *dnsLoaderGen) Start() bool {
 	log.Infoln("create new thread to receive dns data from server")
 	dnsclient := dlg.caller.(*DNSClient)
 	for i := 0; i < dnsclient.NumConn; i++ {
-		go func(index int) {
-			buf := make([]byte, 4096) // using small tmo buffer for demonstrating
-			for {
-				n, err := dnsclient.Conn[index].Read(buf)
-				if err != nil || n == 0 {
-					log.Errorf("error = %v, n=%d", err, n)
-					break
-				}
-				log.Warnf("read n=%d", n)
-				if dlg.protocolOffset != 0 {
-					//running in tcp mode
-					size := binary.BigEndian.Uint16(buf[:2])
-					offset := 0
-					for n >= (int(size) + 2 + offset) {
-						// multi dns packets in single tcp
-						log.Warnf("offset =%d", offset)
-						code := buf[3+dlg.protocolOffset] & 0x0f
-						dlg.result[index][code] = dlg.result[index][code] + 1
-						offset += int(size) + 2
-					}
-				} else {
-					// running in udp
-					code := buf[3+dlg.protocolOffset] & 0x0f
-					dlg.result[index][code] = dlg.result[index][code] + 1
-				}
-			}
-		}(i)
+		go dlg.receive(dnsclient, i)
+	}
+	if dnsclient.fallback != nil {
+		dnsclient.fallback.Run(dlg.ctx)
+	}
+	dlg.guard = newAbortGuard(app.JobConfig)
+	if dlg.guard != nil {
+		go dlg.runGuard(dnsclient)
+	}
+	if interval, _ := time.ParseDuration(app.JobConfig.ResolveInterval); interval > 0 {
+		go dnsclient.Reresolve(dlg.ctx, app.JobConfig, interval)
 	}
 
 	var limiter ratelimit.Limiter
@@ -135,11 +129,106 @@ func (dlg *dnsLoaderGen) Start() bool {
 	return true
 }
 
+// receive read the responses from one connection until it is closed
+func (dlg *dnsLoaderGen) receive(dnsclient *DNSClient, index int) {
+	for {
+		conn := dnsclient.Conn[index].current()
+		err := dlg.receiveFrom(dnsclient, index, conn)
+		// continue with the new connection when the target is moved
+		if dnsclient.Conn[index].current() == conn {
+			log.Debugf("read from connection stop: %v", err)
+			return
+		}
+	}
+}
+
+// receiveFrom read the responses from the connection until read fail
+func (dlg *dnsLoaderGen) receiveFrom(dnsclient *DNSClient, index int, conn net.Conn) error {
+	if dlg.protocolOffset != 0 {
+		// running in tcp mode, multi dns messages may be in single read
+		// and one message may be split into several reads
+		reader := bufio.NewReader(conn)
+		length := make([]byte, 2)
+		for {
+			if _, err := io.ReadFull(reader, length); err != nil {
+				return err
+			}
+			msg := make([]byte, binary.BigEndian.Uint16(length))
+			if _, err := io.ReadFull(reader, msg); err != nil {
+				return err
+			}
+			dlg.handleResponse(dnsclient, index, msg)
+		}
+	}
+	// running in udp
+	buf := make([]byte, 65535)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return err
+		}
+		dlg.handleResponse(dnsclient, index, buf[:n])
+	}
+}
+
+func (dlg *dnsLoaderGen) handleResponse(dnsclient *DNSClient, index int, msg []byte) {
+	if len(msg) < 4 {
+		return
+	}
+	code := msg[3] & 0x0f
+	dlg.result[index][code] = dlg.result[index][code] + 1
+	dlg.stats.Record(msg)
+	if dlg.guard != nil {
+		dlg.guard.Received(msg)
+	}
+	if latency, ok := dnsclient.breakdown.Received(msg); ok {
+		dlg.latency[index].Record(latency)
+	}
+	if dlg.protocolOffset == 0 && msg[2]&0x02 != 0 && dnsclient.fallback != nil {
+		dnsclient.fallback.Retry(dnsclient.Conn[index], msg)
+	}
+	if dnsclient.notify != nil && IsNotifyResponse(msg) {
+		atomic.AddUint64(&dlg.notifyAcks, 1)
+	}
+	dnsclient.HandleResponse(msg)
+}
+
+// runGuard check the abort guard every second until the job done, the
+// job is stopped on this node and all agents when the guard trips
+func (dlg *dnsLoaderGen) runGuard(dnsclient *DNSClient) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-dlg.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		reason := dlg.guard.Check(atomic.LoadUint64(&dlg.callCount), dnsclient.SendErrors())
+		if reason == "" {
+			continue
+		}
+		log.Warnf("abort the job: %s", reason)
+		// the agents report the reason in status and the master stop the
+		// job on all agents
+		app := GetGlobalAppController()
+		app.SetAbortReason(reason)
+		if app.IsMaster {
+			go GetNodeManager().Call(Kill, nil)
+		}
+		dlg.cancelFunc()
+		return
+	}
+}
+
 func (dlg *dnsLoaderGen) prepareStop() {
 	log.Printf("prepare to stop load test")
 	atomic.StoreUint32(&dlg.status, StatusStopping)
 	app := GetGlobalAppController()
 	app.SetCurrentJobStatus(StatusStopping)
+	// the queries are sent until now, the achieved qps is not counted
+	// with the time waiting the last responses
+	sendingTime := time.Since(dlg.startTime)
 	time.Sleep(2 * time.Second)
 	log.Infoln("doing calculation work")
 	runningTime := time.Since(dlg.startTime)
@@ -163,20 +252,131 @@ func (dlg *dnsLoaderGen) prepareStop() {
 		log.WithFields(log.Fields{"result": true}).Infof("status %s:%d [%.2f]", k, v, float64(v*100)/float64(dlg.CallCount()))
 	}
 
+	var sources, targets []GroupResult
+	if app.JobConfig.SourceIPs != "" {
+		sources = dlg.groupResults("source", func(conn *ClientConn) string { return conn.Source })
+	}
+	if len(dlg.caller.(*DNSClient).targets.groups) > 1 {
+		targets = dlg.groupResults("target", func(conn *ClientConn) string { return conn.target() })
+	}
+	if app.JobConfig.EphemeralQueries > 0 {
+		var opened uint64
+		for _, conn := range dlg.caller.(*DNSClient).Conn {
+			if ephemeral, ok := conn.current().(*ephemeralConn); ok {
+				opened += ephemeral.Opened()
+			}
+		}
+		log.WithFields(log.Fields{"result": true}).Infof("ephemeral sockets opened:%d", opened)
+	}
+
 	var unknown uint64
 	if managerCounter > globalCounter {
 		unknown = managerCounter - globalCounter
 	}
 	log.WithFields(log.Fields{"result": true}).Infof("status unknown:%d [%.2f]", unknown, float64(unknown*100)/float64(dlg.CallCount()))
+	dnsclient := dlg.caller.(*DNSClient)
+	if dnsclient.notify != nil {
+		acks := atomic.LoadUint64(&dlg.notifyAcks)
+		log.WithFields(log.Fields{"result": true}).Infof("notify acknowledged:%d [%.2f] zones:%d", acks, float64(acks*100)/float64(dlg.CallCount()), dnsclient.notify.Len())
+	}
+	latency := dnsclient.breakdown.latency.Summary()
+	log.WithFields(log.Fields{"result": true}).Infof("latency min:%v mean:%v p50:%v p90:%v p99:%v max:%v",
+		latency.Min, latency.Mean, latency.P50, latency.P90, latency.P99, latency.Max)
+	dnsclient.breakdown.Report()
+	dlg.stats.Report()
+	abortReason := app.AbortReason()
+	if abortReason != "" {
+		log.WithFields(log.Fields{"result": true}).Infof("job aborted: %s", abortReason)
+	}
+	if dnsclient.fallback != nil {
+		dnsclient.fallback.Report(dlg.stats.Truncated())
+	}
+	if dnsclient.validator != nil {
+		dnsclient.validator.Report()
+	}
+	if dnsclient.tsig != nil {
+		failed := dnsclient.TSIGFailed()
+		log.WithFields(log.Fields{"result": true}).Infof("tsig verify fail:%d [%.2f]", failed, float64(failed*100)/float64(globalCounter))
+	}
+	report := &Report{
+		Job:         reportJob(app.JobConfig),
+		StartTime:   dlg.startTime,
+		RunningTime: runningTime,
+		Sent:        managerCounter,
+		Received:    globalCounter,
+		TargetQPS:   dlg.qps,
+		QPS:         float64(managerCounter) / sendingTime.Seconds(),
+		Rcodes:      globalStatusCounter,
+		Unknown:     unknown,
+		Latency:     latency,
+		Responses:   dlg.stats.Summary(),
+		Breakdown:   dnsclient.breakdown.Rows(),
+		Sources:     sources,
+		Targets:     targets,
+		AbortReason: abortReason,
+	}
+	if dnsclient.validator != nil {
+		report.Mismatches = dnsclient.validator.Mismatches()
+	}
+	evaluateJobAssertions(app.JobConfig, report)
+	app.SetReport(report)
 	atomic.StoreUint32(&dlg.status, StatusStopped)
 	app.SetCurrentJobStatus(StatusStopped)
-	dnsclient := dlg.caller.(*DNSClient)
 	for _, client := range dnsclient.Conn {
 		client.Close()
 	}
 	log.Info("stop success!")
 }
 
+// groupResults return the queries sent and the result of connections
+// grouped by the label in order of connections, the results are logged
+// with the kind of label
+func (dlg *dnsLoaderGen) groupResults(kind string, label func(conn *ClientConn) string) []GroupResult {
+	dnsclient := dlg.caller.(*DNSClient)
+	var labels []string
+	groups := make(map[string]map[uint8]uint64)
+	sent := make(map[string]uint64)
+	latency := make(map[string]*Histogram)
+	for i, conn := range dnsclient.Conn {
+		key := label(conn)
+		if _, ok := groups[key]; !ok {
+			groups[key] = make(map[uint8]uint64)
+			latency[key] = NewHistogram()
+			labels = append(labels, key)
+		}
+		sent[key] += dnsclient.Sent(i)
+		for code, count := range dlg.result[i] {
+			groups[key][code] += count
+		}
+		latency[key].Merge(dlg.latency[i])
+	}
+	var results []GroupResult
+	for _, key := range labels {
+		result := GroupResult{
+			Name:    key,
+			Sent:    sent[key],
+			Rcodes:  make(map[string]uint64),
+			Latency: latency[key].Summary(),
+		}
+		var codes []string
+		for code, count := range groups[key] {
+			result.Rcodes[dns.DNSRcodeReverse[code]] = count
+			result.Received += count
+			codes = append(codes, fmt.Sprintf("%s:%d", dns.DNSRcodeReverse[code], count))
+		}
+		sort.Strings(codes)
+		if result.Sent > result.Received {
+			result.Unknown = result.Sent - result.Received
+		}
+		codes = append(codes, fmt.Sprintf("unknown:%d", result.Unknown))
+		log.WithFields(log.Fields{"result": true}).Infof("%s %s sent:%d %s latency mean:%v p50:%v p90:%v p99:%v max:%v",
+			kind, key, result.Sent, strings.Join(codes, " "),
+			result.Latency.Mean, result.Latency.P50, result.Latency.P90, result.Latency.P99, result.Latency.Max)
+		results = append(results, result)
+	}
+	return results
+}
+
 func (dlg *dnsLoaderGen) generatorLoad(limiter ratelimit.Limiter) {
 	app := GetGlobalAppController()
 	job := app.JobConfig
@@ -187,8 +387,20 @@ func (dlg *dnsLoaderGen) generatorLoad(limiter ratelimit.Limiter) {
 			return
 		default:
 		}
-		limiter.Take()
+		if dlg.replay != nil && dlg.replay.Paced() {
+			if !dlg.replay.Wait(dlg.ctx) {
+				dlg.prepareStop()
+				return
+			}
+		} else {
+			limiter.Take()
+		}
 		rawRequest := dlg.caller.BuildReq(job)
+		if rawRequest == nil {
+			log.Infoln("all queries have been sent")
+			dlg.prepareStop()
+			return
+		}
 		dlg.caller.Call(rawRequest)
 		atomic.AddUint64(&dlg.callCount, 1)
 		if dlg.max != 0 && dlg.callCount >= dlg.max {
@@ -240,10 +452,13 @@ func NewDNSLoaderGenerator(param LoadParams) (LoadManager, error) {
 		max:            param.Max,
 		duration:       param.Duration,
 		status:         StatusStopped,
+		replay:         param.Replay,
+		stats:          NewResponseStats(),
 	}
 	for i := 0; i < param.ClientNumber; i++ {
 		r := make(map[uint8]uint64)
 		dlg.result = append(dlg.result, r)
+		dlg.latency = append(dlg.latency, NewHistogram())
 	}
 	return dlg, nil
 }
@@ -251,6 +466,12 @@ func NewDNSLoaderGenerator(param LoadParams) (LoadManager, error) {
 // GenTrafficFromConfig function will do traffic generate job
 // from configuration
 func GenTrafficFromConfig(appController *AppController) error {
+	// the report of last job must not be taken as the report of this one
+	appController.SetReport(nil)
+	appController.SetAbortReason("")
+	if appController.JobConfig.JobType == JobTypeXFR {
+		return GenTransferFromConfig(appController)
+	}
 	dnsclient, err := NewDNSClient(appController)
 	if err != nil {
 		log.Errorf("create dns client fail:%s", err)
@@ -266,9 +487,14 @@ func GenTrafficFromConfig(appController *AppController) error {
 		Timeout:      1000 * time.Millisecond,
 		QPS:          appController.QPS,
 		Max:          appController.MaxQuery,
-		ClientNumber: appController.ClientNumber,
+		ClientNumber: dnsclient.NumConn,
 		Duration:     duration,
 		Protocol:     appController.Protocol,
+		Replay:       dnsclient.replay,
+	}
+	if param.Replay != nil && param.Duration == 0 {
+		// replay the whole capture and wait the last responses
+		param.Duration = param.Replay.Duration(param.QPS) + param.Timeout
 	}
 	log.Infof("initialize load %s", param.Info())
 	gen, err := NewDNSLoaderGenerator(param)
@@ -2,8 +2,13 @@ package core
 
 import (
 	// "bytes"
+	"context"
+	"encoding/binary"
 	"math/rand"
-	"net"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 
@@ -13,29 +18,114 @@ import (
 // DNSClient hold the loader configuration setting and connection
 type DNSClient struct {
 	packet  *dns.Packet
-	Conn    []net.Conn
+	replay  *ReplaySource
+	updates *UpdateGenerator
+	notify  *NotifyGenerator
+	subnets *dns.SubnetGenerator
+	Conn    []*ClientConn
 	NumConn int
 	Offset  int
+	// rotate send the queries from the connections of target in turn
+	rotate bool
+	// targets select the target of each query, sent count the queries
+	// sent by each connection
+	targets    *targetPicker
+	sent       []uint64
+	sendErrors uint64
+	// validator check the responses when validation is enabled
+	validator *Validator
+	// fallback retry the truncated responses over tcp
+	fallback *tcpFallback
+	// breakdown count the result of queries by query type and the
+	// pattern of the last query built
+	breakdown *resultBreakdown
+	pattern   string
+
+	// cookie hold the client cookie and the server cookie learned
+	// from responses when echo mode is enabled
+	cookieLock    sync.Mutex
+	cookieEcho    bool
+	clientCookie  []byte
+	serverCookie  []byte
+	cookieUpdated bool
+
+	// tsig sign each query, the request mac is saved by query id
+	// to verify the response
+	tsig        *dns.TSIG
+	tsigBuf     []byte
+	tsigLock    sync.Mutex
+	requestMACs [65536][]byte
+	tsigFailed  uint64
 }
 
 // NewDNSClient create a new DNSClient instance
 func NewDNSClient(app *AppController) (dnsclient *DNSClient, err error) {
 	dnsclient = &DNSClient{
-		Conn:    []net.Conn{},
-		NumConn: 0,
+		Conn:      []*ClientConn{},
+		NumConn:   0,
+		breakdown: newResultBreakdown(),
 	}
 
-	clientNumber := app.JobConfig.ClientNumber
-	protocal := app.JobConfig.Protocol
-	for i := 0; i < clientNumber; i++ {
-		conn, err := net.Dial(protocal, app.Server+":"+app.Port)
+	targets, weights, err := app.JobConfig.ResolveAddresses()
+	if err != nil {
+		return nil, err
+	}
+	log.Infof("dns targets: %s", app.JobConfig.ResolvedTargets)
+	dnsclient.Conn, err = dialSources(app.JobConfig, targets)
+	if err != nil {
+		return nil, err
+	}
+	dnsclient.NumConn = len(dnsclient.Conn)
+	dnsclient.sent = make([]uint64, dnsclient.NumConn)
+	dnsclient.rotate = app.JobConfig.SourcePolicy == SourcePolicyQuery
+	dnsclient.targets = newTargetPicker(app.JobConfig.TargetPolicy, newTargetGroups(dnsclient.Conn, weights))
+	if app.JobConfig.Protocol == "tcp" {
+		dnsclient.Offset = 2
+	}
+	log.Println("new dns loader client success")
+	dnsclient.tsig, err = app.JobConfig.NewTSIG()
+	if err != nil {
+		return nil, err
+	}
+	// the signed query keep the length prefix of tcp at the head
+	dnsclient.tsigBuf = make([]byte, dnsclient.Offset, 512)
+	if app.JobConfig.useValidation() {
+		dnsclient.validator, err = NewValidatorFromJob(app.JobConfig)
 		if err != nil {
 			return nil, err
 		}
-		dnsclient.Conn = append(dnsclient.Conn, conn)
 	}
-	dnsclient.NumConn = clientNumber
-	log.Println("new dns loader client success")
+	if app.JobConfig.TCPFallback == "true" && app.JobConfig.Protocol != "tcp" {
+		dnsclient.fallback = newTCPFallback(dnsclient.HandleResponse)
+		if dnsclient.validator != nil {
+			dnsclient.validator.fallback = true
+		}
+	}
+	switch app.JobConfig.JobType {
+	case JobTypeReplay:
+		dnsclient.replay, err = NewReplaySourceFromJob(app.JobConfig)
+		if err != nil {
+			return nil, err
+		}
+		dnsclient.pattern = "replay capture"
+		if app.JobConfig.ReplayFile != "" {
+			dnsclient.pattern = "replay " + filepath.Base(app.JobConfig.ReplayFile)
+		}
+		return dnsclient, nil
+	case JobTypeUpdate:
+		dnsclient.updates, err = NewUpdateGeneratorFromJob(app.JobConfig)
+		if err != nil {
+			return nil, err
+		}
+		return dnsclient, nil
+	case JobTypeNotify:
+		dnsclient.notify, err = NewNotifyGeneratorFromJob(app.JobConfig)
+		if err != nil {
+			return nil, err
+		}
+		dnsclient.pattern = "notify"
+		return dnsclient, nil
+	}
 	err = dnsclient.InitPacket(app.JobConfig)
 	if err != nil {
 		return nil, err
@@ -45,16 +135,14 @@ func NewDNSClient(app *AppController) (dnsclient *DNSClient, err error) {
 
 // InitPacket init a packet for dns query data
 func (client *DNSClient) InitPacket(job *JobConfig) error {
-	enableEDNS := false
-	enableDNSSEC := false
-	if job.EnableEDNS == "true" {
-		enableEDNS = true
-	}
-	if job.EnableDNSSEC == "true" {
-		enableDNSSEC = true
+	edns, err := client.initEDNS(job)
+	if err != nil {
+		log.Errorf("init packet fail: %s", err.Error())
+		return err
 	}
 
 	client.packet = new(dns.Packet)
+	client.pattern = queryPattern(job)
 	client.Offset = 0
 	if job.Protocol == "tcp" {
 		client.Offset = 2
@@ -70,8 +158,7 @@ func (client *DNSClient) InitPacket(job *JobConfig) error {
 			job.Domain,
 			job.DomainRandomLength,
 			queryTypeCode,
-			enableEDNS,
-			enableDNSSEC,
+			edns,
 		)
 		return nil
 	}
@@ -81,29 +168,245 @@ func (client *DNSClient) InitPacket(job *JobConfig) error {
 		job.Domain,
 		job.DomainRandomLength,
 		dns.TypeA,
-		enableEDNS,
-		enableDNSSEC,
+		edns,
 	)
 	client.packet.RandomType = true
 
 	return nil
 }
 
+// initEDNS return the EDNS setting of the job, nil when EDNS0 is not used
+func (client *DNSClient) initEDNS(job *JobConfig) (*dns.EDNS, error) {
+	if job.ECSSubnet != "" {
+		subnets, err := dns.NewSubnetGenerator(job.ECSSubnet, job.ECSMode == ECSModeRandom, job.ECSPrefixLength)
+		if err != nil {
+			return nil, err
+		}
+		client.subnets = subnets
+	}
+	if job.EnableEDNS != "true" && job.EnableDNSSEC != "true" && client.subnets == nil && !job.useEDNSOptions() {
+		return nil, nil
+	}
+	edns := &dns.EDNS{
+		UDPSize:   dns.DefaultUDPSize,
+		Version:   uint8(job.EDNSVersion),
+		DO:        job.EnableDNSSEC == "true",
+		NSID:      job.EDNSNSID == "true",
+		KeepAlive: job.EDNSKeepalive == "true",
+		Padding:   job.EDNSPadding,
+	}
+	if job.EDNSUDPSize > 0 {
+		edns.UDPSize = uint16(job.EDNSUDPSize)
+	}
+	if client.subnets != nil {
+		edns.Subnet = client.subnets.Next()
+	}
+	if job.EDNSCookie == EDNSCookieClient || job.EDNSCookie == EDNSCookieEcho {
+		client.clientCookie = dns.NewClientCookie()
+		client.cookieEcho = job.EDNSCookie == EDNSCookieEcho
+		edns.Cookie = client.clientCookie
+	}
+	return edns, nil
+}
+
+// HandleResponse will be called for each response received, it verify the
+// TSIG record when TSIG is enabled, and in cookie echo mode it learn the
+// server cookie which will be sent in following queries
+func (client *DNSClient) HandleResponse(msg []byte) {
+	if client.validator != nil {
+		client.validator.Check(msg)
+	}
+	if client.tsig != nil {
+		client.verify(msg)
+	}
+	if !client.cookieEcho {
+		return
+	}
+	server := dns.ServerCookie(msg, client.clientCookie)
+	if server == nil {
+		return
+	}
+	client.cookieLock.Lock()
+	if !dns.ByteSliceCompare(server, client.serverCookie) {
+		client.serverCookie = server
+		client.cookieUpdated = true
+	}
+	client.cookieLock.Unlock()
+}
+
+// updateCookie put the latest server cookie into the query
+func (client *DNSClient) updateCookie() bool {
+	client.cookieLock.Lock()
+	defer client.cookieLock.Unlock()
+	if !client.cookieUpdated {
+		return false
+	}
+	client.cookieUpdated = false
+	cookie := make([]byte, 0, len(client.clientCookie)+len(client.serverCookie))
+	cookie = append(cookie, client.clientCookie...)
+	client.packet.EDNS.Cookie = append(cookie, client.serverCookie...)
+	return true
+}
+
 // BuildReq build new dns request for use later
+// and return nil when there is no more query to send
 func (client *DNSClient) BuildReq(job *JobConfig) []byte {
+	if client.replay != nil {
+		return client.sign(client.track(client.replay.Next()))
+	}
+	if client.updates != nil {
+		req := client.updates.Next()
+		client.pattern = "update " + client.updates.Action()
+		return client.sign(client.track(req))
+	}
+	if client.notify != nil {
+		return client.sign(client.track(client.notify.Next()))
+	}
 	randomDomain := dns.GenRandomDomain(job.DomainRandomLength, job.Domain)
 	if _, err := client.packet.UpdateSubDomainToBytes(randomDomain, client.Offset); err != nil {
 		log.Printf("%v\n", err)
 	}
-	return client.packet.RawByte
+	updated := client.cookieEcho && client.updateCookie()
+	if client.subnets != nil && client.subnets.Random() {
+		client.packet.EDNS.Subnet = client.subnets.Next()
+		updated = true
+	}
+	if updated {
+		if _, err := client.packet.UpdateEDNSToBytes(client.Offset); err != nil {
+			log.Printf("%v\n", err)
+		}
+	}
+	return client.sign(client.track(client.packet.RawByte))
+}
+
+// queryPattern return the name pattern of the queries, the random labels
+// are shown as *
+func queryPattern(job *JobConfig) string {
+	if job.DomainRandomLength > 0 {
+		return "*." + dns.FqdnFormat(job.Domain)
+	}
+	return dns.FqdnFormat(job.Domain)
+}
+
+// track set the sequential id of query when validation is enabled
+func (client *DNSClient) track(req []byte) []byte {
+	if client.validator != nil && req != nil {
+		client.validator.Track(req[client.Offset:])
+	}
+	return req
+}
+
+// sign add the TSIG record to the query when TSIG is enabled
+func (client *DNSClient) sign(req []byte) []byte {
+	if client.tsig == nil || req == nil {
+		return req
+	}
+	offset := client.Offset
+	buf, mac := client.tsig.Sign(client.tsigBuf[:offset], req[offset:], nil, time.Now())
+	if offset != 0 {
+		binary.BigEndian.PutUint16(buf, uint16(len(buf)-offset))
+	}
+	client.tsigBuf = buf
+	id := binary.BigEndian.Uint16(req[offset:])
+	client.tsigLock.Lock()
+	client.requestMACs[id] = append(client.requestMACs[id][:0], mac...)
+	client.tsigLock.Unlock()
+	return buf
+}
+
+// verify check the TSIG record of the response
+func (client *DNSClient) verify(msg []byte) {
+	if len(msg) < 2 {
+		return
+	}
+	id := binary.BigEndian.Uint16(msg)
+	client.tsigLock.Lock()
+	requestMAC := append([]byte{}, client.requestMACs[id]...)
+	client.tsigLock.Unlock()
+	if err := client.tsig.Verify(msg, requestMAC, time.Now()); err != nil {
+		log.Debugf("tsig verify fail: %v", err)
+		atomic.AddUint64(&client.tsigFailed, 1)
+	}
+}
+
+// Reresolve resolve the targets of job every interval until the context
+// is done, the connections of a target are moved to the new address when
+// its address changed. The number of targets and their weights are fixed
+// at job start, when the number of addresses changed the targets use the
+// new addresses in turn
+func (client *DNSClient) Reresolve(ctx context.Context, job *JobConfig, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		addresses, _, err := resolveJobTargets(job)
+		if err == nil {
+			// the new addresses must be allowed by the safety policy too
+			err = GetGlobalAppController().Safety.CheckAddresses(addresses)
+		}
+		if err != nil {
+			log.Errorf("re-resolve dns targets fail: %s", err)
+			continue
+		}
+		for i, group := range client.targets.groups {
+			address := addresses[i%len(addresses)]
+			if address == group.currentAddress() {
+				continue
+			}
+			log.Infof("dns target %s changed to %s", group.currentAddress(), address)
+			for _, n := range group.conns {
+				conn := client.Conn[n]
+				next, err := conn.redial(address)
+				if err != nil {
+					log.Errorf("connect to new target %s fail: %s", address, err)
+					continue
+				}
+				conn.moveTo(next.Conn, address)
+			}
+			group.address.Store(address)
+		}
+	}
+}
+
+// Sent return the number of queries sent by the connection
+func (client *DNSClient) Sent(conn int) uint64 {
+	return atomic.LoadUint64(&client.sent[conn])
+}
+
+// SendErrors return the number of queries fail to send
+func (client *DNSClient) SendErrors() uint64 {
+	return atomic.LoadUint64(&client.sendErrors)
+}
+
+// TSIGFailed return the number of responses fail to pass the TSIG
+// verification
+func (client *DNSClient) TSIGFailed() uint64 {
+	return atomic.LoadUint64(&client.tsigFailed)
 }
 
 // Call func will be called by schedual each time
 func (client *DNSClient) Call(req []byte) {
-	n := rand.Intn(client.NumConn)
+	target := client.targets.pick(req[client.Offset:])
+	n := target.conns[0]
+	if client.rotate {
+		n = target.conns[target.next]
+		target.next = (target.next + 1) % len(target.conns)
+	} else if len(target.conns) > 1 {
+		n = target.conns[rand.Intn(len(target.conns))]
+	}
+	atomic.AddUint64(&client.sent[n], 1)
+	client.breakdown.Sent(client.pattern, req[client.Offset:])
+	if client.fallback != nil {
+		client.fallback.Sent(req)
+	}
 
 	_, err := client.Conn[n].Write(req)
 	if err != nil {
+		atomic.AddUint64(&client.sendErrors, 1)
 		log.Printf("send dns query Failed:%s", err)
 		return
 	}
@@ -0,0 +1,55 @@
+package core
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/zhangmingkai4315/dns-loader/dns"
+)
+
+func TestDNSClientTSIG(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	OK(t, err)
+	defer listener.Close()
+
+	for _, protocol := range []string{"udp", "tcp"} {
+		job := NewDefaultJobConfig()
+		job.Protocol = protocol
+		job.Domain = "example.com"
+		job.Server, job.Port, _ = net.SplitHostPort(listener.Addr().String())
+		job.TSIGKeyName = "update-key"
+		job.TSIGSecret = "c2VjcmV0LWtleS1mb3ItdGVzdA=="
+		client, err := NewDNSClient(&AppController{JobConfig: job})
+		OK(t, err)
+
+		packet := new(dns.Packet)
+		packet.Protocol = protocol
+		packet.SetQuestion("www.example.com.", dns.TypeA)
+		query, err := packet.ToBytes()
+		OK(t, err)
+		// sign twice to reuse the buffer of last query
+		for i := 0; i < 2; i++ {
+			signed := client.sign(query)
+			msg := signed[client.Offset:]
+			if protocol == "tcp" {
+				Equals(t, len(msg), int(binary.BigEndian.Uint16(signed)))
+			}
+			message, err := dns.ParseMessage(msg)
+			OK(t, err)
+			Equals(t, dns.TypeTSIG, message.Additional[len(message.Additional)-1].Type)
+
+			tsig, err := job.NewTSIG()
+			OK(t, err)
+			response := append([]byte{}, query[client.Offset:]...)
+			response[2] |= 0x80
+			signedResponse, _ := tsig.Sign(nil, response, client.requestMACs[binary.BigEndian.Uint16(response)], time.Now())
+			client.verify(signedResponse)
+			Equals(t, uint64(0), client.tsigFailed)
+		}
+		for _, conn := range client.Conn {
+			conn.Close()
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package core
+
+import (
+	"io"
+	"math/rand"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ephemeralTimeout is the time to wait for responses after the last
+// query of a socket has been sent
+const ephemeralTimeout = 2 * time.Second
+
+// ephemeralSocket is one socket of ephemeralConn, it is closed when all
+// responses are received after retired or the timeout reached
+type ephemeralSocket struct {
+	*net.UDPConn
+	sent     int32
+	received int32
+	retired  int32
+}
+
+// ephemeralConn open a new udp socket with a random source port every
+// perSocket queries, the responses from all sockets are read by Read.
+// The number of open sockets is limited by the budget, when all the
+// budget is used Write will wait for a socket to be closed
+type ephemeralConn struct {
+	source    net.IP
+	target    *net.UDPAddr
+	perSocket int32
+	current   *ephemeralSocket
+	slots     chan struct{}
+	responses chan []byte
+	done      chan struct{}
+	closeOnce sync.Once
+	lock      sync.Mutex
+	open      map[*ephemeralSocket]struct{}
+	opened    uint64
+}
+
+func newEphemeralConn(source net.IP, target string, perSocket, budget int) (*ephemeralConn, error) {
+	targetAddr, err := net.ResolveUDPAddr("udp", target)
+	if err != nil {
+		return nil, err
+	}
+	if perSocket <= 0 {
+		perSocket = 1
+	}
+	if budget <= 0 {
+		budget = 1
+	}
+	return &ephemeralConn{
+		source:    source,
+		target:    targetAddr,
+		perSocket: int32(perSocket),
+		slots:     make(chan struct{}, budget),
+		responses: make(chan []byte, 1024),
+		done:      make(chan struct{}),
+		open:      make(map[*ephemeralSocket]struct{}),
+	}, nil
+}
+
+// dial open a socket with a random port, the port chosen by system is
+// used when the random ports are not available
+func (conn *ephemeralConn) dial() (*net.UDPConn, error) {
+	var err error
+	for i := 0; i < 5; i++ {
+		port := 1024 + rand.Intn(65535-1024)
+		var socket *net.UDPConn
+		socket, err = net.DialUDP("udp", &net.UDPAddr{IP: conn.source, Port: port}, conn.target)
+		if err == nil {
+			return socket, nil
+		}
+	}
+	return net.DialUDP("udp", &net.UDPAddr{IP: conn.source}, conn.target)
+}
+
+func (conn *ephemeralConn) Write(b []byte) (int, error) {
+	if conn.current == nil {
+		select {
+		case conn.slots <- struct{}{}:
+		case <-conn.done:
+			return 0, io.ErrClosedPipe
+		}
+		udpConn, err := conn.dial()
+		if err != nil {
+			<-conn.slots
+			return 0, err
+		}
+		socket := &ephemeralSocket{UDPConn: udpConn}
+		conn.lock.Lock()
+		conn.open[socket] = struct{}{}
+		conn.lock.Unlock()
+		atomic.AddUint64(&conn.opened, 1)
+		conn.current = socket
+		go conn.read(socket)
+	}
+	socket := conn.current
+	sent := atomic.AddInt32(&socket.sent, 1)
+	n, err := socket.Write(b)
+	if sent >= conn.perSocket {
+		conn.retire(socket)
+		conn.current = nil
+	}
+	return n, err
+}
+
+// retire let the socket wait the last responses and then close
+func (conn *ephemeralConn) retire(socket *ephemeralSocket) {
+	if socket == nil {
+		return
+	}
+	atomic.StoreInt32(&socket.retired, 1)
+	if atomic.LoadInt32(&socket.received) >= atomic.LoadInt32(&socket.sent) {
+		socket.SetReadDeadline(time.Now())
+		return
+	}
+	socket.SetReadDeadline(time.Now().Add(ephemeralTimeout))
+}
+
+func (conn *ephemeralConn) read(socket *ephemeralSocket) {
+	defer func() {
+		conn.lock.Lock()
+		delete(conn.open, socket)
+		conn.lock.Unlock()
+		socket.Close()
+		<-conn.slots
+	}()
+	buf := make([]byte, 65535)
+	for {
+		n, err := socket.Read(buf)
+		if err != nil {
+			return
+		}
+		msg := make([]byte, n)
+		copy(msg, buf[:n])
+		select {
+		case conn.responses <- msg:
+		case <-conn.done:
+			return
+		}
+		received := atomic.AddInt32(&socket.received, 1)
+		if atomic.LoadInt32(&socket.retired) == 1 && received >= atomic.LoadInt32(&socket.sent) {
+			return
+		}
+	}
+}
+
+func (conn *ephemeralConn) Read(b []byte) (int, error) {
+	select {
+	case msg := <-conn.responses:
+		return copy(b, msg), nil
+	case <-conn.done:
+		return 0, io.EOF
+	}
+}
+
+func (conn *ephemeralConn) Close() error {
+	conn.closeOnce.Do(func() {
+		close(conn.done)
+		conn.lock.Lock()
+		for socket := range conn.open {
+			socket.SetReadDeadline(time.Now())
+		}
+		conn.lock.Unlock()
+	})
+	return nil
+}
+
+// Opened return the number of sockets opened
+func (conn *ephemeralConn) Opened() uint64 {
+	return atomic.LoadUint64(&conn.opened)
+}
+
+func (conn *ephemeralConn) LocalAddr() net.Addr {
+	return &net.UDPAddr{IP: conn.source}
+}
+
+func (conn *ephemeralConn) RemoteAddr() net.Addr {
+	return conn.target
+}
+
+func (conn *ephemeralConn) SetDeadline(t time.Time) error {
+	return nil
+}
+
+func (conn *ephemeralConn) SetReadDeadline(t time.Time) error {
+	return nil
+}
+
+func (conn *ephemeralConn) SetWriteDeadline(t time.Time) error {
+	return nil
+}
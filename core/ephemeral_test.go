@@ -0,0 +1,37 @@
+package core
+
+import (
+	"net"
+	"testing"
+)
+
+func TestEphemeralConn(t *testing.T) {
+	server, err := net.ListenPacket("udp", "127.0.0.1:0")
+	OK(t, err)
+	defer server.Close()
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := server.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			server.WriteTo(buf[:n], addr)
+		}
+	}()
+
+	conn, err := newEphemeralConn(nil, server.LocalAddr().String(), 2, 2)
+	OK(t, err)
+	defer conn.Close()
+	buf := make([]byte, 512)
+	for i := 0; i < 10; i++ {
+		_, err := conn.Write([]byte("query"))
+		OK(t, err)
+		n, err := conn.Read(buf)
+		OK(t, err)
+		Equals(t, "query", string(buf[:n]))
+	}
+	// a new socket for every two queries
+	Equals(t, uint64(5), conn.Opened())
+	Assert(t, len(conn.slots) <= 2, "expect the sockets within budget, got %d", len(conn.slots))
+}
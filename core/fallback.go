@@ -0,0 +1,182 @@
+package core
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/zhangmingkai4315/dns-loader/dns"
+)
+
+const (
+	// tcpFallbackWorkers is the number of concurrent tcp retries
+	tcpFallbackWorkers = 64
+	// tcpFallbackQueue is the number of truncated responses waiting
+	// for retry, the responses are dropped when the queue is full
+	tcpFallbackQueue = 4096
+	// tcpFallbackTimeout is the timeout of each tcp retry
+	tcpFallbackTimeout = 5 * time.Second
+)
+
+// fallbackRequest is a query to retry over tcp
+type fallbackRequest struct {
+	query  []byte
+	source net.IP
+	target string
+}
+
+// tcpFallback retry the queries of truncated udp responses over a new tcp
+// connection like a stub resolver, the result and the added latency of
+// the retries are counted separately
+type tcpFallback struct {
+	lock      sync.Mutex
+	queries   [65536][]byte
+	requests  chan fallbackRequest
+	handle    func(msg []byte)
+	succeeded uint64
+	failed    uint64
+	dropped   uint64
+	rcodeLock sync.Mutex
+	rcodes    map[uint8]uint64
+	latency   *Histogram
+}
+
+// newTCPFallback create the tcp fallback, handle is called with each
+// tcp response
+func newTCPFallback(handle func(msg []byte)) *tcpFallback {
+	return &tcpFallback{
+		requests: make(chan fallbackRequest, tcpFallbackQueue),
+		handle:   handle,
+		rcodes:   make(map[uint8]uint64),
+		latency:  NewHistogram(),
+	}
+}
+
+// Sent save the query to retry it when the response is truncated
+func (fallback *tcpFallback) Sent(req []byte) {
+	if len(req) < 2 {
+		return
+	}
+	id := binary.BigEndian.Uint16(req)
+	fallback.lock.Lock()
+	fallback.queries[id] = append(fallback.queries[id][:0], req...)
+	fallback.lock.Unlock()
+}
+
+// Retry queue the query of the truncated response from the connection
+func (fallback *tcpFallback) Retry(conn *ClientConn, msg []byte) {
+	id := binary.BigEndian.Uint16(msg)
+	fallback.lock.Lock()
+	query := append([]byte{}, fallback.queries[id]...)
+	fallback.lock.Unlock()
+	if len(query) == 0 {
+		atomic.AddUint64(&fallback.failed, 1)
+		return
+	}
+	current := conn.current()
+	request := fallbackRequest{query: query, target: current.RemoteAddr().String()}
+	if addr, ok := current.LocalAddr().(*net.UDPAddr); ok && !addr.IP.IsUnspecified() {
+		request.source = addr.IP
+	}
+	select {
+	case fallback.requests <- request:
+	default:
+		atomic.AddUint64(&fallback.dropped, 1)
+	}
+}
+
+// Run start the workers of retry until the context is done
+func (fallback *tcpFallback) Run(ctx context.Context) {
+	for i := 0; i < tcpFallbackWorkers; i++ {
+		go func() {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case request := <-fallback.requests:
+					fallback.retry(request)
+				}
+			}
+		}()
+	}
+}
+
+func (fallback *tcpFallback) retry(request fallbackRequest) {
+	start := time.Now()
+	msg, err := fallback.exchange(request)
+	if err != nil {
+		log.Debugf("tcp fallback to %s fail: %v", request.target, err)
+		atomic.AddUint64(&fallback.failed, 1)
+		return
+	}
+	fallback.latency.Record(time.Since(start))
+	atomic.AddUint64(&fallback.succeeded, 1)
+	fallback.rcodeLock.Lock()
+	fallback.rcodes[msg[3]&0x0f]++
+	fallback.rcodeLock.Unlock()
+	fallback.handle(msg)
+}
+
+// exchange send the query over a new tcp connection and read the response
+func (fallback *tcpFallback) exchange(request fallbackRequest) ([]byte, error) {
+	dialer := net.Dialer{Timeout: tcpFallbackTimeout}
+	if request.source != nil {
+		dialer.LocalAddr = &net.TCPAddr{IP: request.source}
+	}
+	conn, err := dialer.Dial("tcp", request.target)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(tcpFallbackTimeout))
+	query := make([]byte, 2, len(request.query)+2)
+	binary.BigEndian.PutUint16(query, uint16(len(request.query)))
+	if _, err := conn.Write(append(query, request.query...)); err != nil {
+		return nil, err
+	}
+	reader := bufio.NewReader(conn)
+	length := make([]byte, 2)
+	if _, err := io.ReadFull(reader, length); err != nil {
+		return nil, err
+	}
+	msg := make([]byte, binary.BigEndian.Uint16(length))
+	if _, err := io.ReadFull(reader, msg); err != nil {
+		return nil, err
+	}
+	if len(msg) < 4 || binary.BigEndian.Uint16(msg) != binary.BigEndian.Uint16(request.query) {
+		return nil, errors.New("tcp response id not match the query")
+	}
+	return msg, nil
+}
+
+// Report log the result of retries
+func (fallback *tcpFallback) Report(truncated uint64) {
+	result := log.WithFields(log.Fields{"result": true})
+	succeeded := atomic.LoadUint64(&fallback.succeeded)
+	result.Infof("tcp fallback success:%d failed:%d dropped:%d [%.2f]", succeeded,
+		atomic.LoadUint64(&fallback.failed), atomic.LoadUint64(&fallback.dropped), float64(succeeded*100)/float64(truncated))
+	fallback.rcodeLock.Lock()
+	var rcodes []string
+	for code, count := range fallback.rcodes {
+		rcodes = append(rcodes, fmt.Sprintf("%s:%d", dns.DNSRcodeReverse[code], count))
+	}
+	fallback.rcodeLock.Unlock()
+	sort.Strings(rcodes)
+	if len(rcodes) > 0 {
+		result.Infof("tcp fallback status %s", strings.Join(rcodes, " "))
+	}
+	summary := fallback.latency.Summary()
+	result.Infof("tcp fallback latency min:%v mean:%v p50:%v p90:%v p99:%v max:%v",
+		summary.Min, summary.Mean, summary.P50, summary.P90, summary.P99, summary.Max)
+}
@@ -0,0 +1,69 @@
+package core
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/zhangmingkai4315/dns-loader/dns"
+)
+
+// serveTestTCP answer each tcp query with the query itself as response
+func serveTestTCP(listener net.Listener) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		length := make([]byte, 2)
+		if _, err := io.ReadFull(conn, length); err == nil {
+			msg := make([]byte, binary.BigEndian.Uint16(length))
+			if _, err := io.ReadFull(conn, msg); err == nil {
+				msg[2] |= 0x80
+				conn.Write(append(length, msg...))
+			}
+		}
+		conn.Close()
+	}
+}
+
+func TestTCPFallback(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	OK(t, err)
+	defer listener.Close()
+	go serveTestTCP(listener)
+	udpConn, err := dialFrom("udp", nil, listener.Addr().String())
+	OK(t, err)
+	defer udpConn.Close()
+
+	var responses int32
+	fallback := newTCPFallback(func(msg []byte) { atomic.AddInt32(&responses, 1) })
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fallback.Run(ctx)
+
+	packet := new(dns.Packet)
+	packet.SetQuestion("www.example.com.", dns.TypeDNSKEY)
+	query, err := packet.ToBytes()
+	OK(t, err)
+	fallback.Sent(query)
+	truncated := append([]byte{}, query...)
+	truncated[2] |= 0x82
+	fallback.Retry(udpConn, truncated)
+	// response of unknown query
+	binary.BigEndian.PutUint16(truncated, binary.BigEndian.Uint16(query)+1)
+	fallback.Retry(udpConn, truncated)
+
+	for i := 0; i < 100 && atomic.LoadInt32(&responses) == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	Equals(t, int32(1), atomic.LoadInt32(&responses))
+	Equals(t, uint64(1), atomic.LoadUint64(&fallback.succeeded))
+	Equals(t, uint64(1), atomic.LoadUint64(&fallback.failed))
+	Equals(t, uint64(1), fallback.rcodes[dns.RcodeSuccess])
+	Equals(t, uint64(1), fallback.latency.Count())
+}
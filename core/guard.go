@@ -0,0 +1,111 @@
+package core
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// abortGuard stop the job when the server degrade, the rates of each
+// second are compared with the thresholds of job and the job is aborted
+// when a rate exceed its threshold for the consecutive seconds
+type abortGuard struct {
+	timeoutRatio  float64
+	servfailRatio float64
+	errorRatio    float64
+	seconds       int
+	responses     uint64
+	servfail      uint64
+	// counters of last check and the number of consecutive seconds
+	// each rate exceeded its threshold
+	lastSent      uint64
+	lastResponses uint64
+	lastServfail  uint64
+	lastErrors    uint64
+	exceeded      map[string]int
+}
+
+// newAbortGuard create the guard of job, nil when no threshold is set
+func newAbortGuard(job *JobConfig) *abortGuard {
+	if job.AbortTimeoutRatio <= 0 && job.AbortServfailRatio <= 0 && job.AbortErrorRatio <= 0 {
+		return nil
+	}
+	guard := &abortGuard{
+		timeoutRatio:  job.AbortTimeoutRatio,
+		servfailRatio: job.AbortServfailRatio,
+		errorRatio:    job.AbortErrorRatio,
+		seconds:       job.AbortSeconds,
+		exceeded:      make(map[string]int),
+	}
+	if guard.seconds <= 0 {
+		guard.seconds = DefaultAbortSeconds
+	}
+	return guard
+}
+
+// SetAbortReason save the reason the current job is aborted
+func (config *AppController) SetAbortReason(reason string) {
+	config.Lock()
+	defer config.Unlock()
+	config.abortReason = reason
+}
+
+// AbortReason return the reason the current job is aborted, empty when
+// the job is not aborted
+func (config *AppController) AbortReason() string {
+	config.RLock()
+	defer config.RUnlock()
+	return config.abortReason
+}
+
+// Received count the response
+func (guard *abortGuard) Received(msg []byte) {
+	atomic.AddUint64(&guard.responses, 1)
+	if msg[3]&0x0f == 2 {
+		atomic.AddUint64(&guard.servfail, 1)
+	}
+}
+
+// Check compare the rates since last check with the thresholds, it
+// return the reason to abort the job or empty string. The queries sent
+// but not answered in the second are counted as timeout, the counters
+// of all rates are updated before the first exceeded rate is returned
+func (guard *abortGuard) Check(sent, errors uint64) string {
+	responses := atomic.LoadUint64(&guard.responses)
+	servfail := atomic.LoadUint64(&guard.servfail)
+	sentDelta := sent - guard.lastSent
+	responsesDelta := responses - guard.lastResponses
+	servfailDelta := servfail - guard.lastServfail
+	errorsDelta := errors - guard.lastErrors
+	guard.lastSent, guard.lastResponses, guard.lastServfail, guard.lastErrors = sent, responses, servfail, errors
+	if sentDelta == 0 {
+		return ""
+	}
+	var timeout float64
+	if sentDelta > responsesDelta {
+		timeout = float64((sentDelta-responsesDelta)*100) / float64(sentDelta)
+	}
+	var servfailRatio float64
+	if responsesDelta > 0 {
+		servfailRatio = float64(servfailDelta*100) / float64(responsesDelta)
+	}
+	var reason string
+	for _, rate := range []struct {
+		name      string
+		value     float64
+		threshold float64
+	}{
+		{"timeout", timeout, guard.timeoutRatio},
+		{"servfail", servfailRatio, guard.servfailRatio},
+		{"send error", float64(errorsDelta*100) / float64(sentDelta), guard.errorRatio},
+	} {
+		if rate.threshold <= 0 || rate.value <= rate.threshold {
+			guard.exceeded[rate.name] = 0
+			continue
+		}
+		guard.exceeded[rate.name]++
+		if reason == "" && guard.exceeded[rate.name] >= guard.seconds {
+			reason = fmt.Sprintf("%s ratio %.2f exceed %.2f for %d seconds", rate.name, rate.value, rate.threshold, guard.seconds)
+		}
+	}
+	return reason
+}
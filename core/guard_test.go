@@ -0,0 +1,110 @@
+package core
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestNewAbortGuard(t *testing.T) {
+	Assert(t, newAbortGuard(&JobConfig{}) == nil, "guard without threshold should be nil")
+	guard := newAbortGuard(&JobConfig{AbortTimeoutRatio: 10})
+	Assert(t, guard != nil, "guard with threshold should not be nil")
+	Equals(t, DefaultAbortSeconds, guard.seconds)
+}
+
+func TestAbortGuardCheck(t *testing.T) {
+	guard := newAbortGuard(&JobConfig{AbortTimeoutRatio: 10, AbortServfailRatio: 20, AbortSeconds: 2})
+	noerror := []byte{0, 1, 0x81, 0x80}
+	servfail := []byte{0, 1, 0x81, 0x82}
+
+	var sent uint64
+	second := func(queries int, responses ...[]byte) string {
+		sent += uint64(queries)
+		for _, msg := range responses {
+			guard.Received(msg)
+		}
+		return guard.Check(sent, 0)
+	}
+	// 50% timeout in the first second is not enough to abort
+	Equals(t, "", second(4, noerror, noerror))
+	// the ratio drop below threshold reset the counter
+	Equals(t, "", second(2, noerror, noerror))
+	Equals(t, "", second(2, noerror))
+	reason := second(2, noerror)
+	Assert(t, strings.HasPrefix(reason, "timeout ratio 50.00 "), "expect timeout abort, got %s", reason)
+
+	guard = newAbortGuard(&JobConfig{AbortServfailRatio: 20, AbortSeconds: 1})
+	sent = 0
+	Equals(t, "", second(0))
+	Equals(t, "", second(5, noerror, noerror, noerror, noerror, servfail))
+	reason = second(2, noerror, servfail)
+	Assert(t, strings.HasPrefix(reason, "servfail ratio 50.00 "), "expect servfail abort, got %s", reason)
+}
+
+func TestAbortGuardSendError(t *testing.T) {
+	guard := newAbortGuard(&JobConfig{AbortErrorRatio: 5, AbortSeconds: 1})
+	Equals(t, "", guard.Check(100, 5))
+	reason := guard.Check(200, 15)
+	Assert(t, strings.HasPrefix(reason, "send error ratio 10.00 "), "expect send error abort, got %s", reason)
+}
+
+func TestAbortGuardCheckAllRates(t *testing.T) {
+	guard := newAbortGuard(&JobConfig{AbortTimeoutRatio: 10, AbortServfailRatio: 20, AbortSeconds: 2})
+	servfail := []byte{0, 1, 0x81, 0x82}
+	guard.Received(servfail)
+	Equals(t, "", guard.Check(2, 0))
+	guard.Received(servfail)
+	reason := guard.Check(4, 0)
+	Assert(t, strings.HasPrefix(reason, "timeout ratio 50.00 "), "expect timeout abort, got %s", reason)
+	// the servfail rate is counted in the second the timeout abort
+	Equals(t, 2, guard.exceeded["servfail"])
+}
+
+func TestAgentAbortJob(t *testing.T) {
+	app := GetGlobalAppController()
+	app.JobConfig = NewDefaultJobConfig()
+	app.JobConfig.JobID = "job"
+	app.SetCurrentJobStatus(StatusRunning)
+	defer app.SetCurrentJobStatus(StatusStopped)
+	defer app.SetAbortReason("")
+
+	manager := &NodeManager{
+		NodeInfos:      make(map[string]NodeInfo),
+		nodeStatusChan: make(chan NodeInfo, 1),
+	}
+	var stopped int32
+	var agents []Agent
+	for _, reason := range []string{"timeout ratio 50.00 exceed 10.00 for 2 seconds", ""} {
+		reason := reason
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if req.URL.Path == "/stop" {
+				atomic.AddInt32(&stopped, 1)
+			}
+			w.Write([]byte(`{"id":"job","status":"running","abort_reason":"` + reason + `"}`))
+		}))
+		defer server.Close()
+		address, _ := url.Parse(server.URL)
+		agent := Agent{Enable: true, Live: true}
+		agent.IP, agent.Port, _ = net.SplitHostPort(address.Host)
+		manager.NodeInfos[agent.IPAddrWithPort()] = NodeInfo{Agent: agent}
+		agents = append(agents, agent)
+	}
+	// the agent without abort reason does not stop the job
+	OK(t, manager.callStatus(agents[1], false))
+	manager.statusUpdate(<-manager.nodeStatusChan)
+	Equals(t, int32(0), atomic.LoadInt32(&stopped))
+
+	OK(t, manager.callStatus(agents[0], false))
+	manager.statusUpdate(<-manager.nodeStatusChan)
+	Equals(t, int32(2), atomic.LoadInt32(&stopped))
+	Assert(t, strings.HasSuffix(app.AbortReason(), ": timeout ratio 50.00 exceed 10.00 for 2 seconds"), "expect abort reason of agent, got %s", app.AbortReason())
+	// the job is aborted only once
+	OK(t, manager.callStatus(agents[0], false))
+	manager.statusUpdate(<-manager.nodeStatusChan)
+	Equals(t, int32(2), atomic.LoadInt32(&stopped))
+}
@@ -0,0 +1,155 @@
+package core
+
+import (
+	"math/bits"
+	"sync"
+	"time"
+)
+
+// histogramSubBuckets is the number of linear sub buckets in each power
+// of two range, the relative error of percentiles is less than 1/16
+const histogramSubBuckets = 16
+
+// Histogram record the distribution of durations in microseconds with
+// log-linear buckets, it is safe for concurrent use
+type Histogram struct {
+	sync.Mutex
+	counts []uint64
+	count  uint64
+	sum    time.Duration
+	min    time.Duration
+	max    time.Duration
+}
+
+// NewHistogram create an empty histogram
+func NewHistogram() *Histogram {
+	return &Histogram{
+		counts: make([]uint64, 64*histogramSubBuckets),
+	}
+}
+
+func histogramBucket(us uint64) int {
+	if us < histogramSubBuckets {
+		return int(us)
+	}
+	// keep the highest 5 bits of the value
+	shift := bits.Len64(us) - 5
+	return shift*histogramSubBuckets + int(us>>uint(shift))
+}
+
+// histogramBucketValue return the upper bound of the bucket
+func histogramBucketValue(bucket int) uint64 {
+	if bucket < histogramSubBuckets {
+		return uint64(bucket)
+	}
+	shift := bucket/histogramSubBuckets - 1
+	top := uint64(bucket%histogramSubBuckets + histogramSubBuckets)
+	return (top+1)<<uint(shift) - 1
+}
+
+// Record add a duration to histogram
+func (histogram *Histogram) Record(d time.Duration) {
+	if d < 0 {
+		d = 0
+	}
+	bucket := histogramBucket(uint64(d / time.Microsecond))
+	histogram.Lock()
+	histogram.counts[bucket]++
+	if histogram.count == 0 || d < histogram.min {
+		histogram.min = d
+	}
+	if d > histogram.max {
+		histogram.max = d
+	}
+	histogram.count++
+	histogram.sum += d
+	histogram.Unlock()
+}
+
+// Merge add the durations recorded by other to histogram
+func (histogram *Histogram) Merge(other *Histogram) {
+	other.Lock()
+	counts := append([]uint64{}, other.counts...)
+	count, sum, min, max := other.count, other.sum, other.min, other.max
+	other.Unlock()
+	if count == 0 {
+		return
+	}
+	histogram.Lock()
+	defer histogram.Unlock()
+	for bucket, n := range counts {
+		histogram.counts[bucket] += n
+	}
+	if histogram.count == 0 || min < histogram.min {
+		histogram.min = min
+	}
+	if max > histogram.max {
+		histogram.max = max
+	}
+	histogram.count += count
+	histogram.sum += sum
+}
+
+// Count return the number of recorded durations
+func (histogram *Histogram) Count() uint64 {
+	histogram.Lock()
+	defer histogram.Unlock()
+	return histogram.count
+}
+
+// Percentile return the duration at percentile p (0-100)
+func (histogram *Histogram) Percentile(p float64) time.Duration {
+	histogram.Lock()
+	defer histogram.Unlock()
+	if histogram.count == 0 {
+		return 0
+	}
+	target := uint64(float64(histogram.count)*p/100 + 0.5)
+	if target == 0 {
+		target = 1
+	}
+	var total uint64
+	for bucket, count := range histogram.counts {
+		total += count
+		if total >= target {
+			d := time.Duration(histogramBucketValue(bucket)) * time.Microsecond
+			if d > histogram.max {
+				d = histogram.max
+			}
+			if d < histogram.min {
+				d = histogram.min
+			}
+			return d
+		}
+	}
+	return histogram.max
+}
+
+// Summary return the statistics of recorded durations
+func (histogram *Histogram) Summary() LatencySummary {
+	summary := LatencySummary{
+		P50: histogram.Percentile(50),
+		P90: histogram.Percentile(90),
+		P99: histogram.Percentile(99),
+	}
+	histogram.Lock()
+	defer histogram.Unlock()
+	summary.Count = histogram.count
+	summary.Min = histogram.min
+	summary.Max = histogram.max
+	if histogram.count > 0 {
+		summary.Mean = histogram.sum / time.Duration(histogram.count)
+	}
+	return summary
+}
+
+// LatencySummary hold the statistics of a histogram
+type LatencySummary struct {
+	Count uint64        `json:"count"`
+	Min   time.Duration `json:"min"`
+	Mean  time.Duration `json:"mean"`
+	P50   time.Duration `json:"p50"`
+	P90   time.Duration `json:"p90"`
+	P99   time.Duration `json:"p99"`
+	Max   time.Duration `json:"max"`
+}
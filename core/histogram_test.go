@@ -0,0 +1,42 @@
+package core
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHistogram(t *testing.T) {
+	histogram := NewHistogram()
+	Equals(t, time.Duration(0), histogram.Percentile(50))
+	for i := 1; i <= 1000; i++ {
+		histogram.Record(time.Duration(i) * time.Millisecond)
+	}
+	summary := histogram.Summary()
+	Equals(t, uint64(1000), summary.Count)
+	Equals(t, time.Millisecond, summary.Min)
+	Equals(t, time.Second, summary.Max)
+	Equals(t, 500500*time.Microsecond, summary.Mean)
+	for _, p := range []float64{50, 90, 99} {
+		expect := time.Duration(p*10) * time.Millisecond
+		got := histogram.Percentile(p)
+		Assert(t, got >= expect && got <= expect+expect/16, "percentile %v: expect about %v, got %v", p, expect, got)
+	}
+	Equals(t, time.Second, histogram.Percentile(100))
+}
+
+func TestHistogramMerge(t *testing.T) {
+	histogram := NewHistogram()
+	other := NewHistogram()
+	histogram.Merge(other)
+	Equals(t, uint64(0), histogram.Count())
+	histogram.Record(10 * time.Millisecond)
+	other.Record(time.Millisecond)
+	other.Record(30 * time.Millisecond)
+	histogram.Merge(other)
+	summary := histogram.Summary()
+	Equals(t, uint64(3), summary.Count)
+	Equals(t, time.Millisecond, summary.Min)
+	Equals(t, 30*time.Millisecond, summary.Max)
+	Equals(t, 41*time.Millisecond/3, summary.Mean)
+	Equals(t, uint64(2), other.Count())
+}
@@ -0,0 +1,87 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// jobFileSkipFields are set when the job run and not saved in job file
+var jobFileSkipFields = map[string]bool{
+	"job_id":           true,
+	"resolved_targets": true,
+	"replay_data":      true,
+}
+
+// jobFieldKinds return the kind of JobConfig fields by the json name
+func jobFieldKinds() map[string]reflect.Kind {
+	kinds := map[string]reflect.Kind{}
+	jobType := reflect.TypeOf(JobConfig{})
+	for i := 0; i < jobType.NumField(); i++ {
+		name := strings.Split(jobType.Field(i).Tag.Get("json"), ",")[0]
+		kinds[name] = jobType.Field(i).Type.Kind()
+	}
+	return kinds
+}
+
+// ParseJobYAML parse the job file in yaml format into job, the keys are
+// the same as the json of JobConfig and the fields not in file are not
+// changed, so the default values can be set before parse
+func ParseJobYAML(content []byte, job *JobConfig) error {
+	values := map[string]interface{}{}
+	if err := yaml.Unmarshal(content, &values); err != nil {
+		return fmt.Errorf("parse job file fail: %s", err)
+	}
+	kinds := jobFieldKinds()
+	for key, value := range values {
+		kind, ok := kinds[key]
+		if !ok || jobFileSkipFields[key] {
+			return fmt.Errorf("unknown job field %s", key)
+		}
+		// yaml parse 53 and true as number and bool, e.g. the port
+		if _, isString := value.(string); kind == reflect.String && value != nil && !isString {
+			values[key] = fmt.Sprint(value)
+		}
+	}
+	data, err := json.Marshal(values)
+	if err != nil {
+		return fmt.Errorf("parse job file fail: %s", err)
+	}
+	if err := json.Unmarshal(data, job); err != nil {
+		return fmt.Errorf("parse job file fail: %s", err)
+	}
+	return nil
+}
+
+// jobValues return the fields of job by the json name
+func jobValues(job *JobConfig) (map[string]interface{}, error) {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return nil, err
+	}
+	values := map[string]interface{}{}
+	err = json.Unmarshal(data, &values)
+	return values, err
+}
+
+// YAML return the job file in yaml format, the fields with the default
+// value are omitted
+func (jobConfig *JobConfig) YAML() ([]byte, error) {
+	values, err := jobValues(jobConfig)
+	if err != nil {
+		return nil, err
+	}
+	defaults, err := jobValues(NewDefaultJobConfig())
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range values {
+		if jobFileSkipFields[key] || reflect.DeepEqual(value, defaults[key]) {
+			delete(values, key)
+		}
+	}
+	return yaml.Marshal(values)
+}
@@ -0,0 +1,59 @@
+package core
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseJobYAML(t *testing.T) {
+	job := NewDefaultJobConfig()
+	content := `
+server: 192.0.2.53
+port: 5353
+duration: 60s
+qps: 1000
+client_number: 10
+domain: example.com
+query_type: A,AAAA
+edns_enable: true
+assertions: "p99 <= 20ms"
+`
+	OK(t, ParseJobYAML([]byte(content), job))
+	Equals(t, "192.0.2.53", job.Server)
+	Equals(t, "5353", job.Port)
+	Equals(t, uint32(1000), job.QPS)
+	Equals(t, 10, job.ClientNumber)
+	Equals(t, "true", job.EnableEDNS)
+	Equals(t, "p99 <= 20ms", job.Assertions)
+	// the fields not in file keep the default value
+	Equals(t, DefaultProtocol, job.Protocol)
+	Equals(t, DefaultUpdateTTL, job.UpdateTTL)
+
+	for _, content := range []string{
+		"severs: 192.0.2.53",
+		"job_id: 6ba7b810-9dad-11d1-80b4-00c04fd430c8",
+		"qps: fast",
+		"- server",
+	} {
+		Assert(t, ParseJobYAML([]byte(content), NewDefaultJobConfig()) != nil, "expect error for %s", content)
+	}
+}
+
+func TestJobYAML(t *testing.T) {
+	job := NewDefaultJobConfig()
+	job.JobID = "6ba7b810-9dad-11d1-80b4-00c04fd430c8"
+	job.Server = "192.0.2.53"
+	job.QPS = 0
+	job.Duration = "60s"
+	job.ResolvedTargets = "192.0.2.53:53"
+	content, err := job.YAML()
+	OK(t, err)
+	Equals(t, "duration: 60s\nqps: 0\nserver: 192.0.2.53\n", string(content))
+	Assert(t, !strings.Contains(string(content), "job_id"), "job id should not be saved")
+
+	parsed := NewDefaultJobConfig()
+	OK(t, ParseJobYAML(content, parsed))
+	job.JobID = ""
+	job.ResolvedTargets = ""
+	Equals(t, job, parsed)
+}
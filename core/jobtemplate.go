@@ -0,0 +1,190 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+
+	"github.com/jinzhu/gorm"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// templateNamePattern limit the template name to be used in url and file
+// name
+var templateNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// JobTemplate is a saved job with a name, each save of the name add a new
+// version and the last version is used when the version is not set
+type JobTemplate struct {
+	gorm.Model
+	Name        string    `json:"name" gorm:"unique_index:idx_template_version"`
+	Version     int       `json:"version" gorm:"unique_index:idx_template_version"`
+	Description string    `json:"description"`
+	Job         string    `json:"-" gorm:"type:text"`
+	Config      JobConfig `json:"config" gorm:"-"`
+	User        string    `json:"user"`
+}
+
+// jobTemplateFile is the template in yaml format, the job keys are the
+// same as the job file
+type jobTemplateFile struct {
+	Name        string                 `yaml:"name"`
+	Version     int                    `yaml:"version,omitempty"`
+	Description string                 `yaml:"description,omitempty"`
+	Job         map[string]interface{} `yaml:"job"`
+}
+
+// AfterFind load the job config
+func (template *JobTemplate) AfterFind() error {
+	return json.Unmarshal([]byte(template.Job), &template.Config)
+}
+
+// YAML return the template in yaml format, the tsig secret is not exported
+func (template *JobTemplate) YAML() ([]byte, error) {
+	job := template.Config
+	job.TSIGSecret = ""
+	content, err := job.YAML()
+	if err != nil {
+		return nil, err
+	}
+	file := jobTemplateFile{
+		Name:        template.Name,
+		Version:     template.Version,
+		Description: template.Description,
+	}
+	if err := yaml.Unmarshal(content, &file.Job); err != nil {
+		return nil, err
+	}
+	return yaml.Marshal(file)
+}
+
+// ParseJobTemplateYAML parse the template exported by YAML, the version in
+// file is ignored and the template get a new version when it is saved
+func ParseJobTemplateYAML(content []byte) (*JobTemplate, error) {
+	file := jobTemplateFile{}
+	if err := yaml.UnmarshalStrict(content, &file); err != nil {
+		return nil, fmt.Errorf("parse template file fail: %s", err)
+	}
+	if err := validateTemplateName(file.Name); err != nil {
+		return nil, err
+	}
+	job, err := yaml.Marshal(file.Job)
+	if err != nil {
+		return nil, fmt.Errorf("parse template file fail: %s", err)
+	}
+	template := &JobTemplate{
+		Name:        file.Name,
+		Description: file.Description,
+		Config:      *NewDefaultJobConfig(),
+	}
+	if err := ParseJobYAML(job, &template.Config); err != nil {
+		return nil, err
+	}
+	return template, nil
+}
+
+func validateTemplateName(name string) error {
+	if !templateNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid template name %q, only letters, digits, '.', '_' and '-' are allowed", name)
+	}
+	return nil
+}
+
+// SaveJobTemplate save the job as a new version of the template
+func (dbHander *DBHandler) SaveJobTemplate(name, description string, job *JobConfig, user string) (*JobTemplate, error) {
+	if err := validateTemplateName(name); err != nil {
+		return nil, err
+	}
+	content, err := encodeJob(job)
+	if err != nil {
+		return nil, err
+	}
+	template := &JobTemplate{
+		Name:        name,
+		Description: description,
+		Job:         content,
+		User:        user,
+	}
+	if err := template.AfterFind(); err != nil {
+		return nil, err
+	}
+	last := &JobTemplate{}
+	err = dbHander.Where("name = ?", name).Order("version desc").First(last).Error
+	if err != nil && !gorm.IsRecordNotFoundError(err) {
+		return nil, err
+	}
+	template.Version = last.Version + 1
+	if err := dbHander.Create(template).Error; err != nil {
+		return nil, fmt.Errorf("save template fail: %s", err)
+	}
+	return template, nil
+}
+
+// CreateJobTemplateFromHistory save the job of history as a new version of
+// the template, id is the history id or the job id
+func (dbHander *DBHandler) CreateJobTemplateFromHistory(name, description, id, user string) (*JobTemplate, error) {
+	query, err := dbHander.GetDNSQuery(id)
+	if err != nil {
+		return nil, err
+	}
+	return dbHander.SaveJobTemplate(name, description, &query.JobConfig, user)
+}
+
+// GetJobTemplates return the last version of all templates
+func (dbHander *DBHandler) GetJobTemplates() ([]JobTemplate, error) {
+	all := []JobTemplate{}
+	err := dbHander.Order("name, version desc").Find(&all).Error
+	if err != nil && !gorm.IsRecordNotFoundError(err) {
+		return nil, err
+	}
+	templates := []JobTemplate{}
+	for _, template := range all {
+		if len(templates) == 0 || templates[len(templates)-1].Name != template.Name {
+			templates = append(templates, template)
+		}
+	}
+	return templates, nil
+}
+
+// GetJobTemplate return the version of template, the last version is
+// returned when version is 0
+func (dbHander *DBHandler) GetJobTemplate(name string, version int) (*JobTemplate, error) {
+	template := &JobTemplate{}
+	db := dbHander.Where("name = ?", name)
+	if version > 0 {
+		db = db.Where("version = ?", version)
+	}
+	if err := db.Order("version desc").First(template).Error; err != nil {
+		if version > 0 {
+			return nil, fmt.Errorf("template %s version %d not exist", name, version)
+		}
+		return nil, fmt.Errorf("template %s not exist", name)
+	}
+	return template, nil
+}
+
+// GetJobTemplateVersions return all versions of template, the last
+// version first
+func (dbHander *DBHandler) GetJobTemplateVersions(name string) ([]JobTemplate, error) {
+	templates := []JobTemplate{}
+	err := dbHander.Where("name = ?", name).Order("version desc").Find(&templates).Error
+	if err != nil && !gorm.IsRecordNotFoundError(err) {
+		return nil, err
+	}
+	if len(templates) == 0 {
+		return nil, fmt.Errorf("template %s not exist", name)
+	}
+	return templates, nil
+}
+
+// DeleteJobTemplate remove all versions of template
+func (dbHander *DBHandler) DeleteJobTemplate(name string) error {
+	db := dbHander.Unscoped().Where("name = ?", name).Delete(&JobTemplate{})
+	if db.Error != nil {
+		return db.Error
+	}
+	if db.RowsAffected == 0 {
+		return fmt.Errorf("template %s not exist", name)
+	}
+	return nil
+}
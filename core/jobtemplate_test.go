@@ -0,0 +1,94 @@
+package core
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestJobTemplate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dns-loader")
+	OK(t, err)
+	defer os.RemoveAll(dir)
+	OK(t, NewDatabaseConnectionFromFile(filepath.Join(dir, "app.db")))
+	db := GetDBHandler()
+	defer db.Close()
+
+	job := NewDefaultJobConfig()
+	job.Server = "192.0.2.53"
+	job.JobID = "6ba7b810-9dad-11d1-80b4-00c04fd430c8"
+	_, err = db.SaveJobTemplate("bad name", "", job, "alice")
+	Assert(t, err != nil, "expect error for invalid name")
+	first, err := db.SaveJobTemplate("udp-1k", "1k qps over udp", job, "alice")
+	OK(t, err)
+	Equals(t, 1, first.Version)
+	Equals(t, "", first.Config.JobID)
+
+	// each save add a new version
+	job.QPS = 2000
+	second, err := db.SaveJobTemplate("udp-1k", "2k qps over udp", job, "bob")
+	OK(t, err)
+	Equals(t, 2, second.Version)
+	_, err = db.SaveJobTemplate("tcp", "", job, "bob")
+	OK(t, err)
+	templates, err := db.GetJobTemplates()
+	OK(t, err)
+	Equals(t, 2, len(templates))
+	Equals(t, "tcp", templates[0].Name)
+	Equals(t, 2, templates[1].Version)
+
+	template, err := db.GetJobTemplate("udp-1k", 0)
+	OK(t, err)
+	Equals(t, uint32(2000), template.Config.QPS)
+	template, err = db.GetJobTemplate("udp-1k", 1)
+	OK(t, err)
+	Equals(t, "1k qps over udp", template.Description)
+	_, err = db.GetJobTemplate("udp-1k", 3)
+	Assert(t, err != nil, "expect error for missing version")
+	versions, err := db.GetJobTemplateVersions("udp-1k")
+	OK(t, err)
+	Equals(t, 2, len(versions))
+
+	OK(t, db.DeleteJobTemplate("udp-1k"))
+	Assert(t, db.DeleteJobTemplate("udp-1k") != nil, "expect error for deleted template")
+	_, err = db.GetJobTemplate("udp-1k", 0)
+	Assert(t, err != nil, "expect error for deleted template")
+
+	// the new template start from version 1
+	template, err = db.SaveJobTemplate("udp-1k", "", job, "alice")
+	OK(t, err)
+	Equals(t, 1, template.Version)
+}
+
+func TestJobTemplateYAML(t *testing.T) {
+	job := NewDefaultJobConfig()
+	job.Server = "192.0.2.53"
+	job.Duration = "60s"
+	job.TSIGSecret = "c2VjcmV0"
+	template := &JobTemplate{Name: "udp-1k", Version: 3, Description: "1k qps", Config: *job}
+	content, err := template.YAML()
+	OK(t, err)
+	Assert(t, strings.HasPrefix(string(content), "name: udp-1k\nversion: 3\n"), "unexpected yaml %s", content)
+	Assert(t, !strings.Contains(string(content), "tsig_secret"), "tsig secret should not be exported")
+
+	parsed, err := ParseJobTemplateYAML(content)
+	OK(t, err)
+	Equals(t, "udp-1k", parsed.Name)
+	Equals(t, "1k qps", parsed.Description)
+	Equals(t, 0, parsed.Version)
+	Equals(t, "192.0.2.53", parsed.Config.Server)
+	Equals(t, "60s", parsed.Config.Duration)
+	Equals(t, DefaultProtocol, parsed.Config.Protocol)
+
+	for _, content := range []string{
+		"job:\n  server: 192.0.2.53",
+		"name: udp/1k",
+		"name: udp-1k\njobs:\n  server: 192.0.2.53",
+		"name: udp-1k\njob:\n  severs: 192.0.2.53",
+	} {
+		_, err := ParseJobTemplateYAML([]byte(content))
+		Assert(t, err != nil, "expect error for %s", content)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/jinzhu/gorm"
@@ -26,6 +27,8 @@ type NodeInfo struct {
 	JobID  string `json:"job_id" valid:"-"`
 	Status string `json:"status" valid:"-"`
 	Error  string `json:"error" valid:"-"`
+	// AbortReason is set when the guard of agent abort the job
+	AbortReason string `json:"abort_reason" valid:"-"`
 }
 
 var nodeManager *NodeManager
@@ -80,7 +83,26 @@ func (manager *NodeManager) statusUpdate(status NodeInfo) {
 	oldStatus.Agent.Live = status.Live
 	oldStatus.JobID = status.JobID
 	oldStatus.Status = status.Status
+	oldStatus.AbortReason = status.AbortReason
 	manager.NodeInfos[statusKey] = oldStatus
+	manager.abortJob(status)
+}
+
+// abortJob stop the running job of master on all agents when the guard
+// of an agent abort it
+func (manager *NodeManager) abortJob(status NodeInfo) {
+	app := GetGlobalAppController()
+	if status.AbortReason == "" || app.GetCurrentJobStatus() != StatusRunning ||
+		status.JobID != app.JobConfig.JobID || app.AbortReason() != "" {
+		return
+	}
+	reason := fmt.Sprintf("agent %s: %s", status.IPAddrWithPort(), status.AbortReason)
+	log.Warnf("abort the job: %s", reason)
+	app.SetAbortReason(reason)
+	manager.Call(Kill, nil)
+	if app.LoadManager != nil {
+		app.LoadManager.Stop()
+	}
 }
 
 // SyncDBForAgents sync db to current list
@@ -110,8 +132,7 @@ func (manager *NodeManager) AddNode(ip string, port string) error {
 	if err != nil {
 		return err
 	}
-	// err = GetDBHandler().AddAgent(ip, port)
-	err = manager.DB.First(&agent).Error
+	_, err = manager.findAgent(ip, port)
 	if err == nil {
 		return fmt.Errorf("%s already exist", agent.IPAddrWithPort())
 	}
@@ -121,8 +142,17 @@ func (manager *NodeManager) AddNode(ip string, port string) error {
 	// insert a new agent
 	agent.Enable = true
 	agent.Live = true
-	manager.DB.Save(&agent)
-	return nil
+	if err := manager.DB.Save(&agent).Error; err != nil {
+		return fmt.Errorf("save new agent fail: %s", err)
+	}
+	return manager.SyncDBForAgents()
+}
+
+// findAgent return the agent saved in database by ip and port
+func (manager *NodeManager) findAgent(ip string, port string) (Agent, error) {
+	agent := Agent{}
+	err := manager.DB.Where("ip = ? and port = ?", ip, port).First(&agent).Error
+	return agent, err
 }
 
 // Agents get all agents info
@@ -135,22 +165,25 @@ func (manager *NodeManager) Agents() (agents []Agent) {
 
 // RemoveNode will remove the ip from current list
 func (manager *NodeManager) RemoveNode(ip string, port string) error {
-	agent := Agent{
-		IP:   ip,
-		Port: port,
-	}
-	err := manager.DB.Unscoped().Delete(&agent).Error
+	agent, err := manager.findAgent(ip, port)
 	if err != nil {
 		if gorm.IsRecordNotFoundError(err) {
 			return errors.New("agent not in database")
 		}
 		return fmt.Errorf("delete agent fail: %s", err)
 	}
+	err = manager.DB.Unscoped().Delete(&agent).Error
+	if err != nil {
+		return fmt.Errorf("delete agent fail: %s", err)
+	}
+	delete(manager.NodeInfos, agent.IPAddrWithPort())
 	return manager.SyncDBForAgents()
 }
 
-// Call function will send data to all agents
+// Call function will send data to all agents, the agents fail to start
+// the job are returned in the error of Start event
 func (manager *NodeManager) Call(event Event, data interface{}) error {
+	var failures []string
 	for _, nodeInfo := range manager.NodeInfos {
 		agent := nodeInfo.Agent
 		if event != Status && agent.Enable == false {
@@ -163,6 +196,7 @@ func (manager *NodeManager) Call(event Event, data interface{}) error {
 			err := manager.callStart(agent, data)
 			if err != nil {
 				log.Errorf("send job infomation to agent : %s fail:%s", agent.IPAddrWithPort(), err.Error())
+				failures = append(failures, agent.IPAddrWithPort()+": "+err.Error())
 			}
 		case Kill:
 			log.Printf("send kill signal to agent :%s", agent.IPAddrWithPort())
@@ -174,6 +208,9 @@ func (manager *NodeManager) Call(event Event, data interface{}) error {
 			manager.callStatus(agent, false)
 		}
 	}
+	if len(failures) > 0 {
+		return errors.New(strings.Join(failures, "; "))
+	}
 	return nil
 }
 
@@ -192,15 +229,31 @@ func (manager *NodeManager) callStart(agent Agent, data interface{}) (err error)
 	if ok != true {
 		return errors.New("config data fail to transfer to post data")
 	}
-	log.Infof("%+v", config)
+	logConfig := config
+	if len(config.ReplayData) > 0 {
+		// give more time to ship the capture file
+		netClient.Timeout = time.Second * 60
+		logConfig.ReplayData = nil
+	}
+	if logConfig.TSIGSecret != "" {
+		logConfig.TSIGSecret = "******"
+	}
+	log.Infof("%+v", logConfig)
 	jsonData, err := json.Marshal(config)
 	if err != nil {
 		return err
 	}
 	response, err := netClient.Post(fmt.Sprintf("http://%s/start", ip), "application/json", bytes.NewBuffer(jsonData))
-	if err != nil && response.StatusCode != 200 {
+	if err != nil {
 		return err
 	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		// the agent reject the job, e.g. by its safety policy
+		infoData := &agentStatusJSONResponse{}
+		json.NewDecoder(response.Body).Decode(infoData)
+		return fmt.Errorf("agent reject the job: %s", infoData.Error)
+	}
 	return nil
 }
 
@@ -208,13 +261,13 @@ func (manager *NodeManager) callStart(agent Agent, data interface{}) (err error)
 func (manager *NodeManager) callKill(agent Agent) (err error) {
 	defer func() {
 		if r := recover(); r != nil {
-			log.Printf("panic for kill job on agent [%s]\n", agent.IP+":"+agent.Port)
+			log.Printf("panic for kill job on agent [%s]\n", agent.IPAddrWithPort())
 		}
 	}()
 	var netClient = &http.Client{
 		Timeout: time.Second * 5,
 	}
-	response, err := netClient.Get(fmt.Sprintf("http://%s/stop", agent.IP+":"+agent.Port))
+	response, err := netClient.Get(fmt.Sprintf("http://%s/stop", agent.IPAddrWithPort()))
 	if err != nil && response.StatusCode != 200 {
 		return err
 	}
@@ -223,9 +276,10 @@ func (manager *NodeManager) callKill(agent Agent) (err error) {
 
 // agentStatusJSONResponse for decode status query from other agent response
 type agentStatusJSONResponse struct {
-	ID     string `json:"id"`
-	Status string `json:"status"`
-	Error  string `json:"error"`
+	ID          string `json:"id"`
+	Status      string `json:"status"`
+	Error       string `json:"error"`
+	AbortReason string `json:"abort_reason"`
 }
 
 func (manager *NodeManager) callStatus(agent Agent, checkOnly bool) error {
@@ -234,7 +288,7 @@ func (manager *NodeManager) callStatus(agent Agent, checkOnly bool) error {
 	}
 	defer func() {
 		if r := recover(); r != nil {
-			log.Errorf("panic from agent status call[%s]\n", agent.IP+":"+agent.Port)
+			log.Errorf("panic from agent status call[%s]\n", agent.IPAddrWithPort())
 			nodeInfo.Error = fmt.Sprintf("%v", r)
 			if checkOnly == false {
 				nodeInfo.Live = false
@@ -246,7 +300,7 @@ func (manager *NodeManager) callStatus(agent Agent, checkOnly bool) error {
 		Timeout: time.Second * 1,
 	}
 
-	response, err := netClient.Get(fmt.Sprintf("http://%s/status", agent.IP+":"+agent.Port))
+	response, err := netClient.Get(fmt.Sprintf("http://%s/status", agent.IPAddrWithPort()))
 	if err != nil || response.StatusCode != 200 {
 		nodeInfo.Error = err.Error()
 		nodeInfo.Live = false
@@ -265,6 +319,7 @@ func (manager *NodeManager) callStatus(agent Agent, checkOnly bool) error {
 	nodeInfo.JobID = infoData.ID
 	nodeInfo.Live = true
 	nodeInfo.Error = infoData.Error
+	nodeInfo.AbortReason = infoData.AbortReason
 	if checkOnly == false {
 		manager.nodeStatusChan <- nodeInfo
 	}
@@ -273,11 +328,7 @@ func (manager *NodeManager) callStatus(agent Agent, checkOnly bool) error {
 
 // UpdateEnableStatusAgent will enable or disable one agent when using benchmark
 func (manager *NodeManager) UpdateEnableStatusAgent(ip string, port string, enable bool) error {
-	agent := Agent{
-		IP:   ip,
-		Port: port,
-	}
-	err := manager.DB.First(&agent).Error
+	agent, err := manager.findAgent(ip, port)
 	if err != nil {
 		if gorm.IsRecordNotFoundError(err) {
 			return errors.New("agent not in database")
@@ -303,7 +354,7 @@ func (manager *NodeManager) GetEnabledStatusAgent() ([]Agent, error) {
 
 // UpdateLiveStatusAgent will set live or dead status on one agent when using benchmark
 func (manager *NodeManager) UpdateLiveStatusAgent(agent Agent, live bool) error {
-	err := manager.DB.First(&agent).Error
+	agent, err := manager.findAgent(agent.IP, agent.Port)
 	if err != nil {
 		if gorm.IsRecordNotFoundError(err) {
 			return errors.New("agent not in database")
@@ -0,0 +1,68 @@
+package core
+
+import (
+	"encoding/binary"
+	"errors"
+	"strings"
+
+	"github.com/zhangmingkai4315/dns-loader/dns"
+)
+
+// NotifyGenerator generate the NOTIFY messages of notify job, the
+// messages of all zones are built once and only the id is changed
+type NotifyGenerator struct {
+	packets [][]byte
+	index   int
+	offset  int
+}
+
+// ParseZoneList split the zones separated by comma, space or new line
+func ParseZoneList(zones string) []string {
+	return strings.FieldsFunc(zones, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t' || r == '\r' || r == '\n'
+	})
+}
+
+// NewNotifyGeneratorFromJob create the notify generator from job setting
+func NewNotifyGeneratorFromJob(job *JobConfig) (*NotifyGenerator, error) {
+	zones := ParseZoneList(job.NotifyZones)
+	if len(zones) == 0 {
+		return nil, errors.New("notify zone list is empty")
+	}
+	generator := &NotifyGenerator{}
+	for _, zone := range zones {
+		packet := new(dns.Packet)
+		packet.Protocol = job.Protocol
+		packet.SetQuestion(dns.FqdnFormat(zone), dns.TypeSOA)
+		packet.Header.Opcode = dns.OpcodeNotify
+		packet.Header.Authoritative = true
+		packet.Header.RecursionDesired = false
+		msg, err := packet.ToBytes()
+		if err != nil {
+			return nil, err
+		}
+		generator.packets = append(generator.packets, msg)
+	}
+	if job.Protocol == "tcp" {
+		generator.offset = 2
+	}
+	return generator, nil
+}
+
+// Len return the number of zones
+func (generator *NotifyGenerator) Len() int {
+	return len(generator.packets)
+}
+
+// Next return the NOTIFY message of next zone with a new id
+func (generator *NotifyGenerator) Next() []byte {
+	msg := generator.packets[generator.index]
+	generator.index = (generator.index + 1) % len(generator.packets)
+	binary.BigEndian.PutUint16(msg[generator.offset:], dns.GenerateRandomID(true))
+	return msg
+}
+
+// IsNotifyResponse return true when the message acknowledge a NOTIFY
+func IsNotifyResponse(msg []byte) bool {
+	return len(msg) > 2 && msg[2]&0xf8 == 0x80|dns.OpcodeNotify<<3
+}
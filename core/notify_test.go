@@ -0,0 +1,35 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/zhangmingkai4315/dns-loader/dns"
+)
+
+func TestNotifyGenerator(t *testing.T) {
+	Equals(t, []string{"a.com", "b.com", "c.com"}, ParseZoneList("a.com, b.com\nc.com\n"))
+
+	job := NewDefaultJobConfig()
+	job.JobType = JobTypeNotify
+	job.NotifyZones = "a.com,b.com"
+	generator, err := NewNotifyGeneratorFromJob(job)
+	OK(t, err)
+	Equals(t, 2, generator.Len())
+	for _, zone := range []string{"a.com.", "b.com.", "a.com."} {
+		msg := generator.Next()
+		message, err := dns.ParseMessage(msg)
+		OK(t, err)
+		Equals(t, dns.OpcodeNotify, message.Header.Opcode)
+		Equals(t, true, message.Header.Authoritative)
+		Equals(t, zone, message.Question[0].Name)
+		Equals(t, dns.TypeSOA, message.Question[0].Qtype)
+		Equals(t, false, IsNotifyResponse(msg))
+		response := append([]byte{}, msg...)
+		response[2] |= 0x80
+		Equals(t, true, IsNotifyResponse(response))
+	}
+
+	job.NotifyZones = " , "
+	_, err = NewNotifyGeneratorFromJob(job)
+	Assert(t, err != nil, "expect error for empty zone list")
+}
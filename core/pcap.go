@@ -0,0 +1,508 @@
+package core
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/bits"
+	"time"
+)
+
+// pcap and pcapng file magic numbers
+const (
+	pcapMagicMicro   = 0xa1b2c3d4
+	pcapMagicNano    = 0xa1b23c4d
+	pcapngBlockSHB   = 0x0a0d0d0a
+	pcapngBlockIDB   = 0x00000001
+	pcapngBlockPB    = 0x00000002
+	pcapngBlockSPB   = 0x00000003
+	pcapngBlockEPB   = 0x00000006
+	pcapngByteOrder  = 0x1a2b3c4d
+	maxCaptureRecord = 1 << 24
+)
+
+// link layer types supported when decode the captured frames
+const (
+	linkTypeNull     = 0
+	linkTypeEthernet = 1
+	linkTypeRaw      = 101
+	linkTypeRawAlt   = 12
+	linkTypeLoop     = 108
+	linkTypeLinuxSLL = 113
+	linkTypeIPv4     = 228
+	linkTypeIPv6     = 229
+	linkTypeSLL2     = 276
+)
+
+const (
+	ipProtocolTCP = 6
+	ipProtocolUDP = 17
+	dnsServerPort = 53
+)
+
+// CapturedQuery hold one dns query extracted from a capture file
+type CapturedQuery struct {
+	Timestamp time.Time
+	Protocol  string
+	Data      []byte
+}
+
+// captureFrame is a single link layer frame read from the capture file
+type captureFrame struct {
+	timestamp time.Time
+	linkType  uint16
+	data      []byte
+}
+
+// ReadCaptureQueries read a pcap or pcapng stream and return all dns queries
+// sent to port 53 over udp or tcp, ordered as they appear in the capture
+func ReadCaptureQueries(r io.Reader) ([]CapturedQuery, error) {
+	reader := bufio.NewReader(r)
+	magic, err := reader.Peek(4)
+	if err != nil {
+		return nil, fmt.Errorf("read capture header fail: %s", err)
+	}
+	extractor := newQueryExtractor()
+	handle := func(frame captureFrame) {
+		extractor.handleFrame(frame)
+	}
+	if binary.LittleEndian.Uint32(magic) == pcapngBlockSHB {
+		err = readPcapng(reader, handle)
+	} else {
+		err = readPcap(reader, handle)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return extractor.queries, nil
+}
+
+func readPcap(r io.Reader, handle func(captureFrame)) error {
+	header := make([]byte, 24)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return fmt.Errorf("read pcap header fail: %s", err)
+	}
+	var order binary.ByteOrder
+	var nano bool
+	switch {
+	case binary.LittleEndian.Uint32(header) == pcapMagicMicro:
+		order = binary.LittleEndian
+	case binary.BigEndian.Uint32(header) == pcapMagicMicro:
+		order = binary.BigEndian
+	case binary.LittleEndian.Uint32(header) == pcapMagicNano:
+		order, nano = binary.LittleEndian, true
+	case binary.BigEndian.Uint32(header) == pcapMagicNano:
+		order, nano = binary.BigEndian, true
+	default:
+		return errors.New("unknown capture file format, pcap or pcapng only")
+	}
+	linkType := uint16(order.Uint32(header[20:24]))
+	record := make([]byte, 16)
+	// offset of the record in file, reported when the file is truncated
+	offset := int64(len(header))
+	for {
+		if _, err := io.ReadFull(r, record); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			if err == io.ErrUnexpectedEOF {
+				return fmt.Errorf("pcap record at offset %d: %w", offset, err)
+			}
+			return err
+		}
+		sec := int64(order.Uint32(record[0:4]))
+		frac := int64(order.Uint32(record[4:8]))
+		capLen := order.Uint32(record[8:12])
+		if capLen > maxCaptureRecord {
+			return fmt.Errorf("pcap record too large: %d", capLen)
+		}
+		data := make([]byte, capLen)
+		if _, err := io.ReadFull(r, data); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return fmt.Errorf("pcap record at offset %d: %w", offset, err)
+		}
+		offset += int64(len(record)) + int64(capLen)
+		if !nano {
+			frac = frac * 1000
+		}
+		handle(captureFrame{
+			timestamp: time.Unix(sec, frac),
+			linkType:  linkType,
+			data:      data,
+		})
+	}
+}
+
+// pcapngInterface hold the link type and timestamp resolution of
+// one interface description block
+type pcapngInterface struct {
+	linkType uint16
+	// ticks per second of the timestamp
+	resolution uint64
+}
+
+func readPcapng(r io.Reader, handle func(captureFrame)) error {
+	var order binary.ByteOrder = binary.LittleEndian
+	var interfaces []pcapngInterface
+	head := make([]byte, 8)
+	// offset of the block in file, reported when the file is truncated
+	var offset int64
+	for {
+		if _, err := io.ReadFull(r, head); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			if err == io.ErrUnexpectedEOF {
+				return fmt.Errorf("pcapng block at offset %d: %w", offset, err)
+			}
+			return err
+		}
+		blockType := order.Uint32(head[0:4])
+		if blockType == pcapngBlockSHB || binary.BigEndian.Uint32(head[0:4]) == pcapngBlockSHB {
+			// section header decides the byte order of the section
+			bom := make([]byte, 4)
+			if _, err := io.ReadFull(r, bom); err != nil {
+				return fmt.Errorf("pcapng block at offset %d: %w", offset, io.ErrUnexpectedEOF)
+			}
+			if binary.LittleEndian.Uint32(bom) == pcapngByteOrder {
+				order = binary.LittleEndian
+			} else if binary.BigEndian.Uint32(bom) == pcapngByteOrder {
+				order = binary.BigEndian
+			} else {
+				return errors.New("invalid pcapng byte order magic")
+			}
+			blockLen := order.Uint32(head[4:8])
+			if blockLen < 12 || blockLen > maxCaptureRecord {
+				return fmt.Errorf("invalid pcapng block length: %d", blockLen)
+			}
+			if _, err := io.CopyN(ioutil.Discard, r, int64(blockLen-12)); err != nil {
+				return fmt.Errorf("pcapng block at offset %d: %w", offset, io.ErrUnexpectedEOF)
+			}
+			offset += int64(blockLen)
+			interfaces = nil
+			continue
+		}
+		blockLen := order.Uint32(head[4:8])
+		if blockLen < 12 || blockLen > maxCaptureRecord {
+			return fmt.Errorf("invalid pcapng block length: %d", blockLen)
+		}
+		body := make([]byte, blockLen-8)
+		if _, err := io.ReadFull(r, body); err != nil {
+			return fmt.Errorf("pcapng block at offset %d: %w", offset, io.ErrUnexpectedEOF)
+		}
+		offset += int64(blockLen)
+		// the trailing block length is not part of the body
+		body = body[:len(body)-4]
+		switch blockType {
+		case pcapngBlockIDB:
+			if len(body) < 8 {
+				return errors.New("invalid pcapng interface block")
+			}
+			resolution, err := pcapngResolution(order, body[8:], 1000000)
+			if err != nil {
+				return fmt.Errorf("pcapng block at offset %d: %s", offset-int64(blockLen), err)
+			}
+			interfaces = append(interfaces, pcapngInterface{
+				linkType:   order.Uint16(body[0:2]),
+				resolution: resolution,
+			})
+		case pcapngBlockEPB, pcapngBlockPB:
+			if len(body) < 20 {
+				continue
+			}
+			var ifaceID uint32
+			if blockType == pcapngBlockEPB {
+				ifaceID = order.Uint32(body[0:4])
+			} else {
+				ifaceID = uint32(order.Uint16(body[0:2]))
+			}
+			if int(ifaceID) >= len(interfaces) {
+				continue
+			}
+			iface := interfaces[ifaceID]
+			ticks := uint64(order.Uint32(body[4:8]))<<32 | uint64(order.Uint32(body[8:12]))
+			capLen := order.Uint32(body[12:16])
+			if int(capLen) > len(body)-20 {
+				continue
+			}
+			handle(captureFrame{
+				timestamp: ticksToTime(ticks, iface.resolution),
+				linkType:  iface.linkType,
+				data:      body[20 : 20+capLen],
+			})
+		case pcapngBlockSPB:
+			// simple packet block has no timestamp, keep it at the zero time
+			if len(body) < 4 || len(interfaces) == 0 {
+				continue
+			}
+			data := body[4:]
+			if origLen := order.Uint32(body[0:4]); int(origLen) < len(data) {
+				data = data[:origLen]
+			}
+			handle(captureFrame{
+				linkType: interfaces[0].linkType,
+				data:     data,
+			})
+		}
+	}
+}
+
+// pcapngResolution search the if_tsresol option in interface block
+// options, the resolution which does not fit in uint64 is rejected
+func pcapngResolution(order binary.ByteOrder, options []byte, defaultValue uint64) (uint64, error) {
+	for len(options) >= 4 {
+		code := order.Uint16(options[0:2])
+		length := int(order.Uint16(options[2:4]))
+		if code == 0 || 4+length > len(options) {
+			break
+		}
+		if code == 9 && length >= 1 {
+			value := options[4]
+			resolution := uint64(1)
+			if value&0x80 != 0 {
+				if value&0x7f > 63 {
+					return 0, fmt.Errorf("invalid pcapng timestamp resolution 2^-%d", value&0x7f)
+				}
+				resolution <<= value & 0x7f
+			} else {
+				// 10^19 is the largest power of ten in uint64
+				if value > 19 {
+					return 0, fmt.Errorf("invalid pcapng timestamp resolution 10^-%d", value)
+				}
+				for i := 0; i < int(value); i++ {
+					resolution *= 10
+				}
+			}
+			return resolution, nil
+		}
+		options = options[4+(length+3)/4*4:]
+	}
+	return defaultValue, nil
+}
+
+func ticksToTime(ticks, resolution uint64) time.Time {
+	sec := ticks / resolution
+	rest := ticks % resolution
+	// rest * 1e9 may overflow uint64 for the high resolutions, the
+	// quotient fit in uint64 since rest is less than resolution
+	hi, lo := bits.Mul64(rest, uint64(time.Second))
+	nsec, _ := bits.Div64(hi, lo, resolution)
+	return time.Unix(int64(sec), int64(nsec))
+}
+
+// tcpFlow identify a tcp stream from client to dns server
+type tcpFlow struct {
+	src, dst     string
+	sport, dport uint16
+}
+
+type tcpStream struct {
+	nextSeq uint32
+	buffer  []byte
+}
+
+// queryExtractor decode link, network and transport layers
+// and collect the dns queries found in the payloads
+type queryExtractor struct {
+	queries []CapturedQuery
+	streams map[tcpFlow]*tcpStream
+}
+
+func newQueryExtractor() *queryExtractor {
+	return &queryExtractor{
+		streams: make(map[tcpFlow]*tcpStream),
+	}
+}
+
+func (extractor *queryExtractor) handleFrame(frame captureFrame) {
+	data := frame.data
+	var etherType uint16
+	switch frame.linkType {
+	case linkTypeEthernet:
+		if len(data) < 14 {
+			return
+		}
+		etherType = binary.BigEndian.Uint16(data[12:14])
+		data = data[14:]
+		// skip the 802.1Q and 802.1ad tags
+		for (etherType == 0x8100 || etherType == 0x88a8) && len(data) >= 4 {
+			etherType = binary.BigEndian.Uint16(data[2:4])
+			data = data[4:]
+		}
+	case linkTypeNull, linkTypeLoop:
+		if len(data) < 4 {
+			return
+		}
+		data = data[4:]
+	case linkTypeLinuxSLL:
+		if len(data) < 16 {
+			return
+		}
+		etherType = binary.BigEndian.Uint16(data[14:16])
+		data = data[16:]
+	case linkTypeSLL2:
+		if len(data) < 20 {
+			return
+		}
+		etherType = binary.BigEndian.Uint16(data[0:2])
+		data = data[20:]
+	case linkTypeRaw, linkTypeRawAlt, linkTypeIPv4, linkTypeIPv6:
+	default:
+		return
+	}
+	if len(data) == 0 {
+		return
+	}
+	if etherType != 0 && etherType != 0x0800 && etherType != 0x86dd {
+		return
+	}
+	switch data[0] >> 4 {
+	case 4:
+		extractor.handleIPv4(frame.timestamp, data)
+	case 6:
+		extractor.handleIPv6(frame.timestamp, data)
+	}
+}
+
+func (extractor *queryExtractor) handleIPv4(ts time.Time, data []byte) {
+	if len(data) < 20 {
+		return
+	}
+	headerLen := int(data[0]&0x0f) * 4
+	totalLen := int(binary.BigEndian.Uint16(data[2:4]))
+	if headerLen < 20 || totalLen < headerLen || len(data) < headerLen {
+		return
+	}
+	// fragmented datagrams are not reassembled
+	if binary.BigEndian.Uint16(data[6:8])&0x3fff != 0 {
+		return
+	}
+	if totalLen < len(data) {
+		data = data[:totalLen]
+	}
+	src := fmt.Sprintf("%d.%d.%d.%d", data[12], data[13], data[14], data[15])
+	dst := fmt.Sprintf("%d.%d.%d.%d", data[16], data[17], data[18], data[19])
+	extractor.handleTransport(ts, data[9], src, dst, data[headerLen:])
+}
+
+func (extractor *queryExtractor) handleIPv6(ts time.Time, data []byte) {
+	if len(data) < 40 {
+		return
+	}
+	payloadLen := int(binary.BigEndian.Uint16(data[4:6]))
+	nextHeader := data[6]
+	src := fmt.Sprintf("%x", data[8:24])
+	dst := fmt.Sprintf("%x", data[24:40])
+	data = data[40:]
+	if payloadLen < len(data) {
+		data = data[:payloadLen]
+	}
+	// skip hop-by-hop, routing and destination options headers
+	for nextHeader == 0 || nextHeader == 43 || nextHeader == 60 {
+		if len(data) < 8 {
+			return
+		}
+		length := (int(data[1]) + 1) * 8
+		if len(data) < length {
+			return
+		}
+		nextHeader = data[0]
+		data = data[length:]
+	}
+	extractor.handleTransport(ts, nextHeader, src, dst, data)
+}
+
+func (extractor *queryExtractor) handleTransport(ts time.Time, protocol uint8, src, dst string, data []byte) {
+	switch protocol {
+	case ipProtocolUDP:
+		if len(data) < 8 {
+			return
+		}
+		if binary.BigEndian.Uint16(data[2:4]) != dnsServerPort {
+			return
+		}
+		extractor.addQuery(ts, "udp", data[8:])
+	case ipProtocolTCP:
+		if len(data) < 20 {
+			return
+		}
+		dport := binary.BigEndian.Uint16(data[2:4])
+		if dport != dnsServerPort {
+			return
+		}
+		flow := tcpFlow{
+			src:   src,
+			dst:   dst,
+			sport: binary.BigEndian.Uint16(data[0:2]),
+			dport: dport,
+		}
+		seq := binary.BigEndian.Uint32(data[4:8])
+		offset := int(data[12]>>4) * 4
+		flags := data[13]
+		if offset < 20 || offset > len(data) {
+			return
+		}
+		payload := data[offset:]
+		stream, ok := extractor.streams[flow]
+		if flags&0x02 != 0 {
+			// SYN start a new stream
+			extractor.streams[flow] = &tcpStream{nextSeq: seq + 1}
+			return
+		}
+		if !ok {
+			// capture started in the middle of the stream
+			stream = &tcpStream{nextSeq: seq}
+			extractor.streams[flow] = stream
+		}
+		if len(payload) > 0 {
+			switch {
+			case seq == stream.nextSeq:
+				stream.buffer = append(stream.buffer, payload...)
+				stream.nextSeq = seq + uint32(len(payload))
+			case int32(seq-stream.nextSeq) > 0:
+				// lost segment, drop the partial data and resync
+				stream.buffer = nil
+				stream.nextSeq = seq + uint32(len(payload))
+				return
+			default:
+				// retransmission
+				return
+			}
+			for len(stream.buffer) >= 2 {
+				size := int(binary.BigEndian.Uint16(stream.buffer[0:2]))
+				if len(stream.buffer) < size+2 {
+					break
+				}
+				extractor.addQuery(ts, "tcp", stream.buffer[2:size+2])
+				stream.buffer = stream.buffer[size+2:]
+			}
+		}
+		if flags&0x05 != 0 {
+			// FIN or RST close the stream
+			delete(extractor.streams, flow)
+		}
+	}
+}
+
+// addQuery keep the payload only if it looks like a standard dns query
+func (extractor *queryExtractor) addQuery(ts time.Time, protocol string, payload []byte) {
+	if len(payload) < 12 {
+		return
+	}
+	// QR bit must be zero and question count not zero
+	if payload[2]&0x80 != 0 || binary.BigEndian.Uint16(payload[4:6]) == 0 {
+		return
+	}
+	data := make([]byte, len(payload))
+	copy(data, payload)
+	extractor.queries = append(extractor.queries, CapturedQuery{
+		Timestamp: ts,
+		Protocol:  protocol,
+		Data:      data,
+	})
+}
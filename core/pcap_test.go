@@ -0,0 +1,191 @@
+package core
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/zhangmingkai4315/dns-loader/dns"
+)
+
+func buildTestQuery(domain string) []byte {
+	packet := new(dns.Packet)
+	packet.Protocol = "udp"
+	packet.SetQuestion(dns.FqdnFormat(domain), dns.TypeA)
+	msg, _ := packet.ToBytes()
+	return msg
+}
+
+// buildTestFrame wrap the payload with ethernet, ipv4 and udp or tcp header
+func buildTestFrame(protocol uint8, dport uint16, seq uint32, flags uint8, payload []byte) []byte {
+	var transport []byte
+	if protocol == ipProtocolUDP {
+		transport = make([]byte, 8)
+		binary.BigEndian.PutUint16(transport[0:2], 40000)
+		binary.BigEndian.PutUint16(transport[2:4], dport)
+		binary.BigEndian.PutUint16(transport[4:6], uint16(8+len(payload)))
+	} else {
+		transport = make([]byte, 20)
+		binary.BigEndian.PutUint16(transport[0:2], 40000)
+		binary.BigEndian.PutUint16(transport[2:4], dport)
+		binary.BigEndian.PutUint32(transport[4:8], seq)
+		transport[12] = 5 << 4
+		transport[13] = flags
+	}
+	transport = append(transport, payload...)
+	ip := make([]byte, 20)
+	ip[0] = 0x45
+	binary.BigEndian.PutUint16(ip[2:4], uint16(20+len(transport)))
+	ip[8] = 64
+	ip[9] = protocol
+	copy(ip[12:16], []byte{10, 0, 0, 1})
+	copy(ip[16:20], []byte{10, 0, 0, 2})
+	ether := make([]byte, 14)
+	binary.BigEndian.PutUint16(ether[12:14], 0x0800)
+	frame := append(ether, ip...)
+	return append(frame, transport...)
+}
+
+func buildTestPcap(start time.Time, frames [][]byte, interval time.Duration) []byte {
+	var buf bytes.Buffer
+	header := make([]byte, 24)
+	binary.LittleEndian.PutUint32(header[0:4], pcapMagicMicro)
+	binary.LittleEndian.PutUint16(header[4:6], 2)
+	binary.LittleEndian.PutUint16(header[6:8], 4)
+	binary.LittleEndian.PutUint32(header[16:20], 65535)
+	binary.LittleEndian.PutUint32(header[20:24], linkTypeEthernet)
+	buf.Write(header)
+	for i, frame := range frames {
+		ts := start.Add(time.Duration(i) * interval)
+		record := make([]byte, 16)
+		binary.LittleEndian.PutUint32(record[0:4], uint32(ts.Unix()))
+		binary.LittleEndian.PutUint32(record[4:8], uint32(ts.Nanosecond()/1000))
+		binary.LittleEndian.PutUint32(record[8:12], uint32(len(frame)))
+		binary.LittleEndian.PutUint32(record[12:16], uint32(len(frame)))
+		buf.Write(record)
+		buf.Write(frame)
+	}
+	return buf.Bytes()
+}
+
+func buildTestPcapng(frame []byte, ticks uint64, tsresol byte) []byte {
+	var buf bytes.Buffer
+	block := func(blockType uint32, body []byte) {
+		for len(body)%4 != 0 {
+			body = append(body, 0)
+		}
+		head := make([]byte, 8)
+		binary.LittleEndian.PutUint32(head[0:4], blockType)
+		binary.LittleEndian.PutUint32(head[4:8], uint32(len(body)+12))
+		buf.Write(head)
+		buf.Write(body)
+		buf.Write(head[4:8])
+	}
+	shb := make([]byte, 16)
+	binary.LittleEndian.PutUint32(shb[0:4], pcapngByteOrder)
+	binary.LittleEndian.PutUint16(shb[4:6], 1)
+	binary.LittleEndian.PutUint64(shb[8:16], ^uint64(0))
+	block(pcapngBlockSHB, shb)
+	// interface with the if_tsresol option
+	idb := make([]byte, 8)
+	binary.LittleEndian.PutUint16(idb[0:2], linkTypeEthernet)
+	idb = append(idb, 9, 0, 1, 0, tsresol, 0, 0, 0, 0, 0, 0, 0)
+	block(pcapngBlockIDB, idb)
+	epb := make([]byte, 20)
+	binary.LittleEndian.PutUint32(epb[4:8], uint32(ticks>>32))
+	binary.LittleEndian.PutUint32(epb[8:12], uint32(ticks))
+	binary.LittleEndian.PutUint32(epb[12:16], uint32(len(frame)))
+	binary.LittleEndian.PutUint32(epb[16:20], uint32(len(frame)))
+	block(pcapngBlockEPB, append(epb, frame...))
+	return buf.Bytes()
+}
+
+func TestReadCaptureQueriesPcap(t *testing.T) {
+	query := buildTestQuery("example.com")
+	tcpPayload := make([]byte, 2, len(query)+2)
+	binary.BigEndian.PutUint16(tcpPayload, uint16(len(query)))
+	tcpPayload = append(tcpPayload, query...)
+	response := append([]byte{}, query...)
+	response[2] |= 0x80
+	frames := [][]byte{
+		buildTestFrame(ipProtocolUDP, 53, 0, 0, query),
+		// not a dns port
+		buildTestFrame(ipProtocolUDP, 5353, 0, 0, query),
+		// response is ignored
+		buildTestFrame(ipProtocolUDP, 53, 0, 0, response),
+		buildTestFrame(ipProtocolTCP, 53, 100, 0x02, nil),
+		// tcp message split into two segments
+		buildTestFrame(ipProtocolTCP, 53, 101, 0x18, tcpPayload[:5]),
+		buildTestFrame(ipProtocolTCP, 53, 106, 0x18, tcpPayload[5:]),
+	}
+	start := time.Unix(1500000000, 0)
+	queries, err := ReadCaptureQueries(bytes.NewReader(buildTestPcap(start, frames, 10*time.Millisecond)))
+	OK(t, err)
+	Equals(t, 2, len(queries))
+	Equals(t, "udp", queries[0].Protocol)
+	Equals(t, "tcp", queries[1].Protocol)
+	Equals(t, query, queries[0].Data)
+	Equals(t, query, queries[1].Data)
+	Equals(t, 50*time.Millisecond, queries[1].Timestamp.Sub(queries[0].Timestamp))
+}
+
+func TestReadCaptureQueriesPcapng(t *testing.T) {
+	query := buildTestQuery("example.com")
+	frame := buildTestFrame(ipProtocolUDP, 53, 0, 0, query)
+	ticks := uint64(1500000000)*uint64(time.Second) + 123
+	queries, err := ReadCaptureQueries(bytes.NewReader(buildTestPcapng(frame, ticks, 9)))
+	OK(t, err)
+	Equals(t, 1, len(queries))
+	Equals(t, query, queries[0].Data)
+	Equals(t, time.Unix(1500000000, 123), queries[0].Timestamp)
+
+	// 2^-62 resolution, the fraction must not overflow
+	ticks = uint64(3)<<62 | uint64(1)<<61
+	queries, err = ReadCaptureQueries(bytes.NewReader(buildTestPcapng(frame, ticks, 0x80|62)))
+	OK(t, err)
+	Equals(t, time.Unix(3, 500000000), queries[0].Timestamp)
+
+	for _, tsresol := range []byte{0x80 | 64, 0x80 | 127, 20, 64} {
+		_, err = ReadCaptureQueries(bytes.NewReader(buildTestPcapng(frame, ticks, tsresol)))
+		Assert(t, err != nil, "expect error for if_tsresol %#x", tsresol)
+	}
+}
+
+func TestReadCaptureQueriesTruncated(t *testing.T) {
+	query := buildTestQuery("example.com")
+	frame := buildTestFrame(ipProtocolUDP, 53, 0, 0, query)
+	pcap := buildTestPcap(time.Unix(1500000000, 0), [][]byte{frame, frame}, time.Millisecond)
+	// cut inside the body and inside the header of the second record
+	for _, size := range []int{len(pcap) - 10, len(pcap) - len(frame) - 8} {
+		_, err := ReadCaptureQueries(bytes.NewReader(pcap[:size]))
+		Assert(t, errors.Is(err, io.ErrUnexpectedEOF), "expect truncated error, got %v", err)
+	}
+	pcapng := buildTestPcapng(frame, 0, 9)
+	_, err := ReadCaptureQueries(bytes.NewReader(pcapng[:len(pcapng)-10]))
+	Assert(t, errors.Is(err, io.ErrUnexpectedEOF), "expect truncated error, got %v", err)
+}
+
+func TestReplaySource(t *testing.T) {
+	query := buildTestQuery("example.com")
+	start := time.Unix(1500000000, 0)
+	captured := []CapturedQuery{
+		{Timestamp: start, Protocol: "udp", Data: query},
+		{Timestamp: start.Add(2 * time.Second), Protocol: "udp", Data: query},
+	}
+	source, err := NewReplaySource(captured, "tcp", ReplayTimingOriginal, 2)
+	OK(t, err)
+	Equals(t, time.Second, source.Duration(100))
+	next := source.Next()
+	Equals(t, len(query)+2, len(next))
+	Equals(t, uint16(len(query)), binary.BigEndian.Uint16(next[0:2]))
+	Assert(t, source.Next() != nil, "expect the second query")
+	Assert(t, source.Next() == nil, "expect no more query")
+
+	source, err = NewReplaySource(captured, "udp", ReplayTimingQPS, 1)
+	OK(t, err)
+	Equals(t, false, source.Paced())
+	Equals(t, 20*time.Millisecond, source.Duration(100))
+}
@@ -0,0 +1,268 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	log "github.com/sirupsen/logrus"
+)
+
+// Status of the jobs in queue, the run of started job is in the history
+const (
+	QueueStatusQueued   = "queued"
+	QueueStatusStarted  = "started"
+	QueueStatusCanceled = "canceled"
+	QueueStatusFailed   = "failed"
+)
+
+// QueuedJob is a job in the queue of master, the queued jobs are started
+// in order when no job is running. ScheduleID is the schedule queued the
+// job and HistoryID is the history of the started job
+type QueuedJob struct {
+	gorm.Model
+	Job        string     `json:"-" gorm:"type:text"`
+	Config     JobConfig  `json:"config" gorm:"-"`
+	User       string     `json:"user"`
+	ScheduleID uint       `json:"schedule_id"`
+	Status     string     `json:"status"`
+	HistoryID  uint       `json:"history_id"`
+	Error      string     `json:"error"`
+	StartedAt  *time.Time `json:"started_at"`
+}
+
+// Schedule queue the job at the times of the cron expression
+type Schedule struct {
+	gorm.Model
+	Name    string     `json:"name"`
+	Cron    string     `json:"cron"`
+	Job     string     `json:"-" gorm:"type:text"`
+	Config  JobConfig  `json:"config" gorm:"-"`
+	User    string     `json:"user"`
+	Enable  bool       `json:"enable"`
+	NextRun time.Time  `json:"next_run"`
+	LastRun *time.Time `json:"last_run"`
+}
+
+// encodeJob return the saved form of job, the id and the resolved
+// targets are set when the job start
+func encodeJob(job *JobConfig) (string, error) {
+	saved := *job
+	saved.JobID = ""
+	saved.ResolvedTargets = ""
+	saved.ReplayData = nil
+	data, err := json.Marshal(saved)
+	return string(data), err
+}
+
+// AfterFind load the job config
+func (queued *QueuedJob) AfterFind() error {
+	return json.Unmarshal([]byte(queued.Job), &queued.Config)
+}
+
+// AfterFind load the job config
+func (schedule *Schedule) AfterFind() error {
+	return json.Unmarshal([]byte(schedule.Job), &schedule.Config)
+}
+
+// EnqueueJob append the validated job to the queue
+func (dbHander *DBHandler) EnqueueJob(job *JobConfig, user string, scheduleID uint) (*QueuedJob, error) {
+	content, err := encodeJob(job)
+	if err != nil {
+		return nil, err
+	}
+	queued := &QueuedJob{
+		Job:        content,
+		Config:     *job,
+		User:       user,
+		ScheduleID: scheduleID,
+		Status:     QueueStatusQueued,
+	}
+	if err := dbHander.Create(queued).Error; err != nil {
+		return nil, fmt.Errorf("save queued job fail: %s", err)
+	}
+	return queued, nil
+}
+
+// RecordStartedJob save the job started by the user directly as a started
+// job of the queue, the direct start run before the queued jobs
+func (dbHander *DBHandler) RecordStartedJob(job *JobConfig, user string, historyID uint, agentErrors string) (*QueuedJob, error) {
+	content, err := encodeJob(job)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	queued := &QueuedJob{
+		Job:       content,
+		Config:    *job,
+		User:      user,
+		Status:    QueueStatusStarted,
+		HistoryID: historyID,
+		Error:     agentErrors,
+		StartedAt: &now,
+	}
+	if err := dbHander.Create(queued).Error; err != nil {
+		return nil, fmt.Errorf("save started job fail: %s", err)
+	}
+	return queued, nil
+}
+
+// GetQueuedJobs return the queued jobs and the last jobs left the queue
+func (dbHander *DBHandler) GetQueuedJobs(limit int) ([]QueuedJob, error) {
+	jobs := []QueuedJob{}
+	err := dbHander.Where("status = ?", QueueStatusQueued).Order("id").Find(&jobs).Error
+	if err != nil && !gorm.IsRecordNotFoundError(err) {
+		return nil, err
+	}
+	done := []QueuedJob{}
+	err = dbHander.Where("status <> ?", QueueStatusQueued).Order("id desc").Limit(limit).Find(&done).Error
+	if err != nil && !gorm.IsRecordNotFoundError(err) {
+		return nil, err
+	}
+	return append(jobs, done...), nil
+}
+
+// NextQueuedJob return the first job of the queue, nil when the queue is
+// empty
+func (dbHander *DBHandler) NextQueuedJob() (*QueuedJob, error) {
+	queued := &QueuedJob{}
+	err := dbHander.Where("status = ?", QueueStatusQueued).Order("id").First(queued).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return queued, nil
+}
+
+// GetQueuedJob return the job of queue by id
+func (dbHander *DBHandler) GetQueuedJob(id uint) (*QueuedJob, error) {
+	queued := &QueuedJob{}
+	if err := dbHander.First(queued, id).Error; err != nil {
+		return nil, fmt.Errorf("queued job %d not exist", id)
+	}
+	return queued, nil
+}
+
+// CancelQueuedJob remove the job from queue, only the job not started
+// can be canceled
+func (dbHander *DBHandler) CancelQueuedJob(id uint) error {
+	queued, err := dbHander.GetQueuedJob(id)
+	if err != nil {
+		return err
+	}
+	if queued.Status != QueueStatusQueued {
+		return fmt.Errorf("queued job %d is %s", id, queued.Status)
+	}
+	return dbHander.Model(queued).Update("status", QueueStatusCanceled).Error
+}
+
+// CreateSchedule save the validated job with the cron expression
+func (dbHander *DBHandler) CreateSchedule(name, cron string, job *JobConfig, user string) (*Schedule, error) {
+	if name == "" {
+		return nil, errors.New("schedule name is empty")
+	}
+	cronSchedule, err := ParseCron(cron)
+	if err != nil {
+		return nil, err
+	}
+	next := cronSchedule.Next(time.Now())
+	if next.IsZero() {
+		return nil, fmt.Errorf("cron expression %q never run", cron)
+	}
+	content, err := encodeJob(job)
+	if err != nil {
+		return nil, err
+	}
+	schedule := &Schedule{
+		Name:    name,
+		Cron:    cron,
+		Job:     content,
+		Config:  *job,
+		User:    user,
+		Enable:  true,
+		NextRun: next,
+	}
+	if err := dbHander.Create(schedule).Error; err != nil {
+		return nil, fmt.Errorf("save schedule fail: %s", err)
+	}
+	return schedule, nil
+}
+
+// GetSchedules return all schedules
+func (dbHander *DBHandler) GetSchedules() ([]Schedule, error) {
+	schedules := []Schedule{}
+	err := dbHander.Order("id").Find(&schedules).Error
+	if err != nil && !gorm.IsRecordNotFoundError(err) {
+		return nil, err
+	}
+	return schedules, nil
+}
+
+// UpdateScheduleEnable enable or disable the schedule, the runs missed
+// when it is disabled are skipped
+func (dbHander *DBHandler) UpdateScheduleEnable(id uint, enable bool) error {
+	schedule := &Schedule{}
+	if err := dbHander.First(schedule, id).Error; err != nil {
+		return fmt.Errorf("schedule %d not exist", id)
+	}
+	cronSchedule, err := ParseCron(schedule.Cron)
+	if err != nil {
+		return err
+	}
+	next := cronSchedule.Next(time.Now())
+	if enable && next.IsZero() {
+		return fmt.Errorf("cron expression %q never run", schedule.Cron)
+	}
+	return dbHander.Model(schedule).Updates(map[string]interface{}{
+		"enable":   enable,
+		"next_run": next,
+	}).Error
+}
+
+// DeleteSchedule remove the schedule, the jobs it queued are kept
+func (dbHander *DBHandler) DeleteSchedule(id uint) error {
+	schedule := &Schedule{}
+	if err := dbHander.First(schedule, id).Error; err != nil {
+		return fmt.Errorf("schedule %d not exist", id)
+	}
+	return dbHander.Unscoped().Delete(schedule).Error
+}
+
+// EnqueueDueSchedules queue the jobs of the enabled schedules due at now,
+// the runs missed when master is down are queued once
+func (dbHander *DBHandler) EnqueueDueSchedules(now time.Time) error {
+	schedules := []Schedule{}
+	err := dbHander.Where("enable = ?", true).Find(&schedules).Error
+	if err != nil && !gorm.IsRecordNotFoundError(err) {
+		return err
+	}
+	for i := range schedules {
+		schedule := &schedules[i]
+		if schedule.NextRun.After(now) {
+			continue
+		}
+		cronSchedule, err := ParseCron(schedule.Cron)
+		if err != nil {
+			return err
+		}
+		if _, err := dbHander.EnqueueJob(&schedule.Config, schedule.User, schedule.ID); err != nil {
+			return err
+		}
+		log.Infof("schedule %s queue a new job", schedule.Name)
+		next := cronSchedule.Next(now)
+		err = dbHander.Model(schedule).Updates(map[string]interface{}{
+			"last_run": &now,
+			"next_run": next,
+			// the schedule is done when its cron never run again
+			"enable": !next.IsZero(),
+		}).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
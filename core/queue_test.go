@@ -0,0 +1,107 @@
+package core
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestJobQueue(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dns-loader")
+	OK(t, err)
+	defer os.RemoveAll(dir)
+	OK(t, NewDatabaseConnectionFromFile(filepath.Join(dir, "app.db")))
+	db := GetDBHandler()
+	defer db.Close()
+
+	next, err := db.NextQueuedJob()
+	OK(t, err)
+	Assert(t, next == nil, "queue should be empty")
+	job := NewDefaultJobConfig()
+	job.Server = "192.0.2.53"
+	job.JobID = "6ba7b810-9dad-11d1-80b4-00c04fd430c8"
+	first, err := db.EnqueueJob(job, "alice", 0)
+	OK(t, err)
+	job.Server = "192.0.2.54"
+	second, err := db.EnqueueJob(job, "bob", 0)
+	OK(t, err)
+
+	// the jobs are started in order and get a new job id
+	next, err = db.NextQueuedJob()
+	OK(t, err)
+	Equals(t, first.ID, next.ID)
+	Equals(t, "192.0.2.53", next.Config.Server)
+	Equals(t, "", next.Config.JobID)
+	next.Status = QueueStatusStarted
+	OK(t, db.Save(next).Error)
+	Assert(t, db.CancelQueuedJob(first.ID) != nil, "expect error for canceling started job")
+	OK(t, db.CancelQueuedJob(second.ID))
+	next, err = db.NextQueuedJob()
+	OK(t, err)
+	Assert(t, next == nil, "queue should be empty")
+	jobs, err := db.GetQueuedJobs(10)
+	OK(t, err)
+	Equals(t, 2, len(jobs))
+	Equals(t, QueueStatusCanceled, jobs[0].Status)
+
+	// the job started directly is not started again by the queue
+	started, err := db.RecordStartedJob(job, "carol", 3, "")
+	OK(t, err)
+	next, err = db.NextQueuedJob()
+	OK(t, err)
+	Assert(t, next == nil, "queue should be empty")
+	jobs, err = db.GetQueuedJobs(10)
+	OK(t, err)
+	Equals(t, started.ID, jobs[0].ID)
+	Equals(t, uint(3), jobs[0].HistoryID)
+}
+
+func TestSchedule(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dns-loader")
+	OK(t, err)
+	defer os.RemoveAll(dir)
+	OK(t, NewDatabaseConnectionFromFile(filepath.Join(dir, "app.db")))
+	db := GetDBHandler()
+	defer db.Close()
+
+	job := NewDefaultJobConfig()
+	job.Server = "192.0.2.53"
+	_, err = db.CreateSchedule("", "@daily", job, "alice")
+	Assert(t, err != nil, "expect error for empty name")
+	_, err = db.CreateSchedule("nightly", "0 2 * *", job, "alice")
+	Assert(t, err != nil, "expect error for invalid cron")
+	schedule, err := db.CreateSchedule("nightly", "0 2 * * *", job, "alice")
+	OK(t, err)
+	Equals(t, 2, schedule.NextRun.Hour())
+
+	// nothing is queued before the next run
+	OK(t, db.EnqueueDueSchedules(time.Now()))
+	next, err := db.NextQueuedJob()
+	OK(t, err)
+	Assert(t, next == nil, "queue should be empty")
+
+	// the missed runs are queued once
+	now := schedule.NextRun.Add(49 * time.Hour)
+	OK(t, db.EnqueueDueSchedules(now))
+	OK(t, db.EnqueueDueSchedules(now))
+	jobs, err := db.GetQueuedJobs(10)
+	OK(t, err)
+	Equals(t, 1, len(jobs))
+	Equals(t, schedule.ID, jobs[0].ScheduleID)
+	Equals(t, "alice", jobs[0].User)
+	Equals(t, "192.0.2.53", jobs[0].Config.Server)
+	schedules, err := db.GetSchedules()
+	OK(t, err)
+	Assert(t, schedules[0].NextRun.After(now), "next run should be after now")
+
+	// the disabled schedule queue nothing
+	OK(t, db.UpdateScheduleEnable(schedule.ID, false))
+	OK(t, db.EnqueueDueSchedules(now.Add(48*time.Hour)))
+	jobs, err = db.GetQueuedJobs(10)
+	OK(t, err)
+	Equals(t, 1, len(jobs))
+	OK(t, db.DeleteSchedule(schedule.ID))
+	Assert(t, db.DeleteSchedule(schedule.ID) != nil, "expect error for deleted schedule")
+}
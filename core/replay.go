@@ -0,0 +1,142 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ReplaySource feed the loader with the queries captured in a pcap file
+type ReplaySource struct {
+	// queries already packed for the job protocol
+	queries [][]byte
+	// offsets is the time of each query since the first one
+	offsets []time.Duration
+	timing  string
+	speed   float64
+	index   uint64
+	start   time.Time
+	timer   *time.Timer
+}
+
+// NewReplaySourceFromJob load the capture data of a replay job
+// from the shipped data or the local file
+func NewReplaySourceFromJob(job *JobConfig) (*ReplaySource, error) {
+	var reader io.Reader
+	if len(job.ReplayData) > 0 {
+		reader = bytes.NewReader(job.ReplayData)
+	} else {
+		file, err := os.Open(job.ReplayFile)
+		if err != nil {
+			return nil, fmt.Errorf("open replay file fail: %s", err)
+		}
+		defer file.Close()
+		reader = file
+	}
+	queries, err := ReadCaptureQueries(reader)
+	if err != nil {
+		return nil, err
+	}
+	return NewReplaySource(queries, job.Protocol, job.ReplayTiming, job.ReplaySpeed)
+}
+
+// NewReplaySource create a replay source with the captured queries
+func NewReplaySource(queries []CapturedQuery, protocol string, timing string, speed float64) (*ReplaySource, error) {
+	if len(queries) == 0 {
+		return nil, errors.New("no dns query found in capture")
+	}
+	if timing == "" {
+		timing = ReplayTimingOriginal
+	}
+	if speed <= 0 {
+		speed = 1
+	}
+	source := &ReplaySource{
+		timing: timing,
+		speed:  speed,
+	}
+	first := queries[0].Timestamp
+	for _, query := range queries {
+		data := query.Data
+		if protocol == "tcp" {
+			data = make([]byte, len(query.Data)+2)
+			binary.BigEndian.PutUint16(data, uint16(len(query.Data)))
+			copy(data[2:], query.Data)
+		}
+		offset := query.Timestamp.Sub(first)
+		if offset < 0 {
+			offset = 0
+		}
+		source.queries = append(source.queries, data)
+		source.offsets = append(source.offsets, offset)
+	}
+	log.Infof("load %d queries from capture, capture duration %v", len(source.queries), source.offsets[len(source.offsets)-1])
+	return source, nil
+}
+
+// Len return the number of queries in the source
+func (source *ReplaySource) Len() int {
+	return len(source.queries)
+}
+
+// Paced return true when the source decide the sending time itself
+func (source *ReplaySource) Paced() bool {
+	return source.timing == ReplayTimingOriginal
+}
+
+// Duration return the expected time to replay the full capture
+func (source *ReplaySource) Duration(qps uint32) time.Duration {
+	if source.Paced() {
+		last := source.offsets[len(source.offsets)-1]
+		return time.Duration(float64(last) / source.speed)
+	}
+	if qps == 0 {
+		return 0
+	}
+	return time.Duration(len(source.queries)) * time.Second / time.Duration(qps)
+}
+
+// Wait block until the next query should be sent, it return false
+// when the context is done or the capture is exhausted
+func (source *ReplaySource) Wait(ctx context.Context) bool {
+	index := atomic.LoadUint64(&source.index)
+	if index >= uint64(len(source.queries)) {
+		return false
+	}
+	if index == 0 {
+		source.start = time.Now()
+	}
+	due := source.start.Add(time.Duration(float64(source.offsets[index]) / source.speed))
+	wait := time.Until(due)
+	if wait <= 0 {
+		return true
+	}
+	if source.timer == nil {
+		source.timer = time.NewTimer(wait)
+	} else {
+		source.timer.Reset(wait)
+	}
+	select {
+	case <-ctx.Done():
+		return false
+	case <-source.timer.C:
+		return true
+	}
+}
+
+// Next return the next query, nil when all queries have been sent
+func (source *ReplaySource) Next() []byte {
+	index := atomic.AddUint64(&source.index, 1) - 1
+	if index >= uint64(len(source.queries)) {
+		return nil
+	}
+	return source.queries[index]
+}
@@ -0,0 +1,130 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"github.com/zhangmingkai4315/dns-loader/dns"
+)
+
+// Report is the result of a query job, it is saved in the job history and
+// can be written to a file to compare the results of runs
+type Report struct {
+	Job         JobConfig         `json:"job"`
+	StartTime   time.Time         `json:"start_time"`
+	RunningTime time.Duration     `json:"running_time"`
+	Sent        uint64            `json:"sent"`
+	Received    uint64            `json:"received"`
+	TargetQPS   uint32            `json:"target_qps"`
+	QPS         float64           `json:"qps"`
+	Rcodes      map[string]uint64 `json:"rcodes"`
+	Unknown     uint64            `json:"unknown"`
+	Latency     LatencySummary    `json:"latency"`
+	Responses   ResponseSummary   `json:"responses"`
+	Breakdown   []BreakdownRow    `json:"breakdown"`
+	Sources     []GroupResult     `json:"sources,omitempty"`
+	Targets     []GroupResult     `json:"targets,omitempty"`
+	Mismatches  map[string]uint64 `json:"mismatches,omitempty"`
+	Assertions  []AssertionResult `json:"assertions,omitempty"`
+	AbortReason string            `json:"abort_reason,omitempty"`
+}
+
+// BreakdownRow is the result of queries of one query type and pattern
+type BreakdownRow struct {
+	Qtype   string            `json:"qtype"`
+	Pattern string            `json:"pattern"`
+	Sent    uint64            `json:"sent"`
+	Rcodes  map[string]uint64 `json:"rcodes"`
+	Unknown uint64            `json:"unknown"`
+	Latency LatencySummary    `json:"latency"`
+}
+
+// GroupResult is the result of queries sent from a source address or to
+// a target
+type GroupResult struct {
+	Name     string            `json:"name"`
+	Sent     uint64            `json:"sent"`
+	Received uint64            `json:"received"`
+	Rcodes   map[string]uint64 `json:"rcodes"`
+	Unknown  uint64            `json:"unknown"`
+	Latency  LatencySummary    `json:"latency"`
+}
+
+// RcodeRatio return the percent of queries sent with the rcode
+func (report *Report) RcodeRatio(rcode string) float64 {
+	if report.Sent == 0 {
+		return 0
+	}
+	return float64(report.Rcodes[rcode]*100) / float64(report.Sent)
+}
+
+// SuccessRatio return the percent of queries answered with NOERROR
+func (report *Report) SuccessRatio() float64 {
+	return report.RcodeRatio(dns.DNSRcodeReverse[dns.RcodeSuccess])
+}
+
+// TimeoutRatio return the percent of queries without response
+func (report *Report) TimeoutRatio() float64 {
+	if report.Sent == 0 {
+		return 0
+	}
+	return float64(report.Unknown*100) / float64(report.Sent)
+}
+
+// TimeoutRatio return the percent of queries of group without response
+func (result *GroupResult) TimeoutRatio() float64 {
+	if result.Sent == 0 {
+		return 0
+	}
+	return float64(result.Unknown*100) / float64(result.Sent)
+}
+
+// JSON return the report in json format
+func (report *Report) JSON() (string, error) {
+	data, err := json.MarshalIndent(report, "", "  ")
+	return string(data), err
+}
+
+// ParseReport parse the report in json format
+func ParseReport(data []byte) (*Report, error) {
+	report := &Report{}
+	if err := json.Unmarshal(data, report); err != nil {
+		return nil, fmt.Errorf("parse report fail: %s", err)
+	}
+	return report, nil
+}
+
+// LoadReportFromFile read the report saved in file
+func LoadReportFromFile(file string) (*Report, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return ParseReport(data)
+}
+
+// reportJob return the job config saved in report without the secret and
+// the capture data
+func reportJob(job *JobConfig) JobConfig {
+	saved := *job
+	saved.TSIGSecret = ""
+	saved.ReplayData = nil
+	return saved
+}
+
+// SetReport save the report of the last job
+func (config *AppController) SetReport(report *Report) {
+	config.Lock()
+	defer config.Unlock()
+	config.report = report
+}
+
+// LastReport return the report of the last job, nil when the job is
+// running or no report is generated
+func (config *AppController) LastReport() *Report {
+	config.RLock()
+	defer config.RUnlock()
+	return config.report
+}
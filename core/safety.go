@@ -0,0 +1,175 @@
+package core
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"strings"
+)
+
+// SafetyPolicy limit the dns servers the jobs can send to and the qps of
+// each server, it protects the servers out of the test environment from
+// a wrong server address. The empty policy allow any job
+type SafetyPolicy struct {
+	// AllowedTargets is the networks of the allowed server addresses,
+	// any address is allowed when empty
+	AllowedTargets []*net.IPNet
+	// MaxQPS is the maximum qps each server receive, 0 means no limit
+	MaxQPS uint32
+}
+
+// NewSafetyPolicy create the policy from the allowed networks separated by
+// comma or new line and the maximum qps of each server, the single ip
+// address is allowed as a network
+func NewSafetyPolicy(allowedTargets string, maxQPS uint32) (*SafetyPolicy, error) {
+	policy := &SafetyPolicy{MaxQPS: maxQPS}
+	for _, item := range strings.FieldsFunc(allowedTargets, func(r rune) bool {
+		return r == ',' || r == '\n' || r == '\r' || r == ' '
+	}) {
+		if !strings.Contains(item, "/") {
+			ip := net.ParseIP(item)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid allowed target %s", item)
+			}
+			if ip.To4() != nil {
+				item += "/32"
+			} else {
+				item += "/128"
+			}
+		}
+		_, network, err := net.ParseCIDR(item)
+		if err != nil {
+			return nil, fmt.Errorf("invalid allowed target %s", item)
+		}
+		policy.AllowedTargets = append(policy.AllowedTargets, network)
+	}
+	return policy, nil
+}
+
+// Enabled return true when the policy limit the jobs
+func (policy *SafetyPolicy) Enabled() bool {
+	return policy != nil && (len(policy.AllowedTargets) > 0 || policy.MaxQPS > 0)
+}
+
+// String return the readable policy
+func (policy *SafetyPolicy) String() string {
+	if !policy.Enabled() {
+		return "no limit"
+	}
+	var networks []string
+	for _, network := range policy.AllowedTargets {
+		networks = append(networks, network.String())
+	}
+	if len(networks) == 0 {
+		networks = append(networks, "any")
+	}
+	maxQPS := "no limit"
+	if policy.MaxQPS > 0 {
+		maxQPS = fmt.Sprint(policy.MaxQPS)
+	}
+	return fmt.Sprintf("allowed targets %s, max qps per target %s", strings.Join(networks, ","), maxQPS)
+}
+
+// CheckAddresses return error when any host:port address is not allowed
+func (policy *SafetyPolicy) CheckAddresses(addresses []string) error {
+	if policy == nil || len(policy.AllowedTargets) == 0 {
+		return nil
+	}
+	for _, address := range addresses {
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			host = address
+		}
+		if !policy.allowed(net.ParseIP(host)) {
+			return fmt.Errorf("safety policy: target %s is not in the allowed targets", host)
+		}
+	}
+	return nil
+}
+
+func (policy *SafetyPolicy) allowed(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, network := range policy.AllowedTargets {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Check return error when the job send to a server not allowed or exceed
+// the qps limit of a server, the nodes is the number of nodes running the
+// job at the same time
+func (policy *SafetyPolicy) Check(job *JobConfig, nodes int) error {
+	if !policy.Enabled() {
+		return nil
+	}
+	addresses, weights, err := resolveJobTargets(job)
+	if err != nil {
+		return fmt.Errorf("safety policy: resolve targets fail: %s", err)
+	}
+	if err := policy.CheckAddresses(addresses); err != nil {
+		return err
+	}
+	if policy.MaxQPS == 0 {
+		return nil
+	}
+	if job.JobType == JobTypeReplay && job.ReplayTiming != ReplayTimingQPS {
+		return fmt.Errorf("safety policy: replay with %s timing can't be limited to %d qps, use qps timing", ReplayTimingOriginal, policy.MaxQPS)
+	}
+	if nodes < 1 {
+		nodes = 1
+	}
+	qps := targetQPS(job, addresses, weights) * float64(nodes)
+	if qps > float64(policy.MaxQPS) {
+		return fmt.Errorf("safety policy: %.0f qps per target from %d nodes exceed the limit %d", math.Ceil(qps), nodes, policy.MaxQPS)
+	}
+	return nil
+}
+
+// targetQPS return the highest qps a target of job receive from one node.
+// The qname policy may send all queries to one target
+func targetQPS(job *JobConfig, addresses []string, weights map[string]int) float64 {
+	qps := float64(job.QPS)
+	if len(addresses) <= 1 {
+		return qps
+	}
+	switch job.TargetPolicy {
+	case TargetPolicyQname:
+		return qps
+	case TargetPolicyWeighted:
+		var total, highest int
+		for _, address := range addresses {
+			weight := weights[address]
+			if weight <= 0 {
+				weight = 1
+			}
+			total += weight
+			if weight > highest {
+				highest = weight
+			}
+		}
+		return qps * float64(highest) / float64(total)
+	default:
+		// each target has client number connections of its own, the
+		// qps is spread evenly over the targets
+		return qps / float64(len(addresses))
+	}
+}
+
+// senders return the number of nodes running the job, the master run the
+// job itself and send it to all enabled agents
+func senders(app *AppController) int {
+	if app == nil || !app.IsMaster || nodeManager == nil {
+		return 1
+	}
+	count := 1
+	for _, info := range nodeManager.NodeInfos {
+		if info.Enable {
+			count++
+		}
+	}
+	return count
+}
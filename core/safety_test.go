@@ -0,0 +1,66 @@
+package core
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNewSafetyPolicy(t *testing.T) {
+	policy, err := NewSafetyPolicy("192.0.2.0/24, 198.51.100.53\n2001:db8::/32", 1000)
+	OK(t, err)
+	Equals(t, 3, len(policy.AllowedTargets))
+	Equals(t, "198.51.100.53/32", policy.AllowedTargets[1].String())
+	Assert(t, policy.Enabled(), "policy should be enabled")
+
+	policy, err = NewSafetyPolicy("", 0)
+	OK(t, err)
+	Assert(t, !policy.Enabled(), "empty policy should not be enabled")
+	var none *SafetyPolicy
+	OK(t, none.Check(&JobConfig{Server: "203.0.113.1"}, 1))
+
+	_, err = NewSafetyPolicy("192.0.2.0/33", 0)
+	Assert(t, err != nil, "expect error for invalid network")
+	_, err = NewSafetyPolicy("ns.example.com", 0)
+	Assert(t, err != nil, "expect error for hostname")
+}
+
+func TestSafetyPolicyCheckAddresses(t *testing.T) {
+	policy, err := NewSafetyPolicy("192.0.2.0/24,2001:db8::/32", 0)
+	OK(t, err)
+	OK(t, policy.CheckAddresses([]string{"192.0.2.1:53", "[2001:db8::1]:53"}))
+	err = policy.CheckAddresses([]string{"192.0.2.1:53", "203.0.113.1:53"})
+	Assert(t, err != nil && strings.Contains(err.Error(), "203.0.113.1"), "expect error for 203.0.113.1, got %v", err)
+
+	job := &JobConfig{Server: "203.0.113.1", Port: "53"}
+	Assert(t, policy.Check(job, 1) != nil, "expect error for the server out of allowed targets")
+	job.Server = "192.0.2.1"
+	OK(t, policy.Check(job, 1))
+}
+
+func TestSafetyPolicyMaxQPS(t *testing.T) {
+	policy, err := NewSafetyPolicy("", 1000)
+	OK(t, err)
+	job := &JobConfig{Server: "192.0.2.1", Port: "53", QPS: 1000, ClientNumber: 4}
+	OK(t, policy.Check(job, 1))
+	Assert(t, policy.Check(job, 2) != nil, "expect error for 2 nodes")
+
+	// round robin spread the qps over the targets
+	job = &JobConfig{TargetList: "192.0.2.1,192.0.2.2", Port: "53", QPS: 2000, ClientNumber: 2}
+	OK(t, policy.Check(job, 1))
+	// every target has its own connection
+	job.ClientNumber = 1
+	OK(t, policy.Check(job, 1))
+	job.ClientNumber = 2
+	job.TargetPolicy = TargetPolicyQname
+	Assert(t, policy.Check(job, 1) != nil, "expect error for qname policy")
+	job.TargetPolicy = TargetPolicyWeighted
+	job.TargetList = "192.0.2.1=3,192.0.2.2"
+	Assert(t, policy.Check(job, 1) != nil, "expect error for the target with weight 3")
+	job.QPS = 1200
+	OK(t, policy.Check(job, 1))
+
+	job = &JobConfig{JobType: JobTypeReplay, Server: "192.0.2.1", Port: "53", QPS: 100}
+	Assert(t, policy.Check(job, 1) != nil, "expect error for original replay timing")
+	job.ReplayTiming = ReplayTimingQPS
+	OK(t, policy.Check(job, 1))
+}
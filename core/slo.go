@@ -0,0 +1,272 @@
+package core
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/zhangmingkai4315/dns-loader/dns"
+)
+
+// assertionOperators is the comparison operators of assertions, the two
+// characters operators must be matched first
+var assertionOperators = []string{">=", "<=", "==", "!=", ">", "<"}
+
+// latencyMetrics is the latency metrics of assertions
+var latencyMetrics = map[string]func(summary LatencySummary) time.Duration{
+	"latency_mean": func(summary LatencySummary) time.Duration { return summary.Mean },
+	"p50":          func(summary LatencySummary) time.Duration { return summary.P50 },
+	"p90":          func(summary LatencySummary) time.Duration { return summary.P90 },
+	"p99":          func(summary LatencySummary) time.Duration { return summary.P99 },
+	"latency_max":  func(summary LatencySummary) time.Duration { return summary.Max },
+}
+
+// Assertion is a condition the result of job must meet, like
+// "success_ratio >= 99.9", "p99 <= 20ms" or "achieved_qps >= 0.95 * target"
+type Assertion struct {
+	Text     string
+	Metric   string
+	Operator string
+	Value    float64
+	// Target is true when the value is a factor of the target qps
+	Target bool
+}
+
+// ParseAssertions parse the assertions separated by comma or new line.
+// The metrics are success_ratio, timeout_ratio, <rcode>_ratio (e.g.
+// servfail_ratio) in percent, achieved_qps, sent, received, mismatches
+// and the latency p50, p90, p99, latency_mean and latency_max with unit
+// like 20ms. The value of achieved_qps can be [factor *] target
+func ParseAssertions(text string) ([]Assertion, error) {
+	var assertions []Assertion
+	for _, item := range strings.FieldsFunc(text, func(r rune) bool {
+		return r == ',' || r == '\n' || r == '\r'
+	}) {
+		item = strings.TrimSpace(item)
+		if item == "" || strings.HasPrefix(item, "#") {
+			continue
+		}
+		assertion, err := parseAssertion(item)
+		if err != nil {
+			return nil, err
+		}
+		assertions = append(assertions, assertion)
+	}
+	return assertions, nil
+}
+
+func parseAssertion(text string) (Assertion, error) {
+	assertion := Assertion{Text: text}
+	for _, operator := range assertionOperators {
+		if index := strings.Index(text, operator); index > 0 {
+			assertion.Operator = operator
+			assertion.Metric = strings.ToLower(strings.TrimSpace(text[:index]))
+			text = strings.TrimSpace(text[index+len(operator):])
+			break
+		}
+	}
+	if assertion.Operator == "" {
+		return assertion, fmt.Errorf("invalid assertion %s: no operator", assertion.Text)
+	}
+	if !assertionMetric(assertion.Metric) {
+		return assertion, fmt.Errorf("invalid assertion %s: unknown metric %s", assertion.Text, assertion.Metric)
+	}
+	if _, ok := latencyMetrics[assertion.Metric]; ok {
+		duration, err := time.ParseDuration(text)
+		if err != nil {
+			return assertion, fmt.Errorf("invalid assertion %s: latency need unit like 20ms", assertion.Text)
+		}
+		assertion.Value = float64(duration)
+		return assertion, nil
+	}
+	if strings.HasSuffix(strings.ToLower(text), "target") {
+		if assertion.Metric != "achieved_qps" {
+			return assertion, fmt.Errorf("invalid assertion %s: only achieved_qps can compare with target", assertion.Text)
+		}
+		assertion.Target = true
+		text = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(text[:len(text)-len("target")]), "*"))
+		if text == "" {
+			text = "1"
+		}
+	}
+	value, err := strconv.ParseFloat(strings.TrimSuffix(text, "%"), 64)
+	if err != nil {
+		return assertion, fmt.Errorf("invalid assertion %s: invalid value %s", assertion.Text, text)
+	}
+	assertion.Value = value
+	return assertion, nil
+}
+
+// assertionMetric return true when the metric is supported
+func assertionMetric(metric string) bool {
+	switch metric {
+	case "success_ratio", "timeout_ratio", "achieved_qps", "sent", "received", "mismatches":
+		return true
+	}
+	if _, ok := latencyMetrics[metric]; ok {
+		return true
+	}
+	_, ok := rcodeNames[strings.ToUpper(strings.TrimSuffix(metric, "_ratio"))]
+	return ok && strings.HasSuffix(metric, "_ratio")
+}
+
+// AssertionResult is the result of an assertion
+type AssertionResult struct {
+	Assertion string `json:"assertion"`
+	Value     string `json:"value"`
+	Passed    bool   `json:"passed"`
+}
+
+// Evaluate check the assertion with the report
+func (assertion Assertion) Evaluate(report *Report) AssertionResult {
+	var value float64
+	var text string
+	switch assertion.Metric {
+	case "success_ratio":
+		value = report.SuccessRatio()
+	case "timeout_ratio":
+		value = report.TimeoutRatio()
+	case "achieved_qps":
+		value = report.QPS
+	case "sent":
+		value = float64(report.Sent)
+	case "received":
+		value = float64(report.Received)
+	case "mismatches":
+		for _, count := range report.Mismatches {
+			value += float64(count)
+		}
+	default:
+		if latency, ok := latencyMetrics[assertion.Metric]; ok {
+			value = float64(latency(report.Latency))
+			text = time.Duration(value).String()
+		} else {
+			code := rcodeNames[strings.ToUpper(strings.TrimSuffix(assertion.Metric, "_ratio"))]
+			value = report.RcodeRatio(dns.DNSRcodeReverse[uint8(code)])
+		}
+	}
+	if text == "" {
+		text = strconv.FormatFloat(value, 'f', 2, 64)
+	}
+	expected := assertion.Value
+	if assertion.Target {
+		expected *= float64(report.TargetQPS)
+		text += fmt.Sprintf(" (target %.2f)", expected)
+	}
+	var passed bool
+	switch assertion.Operator {
+	case ">=":
+		passed = value >= expected
+	case "<=":
+		passed = value <= expected
+	case ">":
+		passed = value > expected
+	case "<":
+		passed = value < expected
+	case "==":
+		passed = value == expected
+	case "!=":
+		passed = value != expected
+	}
+	return AssertionResult{Assertion: assertion.Text, Value: text, Passed: passed}
+}
+
+// EvaluateAssertions check the assertions of job with the report, the
+// results are saved in report and logged
+func EvaluateAssertions(assertions []Assertion, report *Report) bool {
+	result := log.WithFields(log.Fields{"result": true})
+	passed := true
+	for _, assertion := range assertions {
+		evaluated := assertion.Evaluate(report)
+		report.Assertions = append(report.Assertions, evaluated)
+		status := "pass"
+		if !evaluated.Passed {
+			status = "fail"
+			passed = false
+		}
+		result.Infof("assertion %s: %s [%s]", evaluated.Assertion, status, evaluated.Value)
+	}
+	return passed
+}
+
+// evaluateJobAssertions check the assertions of job with the report of
+// job and log whether the slo passed
+func evaluateJobAssertions(job *JobConfig, report *Report) {
+	assertions, _ := ParseAssertions(job.Assertions)
+	if len(assertions) == 0 {
+		return
+	}
+	if EvaluateAssertions(assertions, report) {
+		log.WithFields(log.Fields{"result": true}).Infof("slo passed")
+	} else {
+		log.WithFields(log.Fields{"result": true}).Infof("slo failed")
+	}
+}
+
+// Passed return false when any assertion of report failed
+func (report *Report) Passed() bool {
+	for _, assertion := range report.Assertions {
+		if !assertion.Passed {
+			return false
+		}
+	}
+	return true
+}
+
+// junitTestSuite is the JUnit XML format of assertion results
+type junitTestSuite struct {
+	XMLName   xml.Name        `xml:"testsuite"`
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Time      float64         `xml:"time,attr"`
+	Timestamp string          `xml:"timestamp,attr"`
+	TestCases []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// WriteJUnit write the assertion results of report in JUnit XML format
+func (report *Report) WriteJUnit(w io.Writer) error {
+	suite := junitTestSuite{
+		Name:      "dns-loader",
+		Tests:     len(report.Assertions),
+		Time:      report.RunningTime.Seconds(),
+		Timestamp: report.StartTime.Format("2006-01-02T15:04:05"),
+	}
+	for _, assertion := range report.Assertions {
+		testCase := junitTestCase{Name: assertion.Assertion, ClassName: "dns-loader.slo"}
+		if !assertion.Passed {
+			suite.Failures++
+			testCase.Failure = &junitFailure{
+				Message: "assertion failed, got " + assertion.Value,
+				Text:    fmt.Sprintf("%s: got %s", assertion.Assertion, assertion.Value),
+			}
+		}
+		suite.TestCases = append(suite.TestCases, testCase)
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(suite); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,49 @@
+package core
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseAssertions(t *testing.T) {
+	assertions, err := ParseAssertions("success_ratio >= 99.9, p99 <= 20ms\nachieved_qps>=0.95 * target\nservfail_ratio < 0.1%")
+	OK(t, err)
+	Equals(t, 4, len(assertions))
+	Equals(t, Assertion{Text: "success_ratio >= 99.9", Metric: "success_ratio", Operator: ">=", Value: 99.9}, assertions[0])
+	Equals(t, float64(20*time.Millisecond), assertions[1].Value)
+	Equals(t, Assertion{Text: "achieved_qps>=0.95 * target", Metric: "achieved_qps", Operator: ">=", Value: 0.95, Target: true}, assertions[2])
+	Equals(t, "<", assertions[3].Operator)
+
+	for _, invalid := range []string{"success_ratio 99", "unknown >= 1", "p99 <= 20", "sent >= target", "success_ratio >= high"} {
+		_, err := ParseAssertions(invalid)
+		Assert(t, err != nil, "expect error for %s", invalid)
+	}
+}
+
+func TestEvaluateAssertions(t *testing.T) {
+	report := &Report{
+		TargetQPS: 1000,
+		QPS:       980,
+		Sent:      10000,
+		Rcodes:    map[string]uint64{"Success": 9995, "ServerFail": 3},
+		Unknown:   2,
+		Latency:   LatencySummary{P99: 25 * time.Millisecond},
+	}
+	assertions, err := ParseAssertions("success_ratio >= 99.9, servfail_ratio <= 0.05, achieved_qps >= 0.95 * target, p99 <= 20ms")
+	OK(t, err)
+	Equals(t, false, EvaluateAssertions(assertions, report))
+	Equals(t, []AssertionResult{
+		{Assertion: "success_ratio >= 99.9", Value: "99.95", Passed: true},
+		{Assertion: "servfail_ratio <= 0.05", Value: "0.03", Passed: true},
+		{Assertion: "achieved_qps >= 0.95 * target", Value: "980.00 (target 950.00)", Passed: true},
+		{Assertion: "p99 <= 20ms", Value: "25ms", Passed: false},
+	}, report.Assertions)
+	Equals(t, false, report.Passed())
+
+	var junit bytes.Buffer
+	OK(t, report.WriteJUnit(&junit))
+	Assert(t, strings.Contains(junit.String(), `<testsuite name="dns-loader" tests="4" failures="1"`), "unexpected junit %s", junit.String())
+	Assert(t, strings.Contains(junit.String(), `<failure message="assertion failed, got 25ms">`), "unexpected junit %s", junit.String())
+}
@@ -0,0 +1,334 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ClientConn is a connection of dns client with the labels of source
+// and target address used for the result breakdown
+type ClientConn struct {
+	net.Conn
+	Source string
+	Target string
+	// redial open a new connection to the target from the same source,
+	// it is set when the targets are re-resolved periodically
+	redial func(target string) (*ClientConn, error)
+	// lock guard the Target changed by re-resolve while the job running
+	lock sync.RWMutex
+}
+
+// target return the address the connection is sending to
+func (conn *ClientConn) target() string {
+	conn.lock.RLock()
+	defer conn.lock.RUnlock()
+	return conn.Target
+}
+
+// moveTo switch the connection to next which is connected to target
+func (conn *ClientConn) moveTo(next net.Conn, target string) {
+	conn.lock.Lock()
+	defer conn.lock.Unlock()
+	conn.Conn.(*switchConn).swap(next)
+	conn.Target = target
+}
+
+// current return the underlying connection in use
+func (conn *ClientConn) current() net.Conn {
+	if switchable, ok := conn.Conn.(*switchConn); ok {
+		return switchable.current()
+	}
+	return conn.Conn
+}
+
+// switchConn is a connection which can be moved to another address
+// while it is used, the old connection is closed after the switch
+type switchConn struct {
+	conn atomic.Value
+}
+
+func newSwitchConn(conn net.Conn) *switchConn {
+	switchable := &switchConn{}
+	switchable.conn.Store(&conn)
+	return switchable
+}
+
+func (conn *switchConn) current() net.Conn {
+	return *conn.conn.Load().(*net.Conn)
+}
+
+// swap replace the connection and close the old one
+func (conn *switchConn) swap(next net.Conn) {
+	old := conn.current()
+	conn.conn.Store(&next)
+	old.Close()
+}
+
+func (conn *switchConn) Read(b []byte) (int, error) {
+	return conn.current().Read(b)
+}
+
+func (conn *switchConn) Write(b []byte) (int, error) {
+	return conn.current().Write(b)
+}
+
+func (conn *switchConn) Close() error {
+	return conn.current().Close()
+}
+
+func (conn *switchConn) LocalAddr() net.Addr {
+	return conn.current().LocalAddr()
+}
+
+func (conn *switchConn) RemoteAddr() net.Addr {
+	return conn.current().RemoteAddr()
+}
+
+func (conn *switchConn) SetDeadline(t time.Time) error {
+	return conn.current().SetDeadline(t)
+}
+
+func (conn *switchConn) SetReadDeadline(t time.Time) error {
+	return conn.current().SetReadDeadline(t)
+}
+
+func (conn *switchConn) SetWriteDeadline(t time.Time) error {
+	return conn.current().SetWriteDeadline(t)
+}
+
+// ParseSourceIPs return the local addresses from a comma separated list
+// of ip addresses or interface names
+func ParseSourceIPs(sources string) ([]net.IP, error) {
+	var ips []net.IP
+	for _, item := range strings.Split(sources, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if ip := net.ParseIP(item); ip != nil {
+			ips = append(ips, ip)
+			continue
+		}
+		iface, err := net.InterfaceByName(item)
+		if err != nil {
+			return nil, fmt.Errorf("invalid source ip or interface %s", item)
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			return nil, err
+		}
+		for _, addr := range addrs {
+			if ipnet, ok := addr.(*net.IPNet); ok && !ipnet.IP.IsLinkLocalUnicast() {
+				ips = append(ips, ipnet.IP)
+			}
+		}
+	}
+	return ips, nil
+}
+
+// sourcesForTarget return the source ips of the same family as target
+func sourcesForTarget(sources []net.IP, target net.IP) []net.IP {
+	var result []net.IP
+	for _, source := range sources {
+		if (source.To4() != nil) == (target.To4() != nil) {
+			result = append(result, source)
+		}
+	}
+	return result
+}
+
+// dialFrom open a connection to the target from the source ip, the
+// source can be nil to let system select it
+func dialFrom(protocol string, source net.IP, target string) (*ClientConn, error) {
+	dialer := net.Dialer{Timeout: 5 * time.Second}
+	if source != nil {
+		if protocol == "tcp" {
+			dialer.LocalAddr = &net.TCPAddr{IP: source}
+		} else {
+			dialer.LocalAddr = &net.UDPAddr{IP: source}
+		}
+	}
+	conn, err := dialer.Dial(protocol, target)
+	if err != nil {
+		return nil, err
+	}
+	host, _, _ := net.SplitHostPort(conn.LocalAddr().String())
+	return &ClientConn{Conn: conn, Source: host, Target: target}, nil
+}
+
+// unconnectedConn send each query with WriteTo on an unconnected udp
+// socket, only the responses from target are returned by Read
+type unconnectedConn struct {
+	*net.UDPConn
+	target *net.UDPAddr
+}
+
+// listenFrom open an unconnected udp socket on the source ip
+func listenFrom(source net.IP, target string) (*ClientConn, error) {
+	targetAddr, err := net.ResolveUDPAddr("udp", target)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: source})
+	if err != nil {
+		return nil, err
+	}
+	return &ClientConn{
+		Conn:   &unconnectedConn{UDPConn: conn, target: targetAddr},
+		Source: source.String(),
+		Target: target,
+	}, nil
+}
+
+func (conn *unconnectedConn) Write(b []byte) (int, error) {
+	return conn.WriteToUDP(b, conn.target)
+}
+
+func (conn *unconnectedConn) Read(b []byte) (int, error) {
+	for {
+		n, addr, err := conn.ReadFromUDP(b)
+		if err != nil {
+			return n, err
+		}
+		if addr.Port == conn.target.Port && addr.IP.Equal(conn.target.IP) {
+			return n, nil
+		}
+	}
+}
+
+func (conn *unconnectedConn) RemoteAddr() net.Addr {
+	return conn.target
+}
+
+// dialSources open the connections of job to the targets, the client
+// number of job is the number of connections to each target. In
+// connection policy each
+// connection use the source ips of the target family in turn, in query
+// policy an unconnected udp socket is opened for each source ip and the
+// queries are sent from them in turn
+func dialSources(job *JobConfig, targets []string) ([]*ClientConn, error) {
+	var all []net.IP
+	if job.SourceIPs != "" {
+		var err error
+		all, err = ParseSourceIPs(job.SourceIPs)
+		if err != nil {
+			return nil, err
+		}
+	}
+	sources := make(map[string][]net.IP)
+	for _, target := range targets {
+		if all == nil {
+			continue
+		}
+		targetAddr, err := net.ResolveIPAddr("ip", hostOf(target))
+		if err != nil {
+			return nil, err
+		}
+		sources[target] = sourcesForTarget(all, targetAddr.IP)
+		if len(sources[target]) == 0 {
+			return nil, errors.New("no source ip in the same family as target " + target)
+		}
+	}
+	var conns []*ClientConn
+	if job.SourcePolicy == SourcePolicyQuery && all != nil {
+		if job.Protocol != "udp" {
+			return nil, errors.New("per query source policy only support udp")
+		}
+		for _, target := range targets {
+			for _, source := range sources[target] {
+				conn, err := dialTarget(job, source, target, 0)
+				if err != nil {
+					return nil, err
+				}
+				conns = append(conns, conn)
+			}
+		}
+		return conns, nil
+	}
+	clientNumber := job.ClientNumber
+	if clientNumber <= 0 {
+		clientNumber = 1
+	}
+	clientNumber *= len(targets)
+	for i := 0; i < clientNumber; i++ {
+		target := targets[i%len(targets)]
+		var source net.IP
+		if targetSources := sources[target]; len(targetSources) > 0 {
+			source = targetSources[i/len(targets)%len(targetSources)]
+		}
+		conn, err := dialTarget(job, source, target, clientNumber)
+		if err != nil {
+			return nil, err
+		}
+		conns = append(conns, conn)
+	}
+	return conns, nil
+}
+
+// dialTarget open a connection of job to the target from the source,
+// the connection can be moved to new address when the targets are
+// re-resolved periodically
+func dialTarget(job *JobConfig, source net.IP, target string, clientNumber int) (*ClientConn, error) {
+	dial := func(target string) (*ClientConn, error) {
+		switch {
+		case job.SourcePolicy == SourcePolicyQuery && source != nil:
+			return listenFrom(source, target)
+		case job.EphemeralQueries > 0:
+			return dialEphemeral(job, source, target, clientNumber)
+		default:
+			return dialFrom(job.Protocol, source, target)
+		}
+	}
+	conn, err := dial(target)
+	if err != nil || job.ResolveInterval == "" {
+		return conn, err
+	}
+	conn.Conn = newSwitchConn(conn.Conn)
+	conn.redial = func(target string) (*ClientConn, error) {
+		if source != nil {
+			targetAddr, err := net.ResolveIPAddr("ip", hostOf(target))
+			if err != nil {
+				return nil, err
+			}
+			if (source.To4() != nil) != (targetAddr.IP.To4() != nil) {
+				return nil, errors.New("source ip " + source.String() + " is not in the same family as target " + target)
+			}
+		}
+		return dial(target)
+	}
+	return conn, nil
+}
+
+// dialEphemeral create a connection which open new sockets for queries,
+// the fd budget of job is shared by all connections
+func dialEphemeral(job *JobConfig, source net.IP, target string, clientNumber int) (*ClientConn, error) {
+	if job.Protocol != "udp" {
+		return nil, errors.New("ephemeral sockets only support udp")
+	}
+	budget := job.FDBudget
+	if budget <= 0 {
+		budget = DefaultFDBudget
+	}
+	conn, err := newEphemeralConn(source, target, job.EphemeralQueries, budget/clientNumber)
+	if err != nil {
+		return nil, err
+	}
+	label := "any"
+	if source != nil {
+		label = source.String()
+	}
+	return &ClientConn{Conn: conn, Source: label, Target: target}, nil
+}
+
+func hostOf(address string) string {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return address
+	}
+	return host
+}
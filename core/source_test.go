@@ -0,0 +1,49 @@
+package core
+
+import (
+	"net"
+	"testing"
+)
+
+func TestParseSourceIPs(t *testing.T) {
+	ips, err := ParseSourceIPs("127.0.0.1, ::1")
+	OK(t, err)
+	Equals(t, 2, len(ips))
+	Equals(t, 1, len(sourcesForTarget(ips, net.ParseIP("192.0.2.1"))))
+	Equals(t, 1, len(sourcesForTarget(ips, net.ParseIP("2001:db8::1"))))
+	_, err = ParseSourceIPs("not-an-interface")
+	Assert(t, err != nil, "expect error for invalid source")
+}
+
+func TestDialSources(t *testing.T) {
+	server, err := net.ListenPacket("udp", "127.0.0.1:0")
+	OK(t, err)
+	defer server.Close()
+	job := NewDefaultJobConfig()
+	job.ClientNumber = 3
+	job.SourceIPs = "127.0.0.1,127.0.0.2"
+	conns, err := dialSources(job, []string{server.LocalAddr().String()})
+	OK(t, err)
+	Equals(t, 3, len(conns))
+	Equals(t, "127.0.0.1", conns[0].Source)
+	Equals(t, "127.0.0.2", conns[1].Source)
+	Equals(t, "127.0.0.1", conns[2].Source)
+
+	job.SourcePolicy = SourcePolicyQuery
+	conns, err = dialSources(job, []string{server.LocalAddr().String()})
+	OK(t, err)
+	Equals(t, 2, len(conns))
+	buf := make([]byte, 512)
+	for _, conn := range conns {
+		_, err := conn.Write([]byte("query"))
+		OK(t, err)
+		n, addr, err := server.ReadFrom(buf)
+		OK(t, err)
+		Equals(t, conn.Source, addr.(*net.UDPAddr).IP.String())
+		server.WriteTo(buf[:n], addr)
+		n, err = conn.Read(buf)
+		OK(t, err)
+		Equals(t, "query", string(buf[:n]))
+		conn.Close()
+	}
+}
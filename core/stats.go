@@ -0,0 +1,189 @@
+package core
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/zhangmingkai4315/dns-loader/dns"
+)
+
+// responseSizeBuckets is the upper bound of the response size buckets, the
+// bounds are the common udp payload sizes so the buckets show how many
+// responses would be truncated with each size
+var responseSizeBuckets = []int{128, 256, 512, 1232, 1452, 4096, 65535}
+
+// ResponseStats record the size, the section counts, the OPT record and
+// the flags of responses, it is safe for concurrent use
+type ResponseStats struct {
+	lock       sync.Mutex
+	responses  uint64
+	malformed  uint64
+	sizeSum    uint64
+	sizeMin    int
+	sizeMax    int
+	sizes      []uint64
+	answer     uint64
+	authority  uint64
+	additional uint64
+	opt        uint64
+	udpSizes   map[uint16]uint64
+	do         uint64
+	ad         uint64
+	tc         uint64
+}
+
+// NewResponseStats create the empty response statistics
+func NewResponseStats() *ResponseStats {
+	return &ResponseStats{
+		sizes:    make([]uint64, len(responseSizeBuckets)),
+		udpSizes: make(map[uint16]uint64),
+	}
+}
+
+// Record add the response to statistics
+func (stats *ResponseStats) Record(msg []byte) {
+	info, err := dns.ScanMessage(msg)
+	bucket := sort.SearchInts(responseSizeBuckets, len(msg))
+	stats.lock.Lock()
+	defer stats.lock.Unlock()
+	if stats.responses == 0 || len(msg) < stats.sizeMin {
+		stats.sizeMin = len(msg)
+	}
+	if len(msg) > stats.sizeMax {
+		stats.sizeMax = len(msg)
+	}
+	stats.responses++
+	stats.sizeSum += uint64(len(msg))
+	stats.sizes[bucket]++
+	if len(msg) > 3 {
+		if msg[2]&0x02 != 0 {
+			stats.tc++
+		}
+		if msg[3]&0x20 != 0 {
+			stats.ad++
+		}
+	}
+	if err != nil {
+		stats.malformed++
+		return
+	}
+	stats.answer += uint64(info.Answer)
+	stats.authority += uint64(info.Authority)
+	stats.additional += uint64(info.Additional)
+	if info.OPT {
+		stats.opt++
+		stats.udpSizes[info.UDPSize]++
+		if info.DO {
+			stats.do++
+		}
+	}
+}
+
+// Truncated return the number of responses with TC flag
+func (stats *ResponseStats) Truncated() uint64 {
+	stats.lock.Lock()
+	defer stats.lock.Unlock()
+	return stats.tc
+}
+
+// ResponseSummary hold the response statistics, the section counts are
+// the average number of records per response
+type ResponseSummary struct {
+	Responses   uint64            `json:"responses"`
+	Malformed   uint64            `json:"malformed"`
+	SizeMin     int               `json:"size_min"`
+	SizeMean    int               `json:"size_mean"`
+	SizeMax     int               `json:"size_max"`
+	SizeBuckets map[string]uint64 `json:"size_buckets"`
+	Answer      float64           `json:"answer"`
+	Authority   float64           `json:"authority"`
+	Additional  float64           `json:"additional"`
+	OPT         uint64            `json:"opt"`
+	UDPSizes    map[string]uint64 `json:"udp_sizes"`
+	DO          uint64            `json:"do"`
+	AD          uint64            `json:"ad"`
+	TC          uint64            `json:"tc"`
+}
+
+// Summary return the statistics of recorded responses
+func (stats *ResponseStats) Summary() ResponseSummary {
+	stats.lock.Lock()
+	defer stats.lock.Unlock()
+	summary := ResponseSummary{
+		Responses:   stats.responses,
+		Malformed:   stats.malformed,
+		SizeMin:     stats.sizeMin,
+		SizeMax:     stats.sizeMax,
+		SizeBuckets: make(map[string]uint64),
+		OPT:         stats.opt,
+		UDPSizes:    make(map[string]uint64),
+		DO:          stats.do,
+		AD:          stats.ad,
+		TC:          stats.tc,
+	}
+	for i, count := range stats.sizes {
+		if count > 0 {
+			summary.SizeBuckets[sizeBucketName(i)] = count
+		}
+	}
+	for size, count := range stats.udpSizes {
+		summary.UDPSizes[strconv.Itoa(int(size))] = count
+	}
+	if stats.responses > 0 {
+		summary.SizeMean = int(stats.sizeSum / stats.responses)
+	}
+	if parsed := stats.responses - stats.malformed; parsed > 0 {
+		summary.Answer = float64(stats.answer) / float64(parsed)
+		summary.Authority = float64(stats.authority) / float64(parsed)
+		summary.Additional = float64(stats.additional) / float64(parsed)
+	}
+	return summary
+}
+
+func sizeBucketName(bucket int) string {
+	if bucket == len(responseSizeBuckets)-1 {
+		return ">" + strconv.Itoa(responseSizeBuckets[bucket-1])
+	}
+	return "<=" + strconv.Itoa(responseSizeBuckets[bucket])
+}
+
+// Report log the response statistics
+func (stats *ResponseStats) Report() {
+	summary := stats.Summary()
+	if summary.Responses == 0 {
+		return
+	}
+	result := log.WithFields(log.Fields{"result": true})
+	percent := func(count uint64) float64 {
+		return float64(count*100) / float64(summary.Responses)
+	}
+	result.Infof("response size min:%d mean:%d max:%d", summary.SizeMin, summary.SizeMean, summary.SizeMax)
+	var buckets []string
+	for i := range responseSizeBuckets {
+		name := sizeBucketName(i)
+		if count, ok := summary.SizeBuckets[name]; ok {
+			buckets = append(buckets, fmt.Sprintf("%s:%d", name, count))
+		}
+	}
+	result.Infof("response size %s", strings.Join(buckets, " "))
+	result.Infof("records per response answer:%.2f authority:%.2f additional:%.2f malformed:%d",
+		summary.Answer, summary.Authority, summary.Additional, summary.Malformed)
+	var sizes []int
+	for size := range summary.UDPSizes {
+		value, _ := strconv.Atoi(size)
+		sizes = append(sizes, value)
+	}
+	sort.Ints(sizes)
+	var udpSizes []string
+	for _, size := range sizes {
+		udpSizes = append(udpSizes, fmt.Sprintf("%d:%d", size, summary.UDPSizes[strconv.Itoa(size)]))
+	}
+	result.Infof("response opt:%d [%.2f] payload size %s", summary.OPT, percent(summary.OPT), strings.Join(udpSizes, " "))
+	result.Infof("response flags do:%d [%.2f] ad:%d [%.2f] tc:%d [%.2f]", summary.DO, percent(summary.DO),
+		summary.AD, percent(summary.AD), summary.TC, percent(summary.TC))
+}
@@ -0,0 +1,45 @@
+package core
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/zhangmingkai4315/dns-loader/dns"
+)
+
+func TestResponseStats(t *testing.T) {
+	packet := new(dns.Packet)
+	packet.SetQuestion("www.example.com.", dns.TypeA)
+	query, err := packet.ToBytes()
+	OK(t, err)
+	stats := NewResponseStats()
+
+	stats.Record(buildTestResponse(query, 0, []byte{192, 0, 2, 1}, []byte{192, 0, 2, 2}))
+	// response with AD flag and OPT of payload size 1232 with DO bit
+	edns := buildTestResponse(query, 0, []byte{192, 0, 2, 1})
+	edns[3] |= 0x20
+	binary.BigEndian.PutUint16(edns[10:], 1)
+	edns = append(edns, 0, 0, 41, 0x04, 0xd0, 0, 0, 0x80, 0, 0, 0)
+	stats.Record(edns)
+	truncated := buildTestResponse(query, 0)
+	truncated[2] |= 0x02
+	stats.Record(truncated)
+	malformed := make([]byte, 600)
+	malformed[5], malformed[12] = 1, 0x80
+	stats.Record(malformed)
+
+	summary := stats.Summary()
+	Equals(t, uint64(4), summary.Responses)
+	Equals(t, uint64(1), summary.Malformed)
+	Equals(t, len(truncated), summary.SizeMin)
+	Equals(t, 600, summary.SizeMax)
+	Equals(t, map[string]uint64{"<=128": 3, "<=1232": 1}, summary.SizeBuckets)
+	Equals(t, 1.0, summary.Answer)
+	Equals(t, 1.0/3, summary.Additional)
+	Equals(t, uint64(1), summary.OPT)
+	Equals(t, map[string]uint64{"1232": 1}, summary.UDPSizes)
+	Equals(t, uint64(1), summary.DO)
+	Equals(t, uint64(1), summary.AD)
+	Equals(t, uint64(1), summary.TC)
+	Equals(t, uint64(1), stats.Truncated())
+}
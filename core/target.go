@@ -0,0 +1,326 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/asaskevich/govalidator"
+)
+
+// lookup functions are replaced in tests to resolve without dns
+var (
+	lookupIP  = net.LookupIP
+	lookupNS  = net.LookupNS
+	lookupSRV = net.LookupSRV
+)
+
+// ResolveTargets return the host:port addresses of the server selected by
+// the address family, a hostname is resolved and an ip address is used as
+// it is. The ipv6 address can be written in brackets
+func ResolveTargets(server, port, family string) ([]string, error) {
+	server = strings.TrimSuffix(strings.TrimPrefix(server, "["), "]")
+	if server == "" {
+		return nil, fmt.Errorf("dns server is empty")
+	}
+	var ips []net.IP
+	if ip := net.ParseIP(server); ip != nil {
+		ips = []net.IP{ip}
+	} else {
+		var err error
+		ips, err = lookupIP(server)
+		if err != nil {
+			return nil, err
+		}
+	}
+	var ipv4, ipv6 net.IP
+	for _, ip := range ips {
+		if ip.To4() != nil && ipv4 == nil {
+			ipv4 = ip
+		}
+		if ip.To4() == nil && ipv6 == nil {
+			ipv6 = ip
+		}
+	}
+	var selected []net.IP
+	switch family {
+	case AddressFamilyIPv4:
+		selected = []net.IP{ipv4}
+	case AddressFamilyIPv6:
+		selected = []net.IP{ipv6}
+	case AddressFamilyAlternate:
+		selected = []net.IP{ipv4, ipv6}
+	default:
+		if len(ips) > 0 {
+			selected = []net.IP{ips[0]}
+		}
+	}
+	var targets []string
+	for _, ip := range selected {
+		if ip != nil {
+			targets = append(targets, net.JoinHostPort(ip.String(), port))
+		}
+	}
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("no address of %s for server %s", familyName(family), server)
+	}
+	return targets, nil
+}
+
+func familyName(family string) string {
+	if family == "" {
+		return AddressFamilyAny
+	}
+	return family
+}
+
+// Target is a dns server of job, the weight is used by the weighted and
+// qname target policy. A target with discovery is expanded to the name
+// servers of the zone or the targets of the SRV record
+type Target struct {
+	Host      string
+	Port      string
+	Weight    int
+	Discovery string
+}
+
+// ParseTargets return the targets from a comma or newline separated list
+// in host[:port][=weight] format, the ipv6 address with port must be
+// written in brackets like [2001:db8::1]:53. ns://zone[:port] use the name
+// servers of zone and srv://name use the targets of the SRV record
+func ParseTargets(targets, defaultPort string) ([]Target, error) {
+	var result []Target
+	for _, item := range strings.FieldsFunc(targets, func(r rune) bool {
+		return r == ',' || r == '\n' || r == '\r'
+	}) {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		target := Target{Host: item, Port: defaultPort, Weight: 1}
+		if index := strings.LastIndex(item, "="); index >= 0 {
+			weight, err := strconv.Atoi(strings.TrimSpace(item[index+1:]))
+			if err != nil || weight <= 0 {
+				return nil, fmt.Errorf("invalid weight of target %s", item)
+			}
+			target.Weight = weight
+			target.Host = strings.TrimSpace(item[:index])
+		}
+		for _, discovery := range []string{TargetDiscoveryNS, TargetDiscoverySRV} {
+			if strings.HasPrefix(strings.ToLower(target.Host), discovery+"://") {
+				target.Discovery = discovery
+				target.Host = target.Host[len(discovery)+3:]
+			}
+		}
+		if host, port, err := net.SplitHostPort(target.Host); err == nil && target.Discovery != TargetDiscoverySRV {
+			target.Host, target.Port = host, port
+		} else if strings.HasPrefix(target.Host, "[") {
+			target.Host = strings.TrimSuffix(strings.TrimPrefix(target.Host, "["), "]")
+		}
+		if !govalidator.IsHost(target.Host) || !govalidator.IsPort(target.Port) ||
+			(target.Discovery != "" && !govalidator.IsDNSName(target.Host)) {
+			return nil, fmt.Errorf("invalid target %s", item)
+		}
+		result = append(result, target)
+	}
+	return result, nil
+}
+
+// Targets return the targets of job, the server and port are used when
+// the target list is not set
+func (jobConfig *JobConfig) Targets() ([]Target, error) {
+	list := jobConfig.TargetList
+	if strings.TrimSpace(list) == "" {
+		list = jobConfig.Server
+	}
+	targets, err := ParseTargets(list, jobConfig.Port)
+	if err != nil {
+		return nil, err
+	}
+	if len(targets) == 0 {
+		return nil, errors.New("target list is empty")
+	}
+	return targets, nil
+}
+
+// discoverTargets return the name servers of the zone or the targets of
+// the SRV record with the lowest priority, sorted by name
+func discoverTargets(target Target) ([]Target, error) {
+	var result []Target
+	switch target.Discovery {
+	case TargetDiscoveryNS:
+		servers, err := lookupNS(target.Host)
+		if err != nil {
+			return nil, err
+		}
+		for _, server := range servers {
+			result = append(result, Target{Host: strings.TrimSuffix(server.Host, "."), Port: target.Port, Weight: target.Weight})
+		}
+	case TargetDiscoverySRV:
+		_, records, err := lookupSRV("", "", target.Host)
+		if err != nil {
+			return nil, err
+		}
+		for _, record := range records {
+			if record.Priority != records[0].Priority {
+				continue
+			}
+			weight := int(record.Weight)
+			if weight == 0 {
+				weight = 1
+			}
+			result = append(result, Target{Host: strings.TrimSuffix(record.Target, "."), Port: strconv.Itoa(int(record.Port)), Weight: weight})
+		}
+	default:
+		return []Target{target}, nil
+	}
+	if len(result) == 0 {
+		return nil, fmt.Errorf("no target discovered from %s://%s", target.Discovery, target.Host)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Host < result[j].Host || (result[i].Host == result[j].Host && result[i].Port < result[j].Port)
+	})
+	return result, nil
+}
+
+// ResolveAddresses return the addresses of all targets of job and the
+// weight of each address, the addresses are saved in ResolvedTargets to
+// be recorded in the job history
+func (jobConfig *JobConfig) ResolveAddresses() ([]string, map[string]int, error) {
+	addresses, weights, err := resolveJobTargets(jobConfig)
+	if err != nil {
+		return nil, nil, err
+	}
+	jobConfig.ResolvedTargets = strings.Join(addresses, ",")
+	return addresses, weights, nil
+}
+
+// resolveJobTargets return the addresses of all targets of job and the
+// weight of each address, the same address is only used once
+func resolveJobTargets(job *JobConfig) ([]string, map[string]int, error) {
+	targets, err := job.Targets()
+	if err != nil {
+		return nil, nil, err
+	}
+	var addresses []string
+	weights := make(map[string]int)
+	for _, target := range targets {
+		discovered, err := discoverTargets(target)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, host := range discovered {
+			resolved, err := ResolveTargets(host.Host, host.Port, job.AddressFamily)
+			if err != nil {
+				return nil, nil, err
+			}
+			for _, address := range resolved {
+				if _, ok := weights[address]; ok {
+					continue
+				}
+				weights[address] = host.Weight
+				addresses = append(addresses, address)
+			}
+		}
+	}
+	return addresses, weights, nil
+}
+
+// targetGroup hold the connections to one target address
+type targetGroup struct {
+	// address is changed by re-resolve while the queries are sent
+	address atomic.Value
+	weight  int
+	conns   []int
+	next    int
+}
+
+// newTargetGroups group the connections by target in the order of first
+// connection of each target
+func newTargetGroups(conns []*ClientConn, weights map[string]int) []*targetGroup {
+	var groups []*targetGroup
+	index := make(map[string]*targetGroup)
+	for i, conn := range conns {
+		group, ok := index[conn.Target]
+		if !ok {
+			weight := weights[conn.Target]
+			if weight <= 0 {
+				weight = 1
+			}
+			group = &targetGroup{weight: weight}
+			group.address.Store(conn.Target)
+			index[conn.Target] = group
+			groups = append(groups, group)
+		}
+		group.conns = append(group.conns, i)
+	}
+	return groups
+}
+
+// currentAddress return the address of target in use
+func (group *targetGroup) currentAddress() string {
+	return group.address.Load().(string)
+}
+
+// targetPicker select the target of each query by the target policy
+type targetPicker struct {
+	policy      string
+	groups      []*targetGroup
+	totalWeight int
+	next        int
+}
+
+func newTargetPicker(policy string, groups []*targetGroup) *targetPicker {
+	picker := &targetPicker{policy: policy, groups: groups}
+	for _, group := range groups {
+		picker.totalWeight += group.weight
+	}
+	return picker
+}
+
+// pick return the target of the query message
+func (picker *targetPicker) pick(msg []byte) *targetGroup {
+	if len(picker.groups) == 1 {
+		return picker.groups[0]
+	}
+	switch picker.policy {
+	case TargetPolicyWeighted:
+		return picker.weighted(uint32(rand.Intn(picker.totalWeight)))
+	case TargetPolicyQname:
+		return picker.weighted(qnameHash(msg) % uint32(picker.totalWeight))
+	default:
+		group := picker.groups[picker.next]
+		picker.next = (picker.next + 1) % len(picker.groups)
+		return group
+	}
+}
+
+// weighted return the target of the value in [0, totalWeight)
+func (picker *targetPicker) weighted(value uint32) *targetGroup {
+	for _, group := range picker.groups {
+		if value < uint32(group.weight) {
+			return group
+		}
+		value -= uint32(group.weight)
+	}
+	return picker.groups[len(picker.groups)-1]
+}
+
+// qnameHash return the fnv hash of the lower case query name in message
+func qnameHash(msg []byte) uint32 {
+	hash := fnv.New32a()
+	for off := 12; off < len(msg) && msg[off] != 0; off++ {
+		c := msg[off]
+		if c >= 'A' && c <= 'Z' {
+			c += 'a' - 'A'
+		}
+		hash.Write([]byte{c})
+	}
+	return hash.Sum32()
+}
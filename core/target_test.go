@@ -0,0 +1,185 @@
+package core
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/zhangmingkai4315/dns-loader/dns"
+)
+
+func TestResolveTargets(t *testing.T) {
+	lookupIP = func(host string) ([]net.IP, error) {
+		return []net.IP{net.ParseIP("2001:db8::53"), net.ParseIP("192.0.2.53")}, nil
+	}
+	defer func() { lookupIP = net.LookupIP }()
+
+	targets, err := ResolveTargets("ns.example.com", "53", "")
+	OK(t, err)
+	Equals(t, []string{"[2001:db8::53]:53"}, targets)
+	targets, err = ResolveTargets("ns.example.com", "53", AddressFamilyIPv4)
+	OK(t, err)
+	Equals(t, []string{"192.0.2.53:53"}, targets)
+	targets, err = ResolveTargets("ns.example.com", "53", AddressFamilyAlternate)
+	OK(t, err)
+	Equals(t, []string{"192.0.2.53:53", "[2001:db8::53]:53"}, targets)
+
+	targets, err = ResolveTargets("[::1]", "5353", AddressFamilyIPv6)
+	OK(t, err)
+	Equals(t, []string{"[::1]:5353"}, targets)
+	_, err = ResolveTargets("127.0.0.1", "53", AddressFamilyIPv6)
+	Assert(t, err != nil, "expect error for missing ipv6 address")
+}
+
+func TestParseTargets(t *testing.T) {
+	targets, err := ParseTargets("192.0.2.1, 192.0.2.2:5353=3\n[2001:db8::1]:53=2,2001:db8::2,ns.example.com=4", "53")
+	OK(t, err)
+	Equals(t, []Target{
+		{Host: "192.0.2.1", Port: "53", Weight: 1},
+		{Host: "192.0.2.2", Port: "5353", Weight: 3},
+		{Host: "2001:db8::1", Port: "53", Weight: 2},
+		{Host: "2001:db8::2", Port: "53", Weight: 1},
+		{Host: "ns.example.com", Port: "53", Weight: 4},
+	}, targets)
+	for _, invalid := range []string{"192.0.2.1=0", "192.0.2.1=x", "192.0.2.1:99999", "bad_host!"} {
+		_, err := ParseTargets(invalid, "53")
+		Assert(t, err != nil, "expect error for %s", invalid)
+	}
+}
+
+func TestTargetPicker(t *testing.T) {
+	conns := []*ClientConn{{Target: "a"}, {Target: "b"}, {Target: "a"}, {Target: "b"}}
+	groups := newTargetGroups(conns, map[string]int{"a": 3, "b": 1})
+	Equals(t, 2, len(groups))
+	Equals(t, []int{0, 2}, groups[0].conns)
+
+	picker := newTargetPicker(TargetPolicyRoundRobin, groups)
+	Equals(t, "a", picker.pick(nil).currentAddress())
+	Equals(t, "b", picker.pick(nil).currentAddress())
+	Equals(t, "a", picker.pick(nil).currentAddress())
+
+	picker = newTargetPicker(TargetPolicyWeighted, groups)
+	count := 0
+	for i := 0; i < 4000; i++ {
+		if picker.pick(nil).currentAddress() == "a" {
+			count++
+		}
+	}
+	Assert(t, count > 2700 && count < 3300, "expect about 3000 queries to a, got %d", count)
+
+	picker = newTargetPicker(TargetPolicyQname, groups)
+	query := func(name string) []byte {
+		packet := new(dns.Packet)
+		packet.SetQuestion(name, dns.TypeA)
+		msg, _ := packet.ToBytes()
+		return msg
+	}
+	Equals(t, picker.pick(query("www.example.com.")), picker.pick(query("WWW.Example.COM.")))
+}
+
+func TestDiscoverTargets(t *testing.T) {
+	lookupIP = func(host string) ([]net.IP, error) {
+		addresses := map[string]string{"ns1.example.com": "192.0.2.1", "ns2.example.com": "192.0.2.2", "dns.example.com": "192.0.2.3"}
+		return []net.IP{net.ParseIP(addresses[host])}, nil
+	}
+	lookupNS = func(zone string) ([]*net.NS, error) {
+		return []*net.NS{{Host: "ns2.example.com."}, {Host: "ns1.example.com."}}, nil
+	}
+	lookupSRV = func(service, proto, name string) (string, []*net.SRV, error) {
+		return name, []*net.SRV{
+			{Target: "dns.example.com.", Port: 5353, Priority: 10, Weight: 5},
+			{Target: "ns1.example.com.", Port: 53, Priority: 20, Weight: 1},
+		}, nil
+	}
+	defer func() {
+		lookupIP, lookupNS, lookupSRV = net.LookupIP, net.LookupNS, net.LookupSRV
+	}()
+
+	job := NewDefaultJobConfig()
+	job.TargetList = "ns://example.com=2, srv://_dns._udp.example.com"
+	addresses, weights, err := job.ResolveAddresses()
+	OK(t, err)
+	Equals(t, []string{"192.0.2.1:53", "192.0.2.2:53", "192.0.2.3:5353"}, addresses)
+	Equals(t, map[string]int{"192.0.2.1:53": 2, "192.0.2.2:53": 2, "192.0.2.3:5353": 5}, weights)
+	Equals(t, "192.0.2.1:53,192.0.2.2:53,192.0.2.3:5353", job.ResolvedTargets)
+
+	_, err = ParseTargets("ns://192.0.2.1", "53")
+	Assert(t, err != nil, "expect error for discovery of ip address")
+}
+
+func TestSwitchConn(t *testing.T) {
+	servers := make([]net.PacketConn, 2)
+	for i := range servers {
+		server, err := net.ListenPacket("udp", "127.0.0.1:0")
+		OK(t, err)
+		defer server.Close()
+		servers[i] = server
+	}
+	job := NewDefaultJobConfig()
+	job.ResolveInterval = "1s"
+	conn, err := dialTarget(job, nil, servers[0].LocalAddr().String(), 1)
+	OK(t, err)
+	defer conn.Close()
+	old := conn.current()
+	next, err := conn.redial(servers[1].LocalAddr().String())
+	OK(t, err)
+	conn.Conn.(*switchConn).swap(next.Conn)
+	Assert(t, conn.current() != old, "expect the connection switched")
+	_, err = old.Read(make([]byte, 1))
+	Assert(t, err != nil, "expect the old connection closed")
+
+	_, err = conn.Write([]byte("query"))
+	OK(t, err)
+	buf := make([]byte, 512)
+	servers[1].SetReadDeadline(time.Now().Add(time.Second))
+	n, _, err := servers[1].ReadFrom(buf)
+	OK(t, err)
+	Equals(t, "query", string(buf[:n]))
+}
+
+func TestReresolve(t *testing.T) {
+	var lookups uint32
+	lookupIP = func(host string) ([]net.IP, error) {
+		// the server move between two addresses on every lookup
+		if atomic.AddUint32(&lookups, 1)%2 == 0 {
+			return []net.IP{net.ParseIP("127.0.0.2")}, nil
+		}
+		return []net.IP{net.ParseIP("127.0.0.1")}, nil
+	}
+	defer func() { lookupIP = net.LookupIP }()
+
+	job := NewDefaultJobConfig()
+	job.Server = "dns.example.com"
+	job.Port = "5353"
+	job.ResolveInterval = "1ms"
+	client, err := NewDNSClient(&AppController{JobConfig: job})
+	OK(t, err)
+	defer func() {
+		for _, conn := range client.Conn {
+			conn.Close()
+		}
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		client.Reresolve(ctx, job, time.Millisecond)
+		close(done)
+	}()
+	// the senders and the result breakdown read the target while it moves
+	group := client.targets.groups[0]
+	for ctx.Err() == nil {
+		for _, n := range group.conns {
+			client.Conn[n].Write([]byte(group.currentAddress() + client.Conn[n].target()))
+		}
+	}
+	<-done
+	Assert(t, atomic.LoadUint32(&lookups) > 2, "expect the targets re-resolved")
+	for _, n := range group.conns {
+		conn := client.Conn[n]
+		Equals(t, group.currentAddress(), conn.target())
+		Equals(t, conn.target(), conn.current().RemoteAddr().String())
+	}
+}
@@ -0,0 +1,97 @@
+package core
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// apiTokenPrefix mark the api tokens of dns-loader, it helps to find
+// the leaked token in scripts and logs
+const apiTokenPrefix = "dl_"
+
+// APIToken is a bearer token of the api for the user, only the sha256
+// hash of the token is saved, Prefix is kept to tell the tokens apart
+type APIToken struct {
+	gorm.Model
+	Name      string     `json:"name"`
+	Prefix    string     `json:"prefix"`
+	TokenHash string     `json:"-" gorm:"unique_index"`
+	User      string     `json:"user"`
+	LastUsed  *time.Time `json:"last_used"`
+}
+
+// hashAPIToken return the saved form of the token
+func hashAPIToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateAPIToken create a new token of the user, the token is only
+// returned here and can't be read again
+func (dbHander *DBHandler) CreateAPIToken(username, name string) (string, *APIToken, error) {
+	if _, err := dbHander.GetUser(username); err != nil {
+		return "", nil, fmt.Errorf("user %s not exist", username)
+	}
+	random := make([]byte, 20)
+	if _, err := rand.Read(random); err != nil {
+		return "", nil, err
+	}
+	token := apiTokenPrefix + hex.EncodeToString(random)
+	apiToken := &APIToken{
+		Name:      name,
+		Prefix:    token[:len(apiTokenPrefix)+6],
+		TokenHash: hashAPIToken(token),
+		User:      username,
+	}
+	if err := dbHander.Create(apiToken).Error; err != nil {
+		return "", nil, fmt.Errorf("save new token fail: %s", err)
+	}
+	return token, apiToken, nil
+}
+
+// GetAPITokens return the tokens of user, all tokens when username is
+// empty
+func (dbHander *DBHandler) GetAPITokens(username string) ([]APIToken, error) {
+	tokens := []APIToken{}
+	db := dbHander.Order("id")
+	if username != "" {
+		db = db.Where("user = ?", username)
+	}
+	err := db.Find(&tokens).Error
+	if err != nil && !gorm.IsRecordNotFoundError(err) {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// DeleteAPIToken revoke the token of user, any token can be revoked
+// when username is empty
+func (dbHander *DBHandler) DeleteAPIToken(id uint, username string) error {
+	apiToken := &APIToken{}
+	if err := dbHander.First(apiToken, id).Error; err != nil || (username != "" && apiToken.User != username) {
+		return fmt.Errorf("token %d not exist", id)
+	}
+	return dbHander.Unscoped().Delete(apiToken).Error
+}
+
+// AuthenticateAPIToken return the user of the token and record the
+// time the token is used
+func (dbHander *DBHandler) AuthenticateAPIToken(token string) (*User, error) {
+	apiToken := &APIToken{}
+	if err := dbHander.Where("token_hash = ?", hashAPIToken(token)).First(apiToken).Error; err != nil {
+		return nil, errors.New("invalid token")
+	}
+	user, err := dbHander.GetUser(apiToken.User)
+	if err != nil {
+		return nil, errors.New("invalid token")
+	}
+	now := time.Now()
+	dbHander.Model(apiToken).UpdateColumn("last_used", &now)
+	return user, nil
+}
@@ -0,0 +1,60 @@
+package core
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAPIToken(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dns-loader")
+	OK(t, err)
+	defer os.RemoveAll(dir)
+	OK(t, NewDatabaseConnectionFromFile(filepath.Join(dir, "app.db")))
+	db := GetDBHandler()
+	defer db.Close()
+
+	OK(t, db.EnsureAdminUser("admin", "admin"))
+	_, err = db.CreateUser("alice", "alice-password", RoleOperator)
+	OK(t, err)
+	_, _, err = db.CreateAPIToken("nobody", "ci")
+	Assert(t, err != nil, "expect error for unknown user")
+
+	token, apiToken, err := db.CreateAPIToken("alice", "ci")
+	OK(t, err)
+	Assert(t, strings.HasPrefix(token, apiTokenPrefix), "token should have prefix")
+	Assert(t, strings.HasPrefix(token, apiToken.Prefix), "prefix should be the start of token")
+	Assert(t, !strings.Contains(apiToken.TokenHash, token), "token should be hashed")
+	user, err := db.AuthenticateAPIToken(token)
+	OK(t, err)
+	Equals(t, "alice", user.Username)
+	_, err = db.AuthenticateAPIToken(token + "0")
+	Assert(t, err != nil, "expect error for wrong token")
+	tokens, err := db.GetAPITokens("alice")
+	OK(t, err)
+	Equals(t, 1, len(tokens))
+	Assert(t, tokens[0].LastUsed != nil, "last used time should be recorded")
+
+	// only the owner or admin can revoke the token
+	adminToken, _, err := db.CreateAPIToken("admin", "")
+	OK(t, err)
+	Assert(t, db.DeleteAPIToken(apiToken.ID, "admin") != nil, "expect error for token of other user")
+	tokens, err = db.GetAPITokens("")
+	OK(t, err)
+	Equals(t, 2, len(tokens))
+	OK(t, db.DeleteAPIToken(apiToken.ID, ""))
+	_, err = db.AuthenticateAPIToken(token)
+	Assert(t, err != nil, "revoked token should not work")
+
+	// the tokens are removed with the user
+	_, err = db.CreateUser("bob", "bob-password", RoleAdmin)
+	OK(t, err)
+	OK(t, db.DeleteUser("admin"))
+	_, err = db.AuthenticateAPIToken(adminToken)
+	Assert(t, err != nil, "token of removed user should not work")
+	tokens, err = db.GetAPITokens("")
+	OK(t, err)
+	Equals(t, 0, len(tokens))
+}
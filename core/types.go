@@ -19,6 +19,104 @@ var StatusToString = map[uint32]string{
 	StatusStopped:  "stopped",
 }
 
+// JobType define what kind of dns traffic will be generated
+const (
+	JobTypeQuery  = "query"
+	JobTypeReplay = "replay"
+	JobTypeUpdate = "update"
+	JobTypeXFR    = "xfr"
+	JobTypeNotify = "notify"
+)
+
+// Update action define what the dynamic update messages do
+const (
+	// UpdateActionAdd add random records into the zone
+	UpdateActionAdd = "add"
+	// UpdateActionDelete delete random records from the zone
+	UpdateActionDelete = "delete"
+	// UpdateActionMixed add a random record and delete it in next message
+	UpdateActionMixed = "mixed"
+)
+
+// Replay timing define how the captured queries will be paced
+const (
+	// ReplayTimingOriginal keep the inter-arrival time of the capture
+	// scaled by the replay speed
+	ReplayTimingOriginal = "original"
+	// ReplayTimingQPS send the captured queries at the job qps
+	ReplayTimingQPS = "qps"
+)
+
+// ECS mode define how the client subnet of each query is selected
+const (
+	// ECSModeFixed use the first subnet for all queries
+	ECSModeFixed = "fixed"
+	// ECSModeRandom draw a random prefix from the subnets for each query
+	ECSModeRandom = "random"
+)
+
+// Source policy define how the source ips are used
+const (
+	// SourcePolicyConnection bind each connection to a source ip in turn
+	SourcePolicyConnection = "connection"
+	// SourcePolicyQuery send each query from next source ip with
+	// unconnected udp sockets
+	SourcePolicyQuery = "query"
+)
+
+// Address family define which addresses of the server are used
+const (
+	// AddressFamilyAny use the first address of the server
+	AddressFamilyAny = "any"
+	// AddressFamilyIPv4 use the first ipv4 address of the server
+	AddressFamilyIPv4 = "ipv4"
+	// AddressFamilyIPv6 use the first ipv6 address of the server
+	AddressFamilyIPv6 = "ipv6"
+	// AddressFamilyAlternate use the first address of both families and
+	// send the queries to them in turn
+	AddressFamilyAlternate = "alternate"
+)
+
+// Target policy define how the target of each query is selected
+const (
+	// TargetPolicyRoundRobin send the queries to the targets in turn
+	TargetPolicyRoundRobin = "rr"
+	// TargetPolicyWeighted select a random target by weight
+	TargetPolicyWeighted = "weighted"
+	// TargetPolicyQname select the target by the hash of query name so
+	// the same name is always sent to the same target
+	TargetPolicyQname = "qname"
+)
+
+// Target discovery define how a target is expanded to servers
+const (
+	// TargetDiscoveryNS use the name servers of the zone
+	TargetDiscoveryNS = "ns"
+	// TargetDiscoverySRV use the targets of the SRV record
+	TargetDiscoverySRV = "srv"
+)
+
+// Role define what a user of master can do, each role can do all things
+// of the roles before it
+const (
+	// RoleViewer can view the status and the job history
+	RoleViewer = "viewer"
+	// RoleOperator can start and stop jobs
+	RoleOperator = "operator"
+	// RoleAdmin can manage the agents and the users
+	RoleAdmin = "admin"
+)
+
+// EDNS cookie mode define how the DNS COOKIE option is sent
+const (
+	// EDNSCookieNone do not send cookie option
+	EDNSCookieNone = "none"
+	// EDNSCookieClient only send the client cookie
+	EDNSCookieClient = "client"
+	// EDNSCookieEcho echo the server cookie learned from responses
+	EDNSCookieEcho = "echo"
+)
+
 const (
 	// Ready usually for listening status
 	Ready Event = iota
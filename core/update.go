@@ -0,0 +1,112 @@
+package core
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/rand"
+
+	"github.com/zhangmingkai4315/dns-loader/dns"
+)
+
+const defaultUpdateLabelLength = 8
+
+// UpdateGenerator generate the dynamic update messages of update job
+type UpdateGenerator struct {
+	update     *dns.Update
+	action     string
+	recordType uint16
+	length     int
+	offset     int
+	buf        []byte
+	// added is the label added by last message in mixed mode
+	added string
+	// last is the action of last message
+	last string
+}
+
+// NewUpdateGeneratorFromJob create the update generator from job setting
+func NewUpdateGeneratorFromJob(job *JobConfig) (*UpdateGenerator, error) {
+	update, err := dns.NewUpdate(job.UpdateZone, uint32(job.UpdateTTL))
+	if err != nil {
+		return nil, err
+	}
+	generator := &UpdateGenerator{
+		update:     update,
+		action:     job.UpdateAction,
+		recordType: dns.TypeA,
+		length:     job.DomainRandomLength,
+	}
+	if generator.action == "" {
+		generator.action = UpdateActionAdd
+	}
+	if generator.length <= 0 {
+		generator.length = defaultUpdateLabelLength
+	}
+	switch job.UpdateType {
+	case "", "A":
+	case "AAAA":
+		generator.recordType = dns.TypeAAAA
+	case "TXT":
+		generator.recordType = dns.TypeTXT
+	default:
+		return nil, fmt.Errorf("unsupported update record type %s", job.UpdateType)
+	}
+	if job.Protocol == "tcp" {
+		generator.offset = 2
+	}
+	return generator, nil
+}
+
+// rdata return random rdata of the record type
+func (generator *UpdateGenerator) rdata() []byte {
+	switch generator.recordType {
+	case dns.TypeAAAA:
+		rdata := make([]byte, 16)
+		rand.Read(rdata)
+		return rdata
+	case dns.TypeTXT:
+		text := dns.GenRandomDomain(16, ".")
+		return append([]byte{byte(len(text))}, text...)
+	default:
+		rdata := make([]byte, 4)
+		rand.Read(rdata)
+		return rdata
+	}
+}
+
+// Next return the next update message, in mixed mode the record added
+// by last message will be deleted so the zone will not keep growing
+func (generator *UpdateGenerator) Next() []byte {
+	id := dns.GenerateRandomID(true)
+	buf := generator.buf[:0]
+	if generator.offset != 0 {
+		buf = append(buf, 0, 0)
+	}
+	switch {
+	case generator.action == UpdateActionDelete:
+		label := dns.GenRandomDomain(generator.length, ".")
+		buf = generator.update.Delete(buf, id, label, generator.recordType)
+		generator.last = UpdateActionDelete
+	case generator.action == UpdateActionMixed && generator.added != "":
+		buf = generator.update.Delete(buf, id, generator.added, generator.recordType)
+		generator.added = ""
+		generator.last = UpdateActionDelete
+	default:
+		generator.last = UpdateActionAdd
+		label := dns.GenRandomDomain(generator.length, ".")
+		buf = generator.update.Add(buf, id, label, generator.recordType, generator.rdata())
+		if generator.action == UpdateActionMixed {
+			generator.added = label
+		}
+	}
+	if generator.offset != 0 {
+		binary.BigEndian.PutUint16(buf, uint16(len(buf)-2))
+	}
+	generator.buf = buf
+	return buf
+}
+
+// Action return the action of last message, add or delete
+func (generator *UpdateGenerator) Action() string {
+	return generator.last
+}
@@ -0,0 +1,46 @@
+package core
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/zhangmingkai4315/dns-loader/dns"
+)
+
+func TestUpdateGenerator(t *testing.T) {
+	job := NewDefaultJobConfig()
+	job.JobType = JobTypeUpdate
+	job.UpdateZone = "example.com"
+	job.UpdateAction = UpdateActionMixed
+	job.Protocol = "tcp"
+	generator, err := NewUpdateGeneratorFromJob(job)
+	OK(t, err)
+
+	add := append([]byte{}, generator.Next()...)
+	Equals(t, UpdateActionAdd, generator.Action())
+	Equals(t, uint16(len(add)-2), binary.BigEndian.Uint16(add))
+	message, err := dns.ParseMessage(add[2:])
+	OK(t, err)
+	Equals(t, dns.OpcodeUpdate, message.Header.Opcode)
+	Equals(t, "example.com.", message.Question[0].Name)
+	Equals(t, 8+len(".example.com."), len(message.Authority[0].Name))
+	Equals(t, dns.TypeSOA, message.Question[0].Qtype)
+	Equals(t, 1, len(message.Authority))
+	// update section is parsed as authority section
+	Equals(t, dns.TypeA, message.Authority[0].Type)
+	Equals(t, uint16(dns.ClassINET), message.Authority[0].Class)
+	Equals(t, 4, len(message.Authority[0].Rdata))
+
+	// mixed mode delete the record added by last message
+	message, err = dns.ParseMessage(generator.Next()[2:])
+	OK(t, err)
+	Equals(t, UpdateActionDelete, generator.Action())
+	Equals(t, uint16(dns.ClassANY), message.Authority[0].Class)
+	Equals(t, 0, len(message.Authority[0].Rdata))
+	added, _ := dns.ParseMessage(add[2:])
+	Equals(t, added.Authority[0].Name, message.Authority[0].Name)
+
+	job.UpdateType = "SRV"
+	_, err = NewUpdateGeneratorFromJob(job)
+	Assert(t, err != nil, "expect error for unsupported record type")
+}
@@ -0,0 +1,189 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+
+	"github.com/jinzhu/gorm"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// roleLevels is the order of roles, a role can do all things of the
+// roles with lower level
+var roleLevels = map[string]int{
+	RoleViewer:   1,
+	RoleOperator: 2,
+	RoleAdmin:    3,
+}
+
+var usernamePattern = regexp.MustCompile(`^[A-Za-z0-9_.@-]{1,64}$`)
+
+// minPasswordLength is the minimum length of new passwords
+const minPasswordLength = 6
+
+// User is an account of master, the password is saved as bcrypt hash
+type User struct {
+	gorm.Model
+	Username     string `json:"username" gorm:"unique_index"`
+	PasswordHash string `json:"-"`
+	Role         string `json:"role"`
+}
+
+// ValidRole return true when the role is known
+func ValidRole(role string) bool {
+	_, ok := roleLevels[role]
+	return ok
+}
+
+// Can return true when the user has the role or a higher role
+func (user *User) Can(role string) bool {
+	return user != nil && roleLevels[user.Role] >= roleLevels[role]
+}
+
+// SetPassword save the bcrypt hash of password
+func (user *User) SetPassword(password string) error {
+	if len(password) < minPasswordLength {
+		return fmt.Errorf("password must have at least %d characters", minPasswordLength)
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	user.PasswordHash = string(hash)
+	return nil
+}
+
+// CheckPassword return true when the password match the saved hash
+func (user *User) CheckPassword(password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)) == nil
+}
+
+// EnsureAdminUser create the admin user from config file when no user
+// exist, so the user of old config file can still login
+func (dbHander *DBHandler) EnsureAdminUser(username, password string) error {
+	var count int
+	if err := dbHander.Model(&User{}).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 || username == "" {
+		return nil
+	}
+	// the password of old config file may be shorter than required
+	user := User{Username: username, Role: RoleAdmin}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	user.PasswordHash = string(hash)
+	if err := dbHander.Create(&user).Error; err != nil {
+		return err
+	}
+	log.Infof("create admin user %s from config file", username)
+	return nil
+}
+
+// Authenticate return the user when the username and password match
+func (dbHander *DBHandler) Authenticate(username, password string) (*User, error) {
+	user, err := dbHander.GetUser(username)
+	if err != nil || !user.CheckPassword(password) {
+		return nil, errors.New("invalid username or password")
+	}
+	return user, nil
+}
+
+// GetUser return the user by username
+func (dbHander *DBHandler) GetUser(username string) (*User, error) {
+	user := &User{}
+	if err := dbHander.Where("username = ?", username).First(user).Error; err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// GetUsers return all users ordered by username
+func (dbHander *DBHandler) GetUsers() ([]User, error) {
+	users := []User{}
+	err := dbHander.Order("username").Find(&users).Error
+	if err != nil && !gorm.IsRecordNotFoundError(err) {
+		return nil, err
+	}
+	return users, nil
+}
+
+// CreateUser add a new user with the role
+func (dbHander *DBHandler) CreateUser(username, password, role string) (*User, error) {
+	if !usernamePattern.MatchString(username) {
+		return nil, errors.New("username must be 1-64 letters, digits or _.@-")
+	}
+	if !ValidRole(role) {
+		return nil, fmt.Errorf("unknown role %s", role)
+	}
+	if _, err := dbHander.GetUser(username); err == nil {
+		return nil, fmt.Errorf("user %s already exist", username)
+	}
+	user := &User{Username: username, Role: role}
+	if err := user.SetPassword(password); err != nil {
+		return nil, err
+	}
+	if err := dbHander.Create(user).Error; err != nil {
+		return nil, fmt.Errorf("save new user fail: %s", err)
+	}
+	return user, nil
+}
+
+// UpdateUser change the role and the password of user, the empty value
+// is not changed. The last admin can't be changed to other role
+func (dbHander *DBHandler) UpdateUser(username, password, role string) error {
+	user, err := dbHander.GetUser(username)
+	if err != nil {
+		return fmt.Errorf("user %s not exist", username)
+	}
+	if role != "" && role != user.Role {
+		if !ValidRole(role) {
+			return fmt.Errorf("unknown role %s", role)
+		}
+		if err := dbHander.keepAdmin(user); err != nil {
+			return err
+		}
+		user.Role = role
+	}
+	if password != "" {
+		if err := user.SetPassword(password); err != nil {
+			return err
+		}
+	}
+	return dbHander.Save(user).Error
+}
+
+// DeleteUser remove the user and its api tokens, the last admin can't
+// be removed
+func (dbHander *DBHandler) DeleteUser(username string) error {
+	user, err := dbHander.GetUser(username)
+	if err != nil {
+		return fmt.Errorf("user %s not exist", username)
+	}
+	if err := dbHander.keepAdmin(user); err != nil {
+		return err
+	}
+	if err := dbHander.Unscoped().Where("user = ?", username).Delete(&APIToken{}).Error; err != nil {
+		return err
+	}
+	return dbHander.Unscoped().Delete(user).Error
+}
+
+// keepAdmin return error when the user is the last admin
+func (dbHander *DBHandler) keepAdmin(user *User) error {
+	if user.Role != RoleAdmin {
+		return nil
+	}
+	var count int
+	if err := dbHander.Model(&User{}).Where("role = ?", RoleAdmin).Count(&count).Error; err != nil {
+		return err
+	}
+	if count <= 1 {
+		return errors.New("can't remove the last admin")
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package core
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestUserCan(t *testing.T) {
+	viewer := &User{Role: RoleViewer}
+	operator := &User{Role: RoleOperator}
+	admin := &User{Role: RoleAdmin}
+	Assert(t, viewer.Can(RoleViewer) && !viewer.Can(RoleOperator), "viewer can only view")
+	Assert(t, operator.Can(RoleOperator) && !operator.Can(RoleAdmin), "operator can't manage")
+	Assert(t, admin.Can(RoleViewer) && admin.Can(RoleAdmin), "admin can do all")
+	var none *User
+	Assert(t, !none.Can(RoleViewer), "nil user can do nothing")
+	Assert(t, !(&User{Role: "root"}).Can(RoleViewer), "unknown role can do nothing")
+}
+
+func TestUserPassword(t *testing.T) {
+	user := &User{}
+	Assert(t, user.SetPassword("short") != nil, "expect error for short password")
+	OK(t, user.SetPassword("secret-password"))
+	Assert(t, user.PasswordHash != "secret-password", "password should be hashed")
+	Assert(t, user.CheckPassword("secret-password"), "password should match")
+	Assert(t, !user.CheckPassword("wrong-password"), "wrong password should not match")
+}
+
+func TestUserDB(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dns-loader")
+	OK(t, err)
+	defer os.RemoveAll(dir)
+	OK(t, NewDatabaseConnectionFromFile(filepath.Join(dir, "app.db")))
+	db := GetDBHandler()
+	defer db.Close()
+
+	// the user of config file is created as admin only once
+	OK(t, db.EnsureAdminUser("admin", "admin"))
+	OK(t, db.EnsureAdminUser("other", "other"))
+	users, err := db.GetUsers()
+	OK(t, err)
+	Equals(t, 1, len(users))
+	Equals(t, RoleAdmin, users[0].Role)
+	_, err = db.Authenticate("admin", "admin")
+	OK(t, err)
+	_, err = db.Authenticate("admin", "wrong")
+	Assert(t, err != nil, "expect error for wrong password")
+
+	_, err = db.CreateUser("alice", "alice-password", RoleOperator)
+	OK(t, err)
+	_, err = db.CreateUser("alice", "alice-password", RoleOperator)
+	Assert(t, err != nil, "expect error for duplicate user")
+	_, err = db.CreateUser("bob", "bob-password", "root")
+	Assert(t, err != nil, "expect error for unknown role")
+	_, err = db.CreateUser("bad name", "bob-password", RoleViewer)
+	Assert(t, err != nil, "expect error for invalid username")
+
+	OK(t, db.UpdateUser("alice", "new-password", RoleViewer))
+	user, err := db.Authenticate("alice", "new-password")
+	OK(t, err)
+	Equals(t, RoleViewer, user.Role)
+	Assert(t, bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte("new-password")) == nil, "password should be bcrypt hash")
+
+	// the last admin is kept
+	Assert(t, db.UpdateUser("admin", "", RoleViewer) != nil, "expect error for changing last admin")
+	Assert(t, db.DeleteUser("admin") != nil, "expect error for deleting last admin")
+	OK(t, db.UpdateUser("alice", "", RoleAdmin))
+	OK(t, db.DeleteUser("admin"))
+	_, err = db.Authenticate("admin", "admin")
+	Assert(t, err != nil, "deleted user should not login")
+}
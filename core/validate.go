@@ -0,0 +1,291 @@
+package core
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/zhangmingkai4315/dns-loader/dns"
+)
+
+// maxMismatchSamples is the number of mismatches kept for the report
+const maxMismatchSamples = 10
+
+// Mismatch kinds of the response validation
+const (
+	MismatchParse     = "parse"
+	MismatchID        = "id"
+	MismatchQuestion  = "question"
+	MismatchTruncated = "truncated"
+	MismatchRcode     = "rcode"
+	MismatchAnswer    = "answer"
+)
+
+// Expectation is the expected response of a query name and type, rcode
+// is -1 when any rcode is accepted
+type Expectation struct {
+	Rcode   int
+	Answers []string
+	Pattern *regexp.Regexp
+}
+
+// rcodeNames map the names used in expectations to the rcode
+var rcodeNames = map[string]int{
+	"NOERROR":  dns.RcodeSuccess,
+	"FORMERR":  1,
+	"SERVFAIL": 2,
+	"NXDOMAIN": 3,
+	"NOTIMP":   4,
+	"REFUSED":  5,
+	"YXDOMAIN": 6,
+	"YXRRSET":  7,
+	"NXRRSET":  8,
+	"NOTAUTH":  9,
+	"NOTZONE":  10,
+}
+
+func parseRcode(name string) (int, error) {
+	if name == "*" {
+		return -1, nil
+	}
+	if code, ok := rcodeNames[strings.ToUpper(name)]; ok {
+		return code, nil
+	}
+	for code, rcodeName := range dns.DNSRcodeReverse {
+		if strings.EqualFold(name, rcodeName) {
+			return int(code), nil
+		}
+	}
+	code, err := strconv.Atoi(name)
+	if err != nil || code < 0 || code > 15 {
+		return 0, fmt.Errorf("invalid rcode %s", name)
+	}
+	return code, nil
+}
+
+func expectationKey(name string, qtype uint16) string {
+	return strings.ToLower(dns.FqdnFormat(name)) + "/" + strconv.Itoa(int(qtype))
+}
+
+// ParseExpectations parse the expected responses, one query per line in
+// the format "qname qtype rcode [answers]". rcode can be * for any rcode,
+// answers is the expected rdata of the qtype records in answer section
+// separated by ";" (order is ignored) or a regular expression start with
+// ~ which all the rdata must match. Lines start with # are comments
+func ParseExpectations(content string) (map[string]*Expectation, error) {
+	expectations := make(map[string]*Expectation)
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) < 3 {
+			return nil, fmt.Errorf("expectation line %d: need qname, qtype and rcode", line)
+		}
+		answers := strings.Join(fields[3:], " ")
+		qtype, err := dns.GetDNSTypeCodeFromString(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("expectation line %d: %s", line, err)
+		}
+		expectation := &Expectation{}
+		if expectation.Rcode, err = parseRcode(fields[2]); err != nil {
+			return nil, fmt.Errorf("expectation line %d: %s", line, err)
+		}
+		if answers != "" {
+			if strings.HasPrefix(answers, "~") {
+				if expectation.Pattern, err = regexp.Compile(answers[1:]); err != nil {
+					return nil, fmt.Errorf("expectation line %d: %s", line, err)
+				}
+			} else {
+				for _, answer := range strings.Split(answers, ";") {
+					if answer = strings.TrimSpace(answer); answer != "" {
+						expectation.Answers = append(expectation.Answers, strings.ToLower(answer))
+					}
+				}
+				sort.Strings(expectation.Answers)
+			}
+		}
+		expectations[expectationKey(fields[0], qtype)] = expectation
+	}
+	return expectations, scanner.Err()
+}
+
+// inflightQuery is the question of a query waiting for response
+type inflightQuery struct {
+	name  string
+	qtype uint16
+	sent  bool
+}
+
+// Validator compare the responses with the queries sent and the expected
+// answers, the queries use sequential ids so each response can be matched
+type Validator struct {
+	expectations map[string]*Expectation
+	lock         sync.Mutex
+	nextID       uint16
+	inflight     [65536]inflightQuery
+	responses    uint64
+	checked      uint64
+	mismatches   map[string]uint64
+	samples      []string
+	// fallback is true when the truncated responses are retried over
+	// tcp, the tcp response is validated instead
+	fallback bool
+}
+
+// NewValidatorFromJob create the validator with the expectations of job
+func NewValidatorFromJob(job *JobConfig) (*Validator, error) {
+	expectations, err := ParseExpectations(job.Expectations)
+	if err != nil {
+		return nil, err
+	}
+	return &Validator{
+		expectations: expectations,
+		nextID:       dns.GenerateRandomID(true),
+		mismatches:   make(map[string]uint64),
+	}, nil
+}
+
+// Track set the id of query and record its question
+func (validator *Validator) Track(msg []byte) {
+	if len(msg) < 12 {
+		return
+	}
+	name, off, err := dns.UnpackDomainName(msg, 12)
+	if err != nil || off+2 > len(msg) {
+		return
+	}
+	validator.lock.Lock()
+	id := validator.nextID
+	validator.nextID++
+	validator.inflight[id] = inflightQuery{name: name, qtype: binary.BigEndian.Uint16(msg[off:]), sent: true}
+	validator.lock.Unlock()
+	binary.BigEndian.PutUint16(msg, id)
+}
+
+// Check compare the response with the query and the expectation
+func (validator *Validator) Check(msg []byte) {
+	header, err := dns.UnpackHeader(msg)
+	if err == nil && header.Truncated && validator.fallback {
+		return
+	}
+	validator.lock.Lock()
+	defer validator.lock.Unlock()
+	validator.responses++
+	if err != nil {
+		validator.mismatch(MismatchParse, "%s", err)
+		return
+	}
+	query := validator.inflight[header.ID]
+	if !query.sent {
+		validator.mismatch(MismatchID, "response id %d not match any query", header.ID)
+		return
+	}
+	validator.inflight[header.ID] = inflightQuery{}
+	if header.Truncated {
+		validator.mismatch(MismatchTruncated, "%s %s truncated", query.name, dns.DNSTypeUintToString[query.qtype])
+		return
+	}
+	message, err := dns.ParseMessage(msg)
+	if err != nil {
+		validator.mismatch(MismatchParse, "%s %s: %s", query.name, dns.DNSTypeUintToString[query.qtype], err)
+		return
+	}
+	if len(message.Question) != 1 || !strings.EqualFold(message.Question[0].Name, query.name) ||
+		message.Question[0].Qtype != query.qtype {
+		validator.mismatch(MismatchQuestion, "%s %s: got question %+v", query.name, dns.DNSTypeUintToString[query.qtype], message.Question)
+		return
+	}
+	expectation, ok := validator.expectations[expectationKey(query.name, query.qtype)]
+	if !ok {
+		return
+	}
+	validator.checked++
+	if expectation.Rcode >= 0 && expectation.Rcode != header.Rcode {
+		validator.mismatch(MismatchRcode, "%s %s: expected %s, got %s", query.name, dns.DNSTypeUintToString[query.qtype],
+			dns.DNSRcodeReverse[uint8(expectation.Rcode)], dns.DNSRcodeReverse[uint8(header.Rcode)])
+		return
+	}
+	if expectation.Answers == nil && expectation.Pattern == nil {
+		return
+	}
+	var answers []string
+	for _, rr := range message.Answer {
+		if rr.Type == query.qtype {
+			answers = append(answers, dns.RdataString(msg, rr))
+		}
+	}
+	matched := len(answers) > 0
+	if expectation.Pattern != nil {
+		for _, answer := range answers {
+			matched = matched && expectation.Pattern.MatchString(answer)
+		}
+	} else {
+		// the rdata is compared case insensitive and the order is ignored
+		for i := range answers {
+			answers[i] = strings.ToLower(answers[i])
+		}
+		sort.Strings(answers)
+		matched = strings.Join(answers, ";") == strings.Join(expectation.Answers, ";")
+	}
+	if !matched {
+		validator.mismatch(MismatchAnswer, "%s %s: expected [%s], got [%s]", query.name, dns.DNSTypeUintToString[query.qtype],
+			expectationString(expectation), strings.Join(answers, "; "))
+	}
+}
+
+func expectationString(expectation *Expectation) string {
+	if expectation.Pattern != nil {
+		return "~" + expectation.Pattern.String()
+	}
+	return strings.Join(expectation.Answers, "; ")
+}
+
+// mismatch count the mismatch and keep the first samples
+func (validator *Validator) mismatch(kind string, format string, v ...interface{}) {
+	validator.mismatches[kind]++
+	if len(validator.samples) < maxMismatchSamples {
+		validator.samples = append(validator.samples, kind+" "+fmt.Sprintf(format, v...))
+	}
+}
+
+// Mismatches return the number of mismatches of each kind
+func (validator *Validator) Mismatches() map[string]uint64 {
+	validator.lock.Lock()
+	defer validator.lock.Unlock()
+	mismatches := make(map[string]uint64)
+	for kind, count := range validator.mismatches {
+		mismatches[kind] = count
+	}
+	return mismatches
+}
+
+// Report log the validation result
+func (validator *Validator) Report() {
+	validator.lock.Lock()
+	defer validator.lock.Unlock()
+	result := log.WithFields(log.Fields{"result": true})
+	var total uint64
+	var kinds []string
+	for kind, count := range validator.mismatches {
+		total += count
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	result.Infof("validation responses:%d checked:%d mismatches:%d", validator.responses, validator.checked, total)
+	for _, kind := range kinds {
+		result.Infof("mismatch %s:%d", kind, validator.mismatches[kind])
+	}
+	for _, sample := range validator.samples {
+		result.Infof("mismatch sample: %s", sample)
+	}
+}
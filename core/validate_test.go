@@ -0,0 +1,79 @@
+package core
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/zhangmingkai4315/dns-loader/dns"
+)
+
+func TestParseExpectations(t *testing.T) {
+	expectations, err := ParseExpectations(`
+# comment
+www.example.com A NOERROR 192.0.2.2; 192.0.2.1
+nx.example.com.  AAAA  nxdomain
+any.example.com TXT * ~^"v=spf1
+`)
+	OK(t, err)
+	Equals(t, 3, len(expectations))
+	www := expectations[expectationKey("www.example.com.", dns.TypeA)]
+	Equals(t, []string{"192.0.2.1", "192.0.2.2"}, www.Answers)
+	Equals(t, 3, expectations[expectationKey("NX.example.com", dns.TypeAAAA)].Rcode)
+	Equals(t, -1, expectations[expectationKey("any.example.com", dns.TypeTXT)].Rcode)
+
+	for _, invalid := range []string{"www.example.com A", "www.example.com BAD NOERROR", "www.example.com A WRONG", "www.example.com A * ~("} {
+		_, err := ParseExpectations(invalid)
+		Assert(t, err != nil, "expect error for %s", invalid)
+	}
+}
+
+// buildTestResponse return the response of query with rcode and the A
+// records of the ips
+func buildTestResponse(query []byte, rcode int, ips ...[]byte) []byte {
+	msg := append([]byte{}, query...)
+	msg[2] |= 0x80
+	msg[3] = msg[3]&0xf0 | byte(rcode)
+	binary.BigEndian.PutUint16(msg[6:], uint16(len(ips)))
+	for _, ip := range ips {
+		msg = append(msg, 0xc0, 12, 0, 1, 0, 1, 0, 0, 0, 60, 0, 4)
+		msg = append(msg, ip...)
+	}
+	return msg
+}
+
+func TestValidator(t *testing.T) {
+	validator, err := NewValidatorFromJob(&JobConfig{Expectations: "www.example.com A NOERROR 192.0.2.1\nnx.example.com A NXDOMAIN"})
+	OK(t, err)
+	newQuery := func(name string) []byte {
+		packet := new(dns.Packet)
+		packet.SetQuestion(name, dns.TypeA)
+		msg, _ := packet.ToBytes()
+		validator.Track(msg)
+		return msg
+	}
+
+	www := newQuery("www.example.com.")
+	validator.Check(buildTestResponse(www, 0, []byte{192, 0, 2, 1}))
+	Equals(t, 0, len(validator.Mismatches()))
+	// the query has been answered
+	validator.Check(buildTestResponse(www, 0, []byte{192, 0, 2, 1}))
+	Equals(t, uint64(1), validator.Mismatches()[MismatchID])
+
+	validator.Check(buildTestResponse(newQuery("www.example.com."), 0, []byte{192, 0, 2, 9}))
+	Equals(t, uint64(1), validator.Mismatches()[MismatchAnswer])
+	validator.Check(buildTestResponse(newQuery("nx.example.com."), 0))
+	Equals(t, uint64(1), validator.Mismatches()[MismatchRcode])
+
+	truncated := buildTestResponse(newQuery("other.example.com."), 0)
+	truncated[2] |= 0x02
+	validator.Check(truncated)
+	Equals(t, uint64(1), validator.Mismatches()[MismatchTruncated])
+
+	query := newQuery("www.example.com.")
+	other := newQuery("other.example.com.")
+	copy(other, query[:2])
+	validator.Check(buildTestResponse(other, 0))
+	Equals(t, uint64(1), validator.Mismatches()[MismatchQuestion])
+	Equals(t, uint64(3), validator.checked)
+	Equals(t, 5, len(validator.samples))
+}
@@ -0,0 +1,342 @@
+package core
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"go.uber.org/ratelimit"
+
+	"github.com/zhangmingkai4315/dns-loader/dns"
+)
+
+// xfrReadTimeout is the maximum time to wait for next message of transfer
+const xfrReadTimeout = 30 * time.Second
+
+var errTransferAborted = errors.New("transfer aborted")
+
+// transferLoader repeatedly transfer a zone over tcp with concurrent
+// workers, each worker use a new connection for each transfer and the
+// client number of workers are started for each target
+type transferLoader struct {
+	job       *JobConfig
+	addrLock  sync.Mutex
+	addresses []string
+	qtype     uint16
+	serial    uint32
+	query     []byte
+	tsig      *dns.TSIG
+	workers   int
+	qps       uint32
+	max       uint64
+	duration  time.Duration
+	status    uint32
+	ctx       context.Context
+	cancel    context.CancelFunc
+	startTime time.Time
+	callCount uint64
+	completed uint64
+	failed    uint64
+	aborted   uint64
+	bytes     uint64
+	records   uint64
+	durations *Histogram
+	rcodeLock sync.Mutex
+	rcodes    map[uint8]uint64
+}
+
+// NewTransferLoader create the load manager of zone transfer job
+func NewTransferLoader(app *AppController) (LoadManager, error) {
+	job := app.JobConfig
+	qtype := dns.TypeAXFR
+	if job.TransferType == "IXFR" {
+		qtype = dns.TypeIXFR
+	}
+	query, err := dns.NewTransferQuery(job.TransferZone, qtype, job.TransferSerial)
+	if err != nil {
+		return nil, err
+	}
+	tsig, err := job.NewTSIG()
+	if err != nil {
+		return nil, err
+	}
+	duration, err := time.ParseDuration(job.Duration)
+	if err != nil {
+		return nil, err
+	}
+	addresses, _, err := job.ResolveAddresses()
+	if err != nil {
+		return nil, err
+	}
+	workers := job.ClientNumber
+	if workers <= 0 {
+		workers = 1
+	}
+	workers *= len(addresses)
+	return &transferLoader{
+		job:       job,
+		addresses: addresses,
+		qtype:     qtype,
+		serial:    job.TransferSerial,
+		query:     query,
+		tsig:      tsig,
+		workers:   workers,
+		qps:       job.QPS,
+		max:       job.MaxQuery,
+		duration:  duration,
+		status:    StatusStopped,
+		durations: NewHistogram(),
+		rcodes:    make(map[uint8]uint64),
+	}, nil
+}
+
+func (loader *transferLoader) Start() bool {
+	if loader.Status() != StatusStopped {
+		return false
+	}
+	app := GetGlobalAppController()
+	atomic.StoreUint32(&loader.status, StatusRunning)
+	app.SetCurrentJobStatus(StatusRunning)
+	loader.ctx, loader.cancel = context.WithTimeout(context.Background(), loader.duration)
+	var limiter ratelimit.Limiter
+	if loader.qps > 0 {
+		limiter = ratelimit.New(int(loader.qps))
+	}
+	log.Printf("start %d concurrent transfers to %s and will stop at %s later", loader.workers, strings.Join(loader.addresses, ","), loader.duration)
+	if interval, _ := time.ParseDuration(loader.job.ResolveInterval); interval > 0 {
+		go loader.reresolve(interval)
+	}
+	loader.startTime = time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < loader.workers; i++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			loader.work(worker, limiter)
+		}(i)
+	}
+	wg.Wait()
+	loader.cancel()
+	loader.prepareStop()
+	return true
+}
+
+// address return the target address of the worker
+func (loader *transferLoader) address(worker int) string {
+	loader.addrLock.Lock()
+	defer loader.addrLock.Unlock()
+	return loader.addresses[worker%len(loader.addresses)]
+}
+
+// reresolve update the target addresses every interval until the job done
+func (loader *transferLoader) reresolve(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-loader.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		addresses, _, err := resolveJobTargets(loader.job)
+		if err == nil {
+			// the new addresses must be allowed by the safety policy too
+			err = GetGlobalAppController().Safety.CheckAddresses(addresses)
+		}
+		if err != nil {
+			log.Errorf("re-resolve dns targets fail: %s", err)
+			continue
+		}
+		loader.addrLock.Lock()
+		if strings.Join(addresses, ",") != strings.Join(loader.addresses, ",") {
+			log.Infof("dns targets changed to %s", strings.Join(addresses, ","))
+			loader.addresses = addresses
+		}
+		loader.addrLock.Unlock()
+	}
+}
+
+func (loader *transferLoader) work(worker int, limiter ratelimit.Limiter) {
+	for loader.ctx.Err() == nil {
+		if limiter != nil {
+			limiter.Take()
+		}
+		count := atomic.AddUint64(&loader.callCount, 1)
+		if loader.max != 0 && count > loader.max {
+			atomic.AddUint64(&loader.callCount, ^uint64(0))
+			return
+		}
+		start := time.Now()
+		err := loader.transfer(loader.address(worker))
+		switch {
+		case err == nil:
+			atomic.AddUint64(&loader.completed, 1)
+			loader.durations.Record(time.Since(start))
+		case err == errTransferAborted:
+			atomic.AddUint64(&loader.aborted, 1)
+		default:
+			log.Debugf("transfer fail: %v", err)
+			atomic.AddUint64(&loader.failed, 1)
+		}
+	}
+}
+
+// transfer do one zone transfer and return nil when the terminating
+// SOA is received
+func (loader *transferLoader) transfer(address string) error {
+	conn, err := net.DialTimeout("tcp", address, xfrReadTimeout)
+	if err != nil {
+		return err
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-loader.ctx.Done():
+			conn.Close()
+		case <-done:
+			conn.Close()
+		}
+	}()
+
+	query := make([]byte, 2, len(loader.query)+2)
+	query = append(query, loader.query...)
+	binary.BigEndian.PutUint16(query[2:], dns.GenerateRandomID(true))
+	if loader.tsig != nil {
+		query, _ = loader.tsig.Sign(make([]byte, 2, 512), query[2:], nil, time.Now())
+	}
+	binary.BigEndian.PutUint16(query, uint16(len(query)-2))
+	if _, err := conn.Write(query); err != nil {
+		return loader.transferError(err)
+	}
+
+	reader := bufio.NewReader(conn)
+	length := make([]byte, 2)
+	state := dns.NewTransferState(loader.qtype, loader.serial)
+	for first := true; !state.Done(); first = false {
+		conn.SetReadDeadline(time.Now().Add(xfrReadTimeout))
+		if _, err := io.ReadFull(reader, length); err != nil {
+			return loader.transferError(err)
+		}
+		msg := make([]byte, binary.BigEndian.Uint16(length))
+		if _, err := io.ReadFull(reader, msg); err != nil {
+			return loader.transferError(err)
+		}
+		atomic.AddUint64(&loader.bytes, uint64(len(msg)+2))
+		message, err := dns.ParseMessage(msg)
+		if err != nil {
+			return err
+		}
+		if first {
+			loader.rcodeLock.Lock()
+			loader.rcodes[uint8(message.Header.Rcode)]++
+			loader.rcodeLock.Unlock()
+		}
+		if message.Header.Rcode != dns.RcodeSuccess {
+			return errors.New("transfer refused with rcode " + dns.DNSRcodeReverse[uint8(message.Header.Rcode)])
+		}
+		before := state.Records
+		if err := state.Add(msg, message.Answer); err != nil {
+			return err
+		}
+		atomic.AddUint64(&loader.records, state.Records-before)
+	}
+	return nil
+}
+
+func (loader *transferLoader) transferError(err error) error {
+	if loader.ctx.Err() != nil {
+		return errTransferAborted
+	}
+	return err
+}
+
+func (loader *transferLoader) prepareStop() {
+	app := GetGlobalAppController()
+	atomic.StoreUint32(&loader.status, StatusStopping)
+	app.SetCurrentJobStatus(StatusStopping)
+	runningTime := time.Since(loader.startTime)
+	seconds := runningTime.Seconds()
+	completed := atomic.LoadUint64(&loader.completed)
+	transferBytes := atomic.LoadUint64(&loader.bytes)
+	result := log.WithFields(log.Fields{"result": true})
+	result.Infof("total transfers:%d", loader.CallCount())
+	result.Infof("runing time %v", runningTime)
+	result.Infof("transfers completed:%d failed:%d aborted:%d", completed, atomic.LoadUint64(&loader.failed), atomic.LoadUint64(&loader.aborted))
+	result.Infof("transfers per second:%.2f", float64(completed)/seconds)
+	result.Infof("bytes:%d [%.2f bytes per second]", transferBytes, float64(transferBytes)/seconds)
+	result.Infof("records:%d", atomic.LoadUint64(&loader.records))
+	summary := loader.durations.Summary()
+	result.Infof("transfer duration min:%v mean:%v p50:%v p90:%v p99:%v max:%v",
+		summary.Min, summary.Mean, summary.P50, summary.P90, summary.P99, summary.Max)
+	// the first message of each transfer is counted as the response
+	report := &Report{
+		Job:         reportJob(loader.job),
+		StartTime:   loader.startTime,
+		RunningTime: runningTime,
+		Sent:        loader.CallCount(),
+		TargetQPS:   loader.qps,
+		QPS:         float64(loader.CallCount()) / seconds,
+		Rcodes:      make(map[string]uint64),
+		Latency:     summary,
+	}
+	loader.rcodeLock.Lock()
+	var rcodes []string
+	for code, count := range loader.rcodes {
+		rcodes = append(rcodes, dns.DNSRcodeReverse[code]+":"+strconv.FormatUint(count, 10))
+		report.Rcodes[dns.DNSRcodeReverse[code]] = count
+		report.Received += count
+	}
+	loader.rcodeLock.Unlock()
+	if len(rcodes) > 0 {
+		result.Infof("status %s", strings.Join(rcodes, " "))
+	}
+	if report.Sent > report.Received {
+		report.Unknown = report.Sent - report.Received
+	}
+	evaluateJobAssertions(loader.job, report)
+	app.SetReport(report)
+	atomic.StoreUint32(&loader.status, StatusStopped)
+	app.SetCurrentJobStatus(StatusStopped)
+	log.Info("stop success!")
+}
+
+func (loader *transferLoader) Stop() bool {
+	if !atomic.CompareAndSwapUint32(&loader.status, StatusRunning, StatusStopping) {
+		return false
+	}
+	loader.cancel()
+	for atomic.LoadUint32(&loader.status) != StatusStopped {
+		time.Sleep(time.Millisecond)
+	}
+	return true
+}
+
+func (loader *transferLoader) Status() uint32 {
+	return atomic.LoadUint32(&loader.status)
+}
+
+func (loader *transferLoader) CallCount() uint64 {
+	return atomic.LoadUint64(&loader.callCount)
+}
+
+// GenTransferFromConfig run the zone transfer job
+func GenTransferFromConfig(appController *AppController) error {
+	loader, err := NewTransferLoader(appController)
+	if err != nil {
+		log.Errorf("create transfer loader fail:%s", err)
+		return err
+	}
+	appController.LoadManager = loader
+	loader.Start()
+	return nil
+}
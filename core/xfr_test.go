@@ -0,0 +1,92 @@
+package core
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/zhangmingkai4315/dns-loader/dns"
+)
+
+// serveTestTransfer answer each transfer with a zone of one SOA and one
+// A record split into two messages
+func serveTestTransfer(listener net.Listener) {
+	soa := []byte{0xc0, 12, 0, 6, 0, 1, 0, 0, 0, 0, 0, 22, 0, 0, 0, 0, 0, 10, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}
+	a := []byte{0xc0, 12, 0, 1, 0, 1, 0, 0, 0, 0, 0, 4, 192, 0, 2, 1}
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		length := make([]byte, 2)
+		io.ReadFull(conn, length)
+		query := make([]byte, binary.BigEndian.Uint16(length))
+		io.ReadFull(conn, query)
+		for _, records := range [][][]byte{{soa, a}, {soa}} {
+			msg := append([]byte{}, query...)
+			msg[2] |= 0x80
+			binary.BigEndian.PutUint16(msg[6:], uint16(len(records)))
+			for _, record := range records {
+				msg = append(msg, record...)
+			}
+			conn.Write(append([]byte{byte(len(msg) >> 8), byte(len(msg))}, msg...))
+		}
+		conn.Close()
+	}
+}
+
+func TestTransfer(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	OK(t, err)
+	defer listener.Close()
+	go serveTestTransfer(listener)
+
+	job := NewDefaultJobConfig()
+	job.JobType = JobTypeXFR
+	job.TransferZone = "example.com"
+	job.Duration = "10s"
+	job.Server, job.Port, _ = net.SplitHostPort(listener.Addr().String())
+	manager, err := NewTransferLoader(&AppController{JobConfig: job})
+	OK(t, err)
+	loader := manager.(*transferLoader)
+	loader.ctx, loader.cancel = context.WithCancel(context.Background())
+	defer loader.cancel()
+	for i := 0; i < 2; i++ {
+		OK(t, loader.transfer(loader.addresses[0]))
+	}
+	Equals(t, uint64(6), loader.records)
+	Equals(t, uint64(2), loader.rcodes[dns.RcodeSuccess])
+}
+
+func TestTransferReport(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	OK(t, err)
+	defer listener.Close()
+	go serveTestTransfer(listener)
+
+	job := NewDefaultJobConfig()
+	job.JobType = JobTypeXFR
+	job.TransferZone = "example.com"
+	job.Duration = "10s"
+	job.MaxQuery = 2
+	job.ClientNumber = 1
+	job.Assertions = "success_ratio >= 99.9, sent == 3"
+	job.Server, job.Port, _ = net.SplitHostPort(listener.Addr().String())
+	app := GetGlobalAppController()
+	app.JobConfig = job
+	// the report of last job is not taken by the transfer job
+	app.SetReport(&Report{Sent: 100})
+	defer app.SetReport(nil)
+	OK(t, GenTrafficFromConfig(app))
+	report := app.LastReport()
+	Assert(t, report != nil, "expect the report of transfer job")
+	Equals(t, uint64(2), report.Sent)
+	Equals(t, uint64(2), report.Received)
+	Equals(t, map[string]uint64{"Success": 2}, report.Rcodes)
+	Equals(t, uint64(2), report.Latency.Count)
+	Equals(t, 2, len(report.Assertions))
+	Assert(t, report.Assertions[0].Passed, "expect success ratio passed")
+	Assert(t, !report.Assertions[1].Passed, "expect sent assertion failed")
+}
@@ -272,14 +272,15 @@ var DNSRcode = map[string]int{
 
 // DNSRcodeReverse define the real code to string map
 var DNSRcodeReverse = map[uint8]string{
-	0: "Success",
-	1: "FormatError",
-	2: "ServerFail",
-	3: "NXDOMAIN",
-	4: "NotImplemented",
-	5: "Refused",
-	6: "YXDOMAIN",
-	7: "XRRSET",
-	8: "NotAuth",
-	9: "NotInZone",
+	0:  "Success",
+	1:  "FormatError",
+	2:  "ServerFail",
+	3:  "NXDOMAIN",
+	4:  "NotImplemented",
+	5:  "Refused",
+	6:  "YXDOMAIN",
+	7:  "YXRRSET",
+	8:  "NXRRSET",
+	9:  "NotAuth",
+	10: "NotZone",
 }
@@ -101,8 +101,10 @@ type Packet struct {
 	AuthorityRRs   uint16
 	AdditionRRs    uint16
 	Question       []Question // Holds the RR(s) of the question section.
+	EDNS           *EDNS
 	RawByte        []byte
 	init           bool
+	optOffset      int
 	lock           sync.Mutex
 	RandomLength   int
 	RandomType     bool
@@ -110,27 +112,34 @@ type Packet struct {
 }
 
 // SetQuestion will set the basic dns packet infomation
-func (dns *Packet) SetQuestion(name string, dnstype uint16, enableEDNS, enableDNSSEC bool) *Packet {
+func (dns *Packet) SetQuestion(name string, dnstype uint16) *Packet {
 	dns.Header.ID = GenerateRandomID(true)
 	dns.Header.RecursionDesired = true
-	log.Infof("enable ends = %v enable dnssec = %v", enableEDNS, enableDNSSEC)
-	if enableDNSSEC || enableEDNS {
-		dns.Header.AuthenticatedData = true
-		dns.AdditionRRs = 1
-	}
 	dns.Questions = 1
 	dns.Question = make([]Question, 1)
 	dns.Question[0] = Question{name, dnstype, ClassINET}
 	return dns
 }
 
+// SetEDNS will add the OPT record to the packet, nil to remove it
+func (dns *Packet) SetEDNS(edns *EDNS) *Packet {
+	dns.EDNS = edns
+	if edns == nil {
+		dns.Header.AuthenticatedData = false
+		dns.AdditionRRs = 0
+		return dns
+	}
+	log.Infof("enable edns = true enable dnssec = %v", edns.DO)
+	dns.Header.AuthenticatedData = true
+	dns.AdditionRRs = 1
+	return dns
+}
+
 // ToBytes will generate the first raw bytes of the dns packet
-func (dns *Packet) ToBytes(edns bool, dnssec bool) (msg []byte, err error) {
+func (dns *Packet) ToBytes() (msg []byte, err error) {
 	var rawheader RawHeader
 	header := dns.Header
 	rawheader.ID = header.ID
-	var ednsBytes = []byte{0, 0, 41, 16, 0, 0, 0, 0, 0, 0, 0}
-	var dnssecBytes = []byte{0, 0, 41, 16, 0, 0, 0, 128, 0, 0, 0}
 	rawheader.Bits = uint16(header.Opcode)<<11 | uint16(header.Rcode)
 	if header.Response {
 		rawheader.Bits |= _QR
@@ -171,12 +180,11 @@ func (dns *Packet) ToBytes(edns bool, dnssec bool) (msg []byte, err error) {
 	if err != nil {
 		return nil, err
 	}
-	if dnssec == true {
-		msg = append(msg, dnssecBytes...)
-		offset += 11
-	} else if edns == true {
-		msg = append(msg, ednsBytes...)
-		offset += 11
+	dns.optOffset = offset
+	if dns.EDNS != nil {
+		opt := dns.EDNS.Pack(offset)
+		msg = append(msg, opt...)
+		offset += len(opt)
 	}
 
 	if dns.Protocol == "tcp" {
@@ -190,6 +198,24 @@ func (dns *Packet) ToBytes(edns bool, dnssec bool) (msg []byte, err error) {
 	return msg[:offset], nil
 }
 
+// UpdateEDNSToBytes function rebuild the OPT record of the packet []byte
+// after the EDNS setting changed and return the new raw data
+func (dns *Packet) UpdateEDNSToBytes(offset int) (msg []byte, err error) {
+	if len(dns.RawByte) == 0 || dns.init == false {
+		return nil, errors.New("Please call ToBytes() before generate more packet")
+	}
+	if dns.EDNS == nil {
+		return dns.RawByte, nil
+	}
+	rawByte := append(dns.RawByte[:offset+dns.optOffset], dns.EDNS.Pack(dns.optOffset)...)
+	if offset != 0 {
+		// the first two oct is size of packet in tcp mode
+		packUint16(uint16(len(rawByte)-offset), rawByte, 0)
+	}
+	dns.RawByte = rawByte
+	return rawByte, nil
+}
+
 // UpdateSubDomainToBytes function update the packet []byte with the new domain name
 // and return the new raw data
 func (dns *Packet) UpdateSubDomainToBytes(domain string, offset int) (msg []byte, err error) {
@@ -319,18 +345,20 @@ func (dns *Packet) GeneratePacket(server string, total int, timeout int, qps int
 	return counter
 }
 
-// InitialPacket initial the basic setup
+// InitialPacket initial the basic setup, edns is nil when not
+// using EDNS0
 func (dns *Packet) InitialPacket(
 	protocol string,
 	domain string,
 	length int,
 	queryType uint16,
-	enableEDNS, enableDNSSEC bool,
+	edns *EDNS,
 ) {
 	log.Infof("dns packet info :[protocol=%s, domain=%s,length=%d,type=%d]", protocol, domain, length, queryType)
 	dns.Protocol = protocol
-	dns.SetQuestion(FqdnFormat(GenRandomDomain(length, domain)), queryType, enableEDNS, enableDNSSEC)
-	dns.ToBytes(enableEDNS, enableDNSSEC)
+	dns.SetQuestion(FqdnFormat(GenRandomDomain(length, domain)), queryType)
+	dns.SetEDNS(edns)
+	dns.ToBytes()
 	dns.RandomLength = length
 	dns.OriginalDomain = domain
 }
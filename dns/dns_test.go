@@ -3,7 +3,7 @@ package dns
 import "testing"
 
 func TestSetQuestion(t *testing.T) {
-	packet := new(DNSPacket)
+	packet := new(Packet)
 	domain := "github.com"
 	packet.SetQuestion(FqdnFormat(domain), TypeA)
 	if packet.Questions != 1 {
@@ -21,7 +21,7 @@ func TestSetQuestion(t *testing.T) {
 }
 
 func TestToBytes(t *testing.T) {
-	packet := new(DNSPacket)
+	packet := new(Packet)
 	domain := "github.com"
 	packet.SetQuestion(domain, TypeA)
 	rawPacket, err := packet.ToBytes()
@@ -35,14 +35,14 @@ func TestToBytes(t *testing.T) {
 }
 
 func TestUpdateSubDomainToBytes(t *testing.T) {
-	packet := new(DNSPacket)
+	packet := new(Packet)
 	domain := "github.com"
 	packet.SetQuestion(domain, TypeA)
 	rawPacket, err := packet.ToBytes()
 	if err != nil {
 		t.Errorf("%v: expected, Got %v", nil, err)
 	}
-	packet.UpdateSubDomainToBytes("hithub.com")
+	packet.UpdateSubDomainToBytes("hithub.com", 0)
 	expect := []byte{1, 0, 0, 1, 0, 0, 0, 0, 0, 0, 6, 104, 105, 116, 104, 117, 98, 3, 99, 111, 109, 0, 0, 1, 0, 1}
 	if !ByteSliceCompare(rawPacket[2:], expect) {
 		t.Errorf("%v: expected, Got %v", rawPacket, nil)
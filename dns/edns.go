@@ -0,0 +1,261 @@
+package dns
+
+import (
+	crand "crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"strings"
+)
+
+// EDNS0 option codes
+const (
+	EDNS0NSID      = 3
+	EDNS0SUBNET    = 8
+	EDNS0COOKIE    = 10
+	EDNS0KEEPALIVE = 11
+	EDNS0PADDING   = 12
+)
+
+// Default setting of edns
+const (
+	DefaultUDPSize        = 4096
+	DefaultV4PrefixLength = 24
+	DefaultV6PrefixLength = 56
+	// DefaultPaddingBlock is the block size recommended by RFC 8467 for queries
+	DefaultPaddingBlock = 128
+	clientCookieLength  = 8
+)
+
+// EDNS hold the setting of OPT pseudo record of the query
+type EDNS struct {
+	UDPSize uint16
+	Version uint8
+	DO      bool
+	// NSID request the name server identifier (RFC 5001)
+	NSID bool
+	// Cookie is the client cookie with the optional server cookie (RFC 7873)
+	Cookie []byte
+	// KeepAlive send the edns-tcp-keepalive option (RFC 7828)
+	KeepAlive bool
+	Subnet    *ClientSubnet
+	// Padding pad the message to a multiple of the block size (RFC 7830),
+	// 0 means no padding. The records appended after packing such as TSIG
+	// are not counted in
+	Padding int
+}
+
+// Pack return the wire format of OPT record, msgLen is the length of the
+// message before the OPT record which is used to calculate the padding
+func (edns *EDNS) Pack(msgLen int) []byte {
+	var options []byte
+	if edns.NSID {
+		options = appendEDNSOption(options, EDNS0NSID, nil)
+	}
+	if edns.Subnet != nil {
+		options = append(options, edns.Subnet.Pack()...)
+	}
+	if len(edns.Cookie) > 0 {
+		options = appendEDNSOption(options, EDNS0COOKIE, edns.Cookie)
+	}
+	if edns.KeepAlive {
+		options = appendEDNSOption(options, EDNS0KEEPALIVE, nil)
+	}
+	if edns.Padding > 0 {
+		// total length with the 11 bytes OPT header and 4 bytes option header
+		total := msgLen + 11 + len(options) + 4
+		padding := 0
+		if remain := total % edns.Padding; remain != 0 {
+			padding = edns.Padding - remain
+		}
+		options = appendEDNSOption(options, EDNS0PADDING, make([]byte, padding))
+	}
+	msg := make([]byte, 11, 11+len(options))
+	// root name and type OPT
+	binary.BigEndian.PutUint16(msg[1:], TypeOPT)
+	binary.BigEndian.PutUint16(msg[3:], edns.UDPSize)
+	msg[6] = edns.Version
+	if edns.DO {
+		msg[7] = 0x80
+	}
+	binary.BigEndian.PutUint16(msg[9:], uint16(len(options)))
+	return append(msg, options...)
+}
+
+func appendEDNSOption(options []byte, code uint16, data []byte) []byte {
+	head := make([]byte, 4)
+	binary.BigEndian.PutUint16(head, code)
+	binary.BigEndian.PutUint16(head[2:], uint16(len(data)))
+	options = append(options, head...)
+	return append(options, data...)
+}
+
+// NewClientCookie generate a random client cookie
+func NewClientCookie() []byte {
+	cookie := make([]byte, clientCookieLength)
+	if _, err := crand.Read(cookie); err != nil {
+		rand.Read(cookie)
+	}
+	return cookie
+}
+
+// ServerCookie return the server cookie in the response when the client
+// cookie part match the one we sent, nil if not found
+func ServerCookie(msg []byte, clientCookie []byte) []byte {
+	message, err := ParseMessage(msg)
+	if err != nil {
+		return nil
+	}
+	opt := message.OPT()
+	if opt == nil {
+		return nil
+	}
+	options, _ := UnpackEDNSOptions(opt.Rdata)
+	for _, option := range options {
+		if option.Code != EDNS0COOKIE || len(option.Data) <= clientCookieLength {
+			continue
+		}
+		if !ByteSliceCompare(option.Data[:clientCookieLength], clientCookie[:clientCookieLength]) {
+			return nil
+		}
+		server := make([]byte, len(option.Data)-clientCookieLength)
+		copy(server, option.Data[clientCookieLength:])
+		return server
+	}
+	return nil
+}
+
+// ClientSubnet is the edns client subnet option (RFC 7871)
+type ClientSubnet struct {
+	Family       uint16
+	SourcePrefix uint8
+	ScopePrefix  uint8
+	Address      net.IP
+}
+
+// Pack return the wire format of ecs option
+func (subnet *ClientSubnet) Pack() []byte {
+	address := subnet.Address.To4()
+	if subnet.Family == 2 {
+		address = subnet.Address.To16()
+	}
+	addrLen := (int(subnet.SourcePrefix) + 7) / 8
+	if addrLen > len(address) {
+		addrLen = len(address)
+	}
+	msg := make([]byte, 8+addrLen)
+	binary.BigEndian.PutUint16(msg[0:], EDNS0SUBNET)
+	binary.BigEndian.PutUint16(msg[2:], uint16(4+addrLen))
+	binary.BigEndian.PutUint16(msg[4:], subnet.Family)
+	msg[6] = subnet.SourcePrefix
+	msg[7] = subnet.ScopePrefix
+	copy(msg[8:], address[:addrLen])
+	return msg
+}
+
+// String return the subnet in cidr format
+func (subnet *ClientSubnet) String() string {
+	return fmt.Sprintf("%s/%d", subnet.Address, subnet.SourcePrefix)
+}
+
+// SubnetGenerator pick the client subnet for each query
+type SubnetGenerator struct {
+	networks []*net.IPNet
+	random   bool
+	v4Prefix int
+	v6Prefix int
+}
+
+// NewSubnetGenerator create a generator from a comma separated cidr list,
+// in random mode each query will use a random prefix of prefixLength
+// inside one of the cidr, prefixLength 0 means the default length
+func NewSubnetGenerator(subnets string, random bool, prefixLength int) (*SubnetGenerator, error) {
+	generator := &SubnetGenerator{
+		random:   random,
+		v4Prefix: DefaultV4PrefixLength,
+		v6Prefix: DefaultV6PrefixLength,
+	}
+	if prefixLength < 0 || prefixLength > 128 {
+		return nil, errors.New("invalid ecs prefix length")
+	}
+	if prefixLength > 0 {
+		generator.v4Prefix = prefixLength
+		generator.v6Prefix = prefixLength
+		if prefixLength > 32 {
+			generator.v4Prefix = 32
+		}
+	}
+	for _, item := range strings.Split(subnets, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if !strings.Contains(item, "/") {
+			if strings.Contains(item, ":") {
+				item = item + "/128"
+			} else {
+				item = item + "/32"
+			}
+		}
+		_, network, err := net.ParseCIDR(item)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ecs subnet %s", item)
+		}
+		generator.networks = append(generator.networks, network)
+	}
+	if len(generator.networks) == 0 {
+		return nil, errors.New("ecs subnet is empty")
+	}
+	return generator, nil
+}
+
+// Random return true when each query use a new subnet
+func (generator *SubnetGenerator) Random() bool {
+	return generator.random
+}
+
+// Next return the client subnet for next query
+func (generator *SubnetGenerator) Next() *ClientSubnet {
+	if !generator.random {
+		return newClientSubnet(generator.networks[0].IP, maskOnes(generator.networks[0]))
+	}
+	network := generator.networks[rand.Intn(len(generator.networks))]
+	ones, bits := network.Mask.Size()
+	prefix := generator.v6Prefix
+	if bits == 32 {
+		prefix = generator.v4Prefix
+	}
+	if prefix < ones {
+		prefix = ones
+	}
+	address := make(net.IP, len(network.IP))
+	copy(address, network.IP)
+	// fill the host bits between network mask and the prefix length
+	for i := ones; i < prefix; i++ {
+		if rand.Intn(2) == 1 {
+			address[i/8] |= 0x80 >> uint(i%8)
+		}
+	}
+	return newClientSubnet(address, prefix)
+}
+
+func maskOnes(network *net.IPNet) int {
+	ones, _ := network.Mask.Size()
+	return ones
+}
+
+func newClientSubnet(address net.IP, prefix int) *ClientSubnet {
+	subnet := &ClientSubnet{
+		Family:       1,
+		SourcePrefix: uint8(prefix),
+	}
+	if v4 := address.To4(); v4 != nil {
+		subnet.Address = v4.Mask(net.CIDRMask(prefix, 32))
+		return subnet
+	}
+	subnet.Family = 2
+	subnet.Address = address.To16().Mask(net.CIDRMask(prefix, 128))
+	return subnet
+}
@@ -0,0 +1,137 @@
+package dns
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+)
+
+func TestEDNSPack(t *testing.T) {
+	var cases = []struct {
+		input  EDNS
+		expect []byte
+	}{
+		{
+			EDNS{UDPSize: 4096},
+			[]byte{0, 0, 41, 16, 0, 0, 0, 0, 0, 0, 0},
+		},
+		{
+			EDNS{UDPSize: 4096, DO: true},
+			[]byte{0, 0, 41, 16, 0, 0, 0, 128, 0, 0, 0},
+		},
+		{
+			EDNS{UDPSize: 512, Subnet: &ClientSubnet{Family: 1, SourcePrefix: 24, Address: net.ParseIP("192.0.2.0")}},
+			[]byte{0, 0, 41, 2, 0, 0, 0, 0, 0, 0, 11, 0, 8, 0, 7, 0, 1, 24, 0, 192, 0, 2},
+		},
+		{
+			EDNS{UDPSize: 1232, Version: 1, NSID: true, KeepAlive: true},
+			[]byte{0, 0, 41, 4, 208, 0, 1, 0, 0, 0, 8, 0, 3, 0, 0, 0, 11, 0, 0},
+		},
+		{
+			EDNS{UDPSize: 4096, Cookie: []byte{1, 2, 3, 4, 5, 6, 7, 8}},
+			[]byte{0, 0, 41, 16, 0, 0, 0, 0, 0, 0, 12, 0, 10, 0, 8, 1, 2, 3, 4, 5, 6, 7, 8},
+		},
+	}
+	for _, test := range cases {
+		output := test.input.Pack(0)
+		if !ByteSliceCompare(test.expect, output) {
+			t.Errorf("%v: expected, Got %v", test.expect, output)
+		}
+	}
+}
+
+func TestSubnetGenerator(t *testing.T) {
+	generator, err := NewSubnetGenerator("10.1.0.0/16", false, 0)
+	if err != nil {
+		t.Fatalf("%v: expected, Got %v", nil, err)
+	}
+	if subnet := generator.Next(); subnet.String() != "10.1.0.0/16" {
+		t.Errorf("%v: expected, Got %v", "10.1.0.0/16", subnet)
+	}
+	generator, err = NewSubnetGenerator("10.1.0.0/16, 2001:db8::/32", true, 0)
+	if err != nil {
+		t.Fatalf("%v: expected, Got %v", nil, err)
+	}
+	_, v4, _ := net.ParseCIDR("10.1.0.0/16")
+	_, v6, _ := net.ParseCIDR("2001:db8::/32")
+	for i := 0; i < 100; i++ {
+		subnet := generator.Next()
+		switch subnet.Family {
+		case 1:
+			if subnet.SourcePrefix != DefaultV4PrefixLength || !v4.Contains(subnet.Address) {
+				t.Errorf("unexpected subnet %v", subnet)
+			}
+		case 2:
+			if subnet.SourcePrefix != DefaultV6PrefixLength || !v6.Contains(subnet.Address) {
+				t.Errorf("unexpected subnet %v", subnet)
+			}
+		}
+	}
+	if _, err := NewSubnetGenerator("not-a-subnet", true, 0); err == nil {
+		t.Errorf("expect error for invalid subnet")
+	}
+}
+
+func TestUpdateEDNSToBytes(t *testing.T) {
+	packet := new(Packet)
+	packet.Protocol = "tcp"
+	packet.SetQuestion("github.com", TypeA)
+	packet.SetEDNS(&EDNS{UDPSize: 4096})
+	rawPacket, err := packet.ToBytes()
+	if err != nil {
+		t.Errorf("%v: expected, Got %v", nil, err)
+	}
+	if int(binary.BigEndian.Uint16(rawPacket)) != len(rawPacket)-2 {
+		t.Errorf("%v: expected, Got %v", len(rawPacket)-2, binary.BigEndian.Uint16(rawPacket))
+	}
+	packet.EDNS.Subnet = &ClientSubnet{Family: 1, SourcePrefix: 24, Address: net.ParseIP("192.0.2.0")}
+	rawPacket, err = packet.UpdateEDNSToBytes(2)
+	if err != nil {
+		t.Errorf("%v: expected, Got %v", nil, err)
+	}
+	if int(binary.BigEndian.Uint16(rawPacket)) != len(rawPacket)-2 {
+		t.Errorf("%v: expected, Got %v", len(rawPacket)-2, binary.BigEndian.Uint16(rawPacket))
+	}
+	if binary.BigEndian.Uint16(rawPacket[len(rawPacket)-13:]) != 11 {
+		t.Errorf("%v: expected, Got %v", 11, rawPacket[len(rawPacket)-13:])
+	}
+}
+
+func TestEDNSPadding(t *testing.T) {
+	packet := new(Packet)
+	packet.Protocol = "udp"
+	packet.SetQuestion("github.com.", TypeA)
+	packet.SetEDNS(&EDNS{UDPSize: 4096, Padding: DefaultPaddingBlock})
+	rawPacket, err := packet.ToBytes()
+	if err != nil {
+		t.Fatalf("%v: expected, Got %v", nil, err)
+	}
+	if len(rawPacket) != DefaultPaddingBlock {
+		t.Errorf("%v: expected, Got %v", DefaultPaddingBlock, len(rawPacket))
+	}
+	message, err := ParseMessage(rawPacket)
+	if err != nil {
+		t.Fatalf("%v: expected, Got %v", nil, err)
+	}
+	options, err := UnpackEDNSOptions(message.OPT().Rdata)
+	if err != nil || len(options) != 1 || options[0].Code != EDNS0PADDING {
+		t.Errorf("unexpected options %v, %v", options, err)
+	}
+}
+
+func TestServerCookie(t *testing.T) {
+	clientCookie := NewClientCookie()
+	serverCookie := []byte{9, 9, 9, 9, 9, 9, 9, 9}
+	packet := new(Packet)
+	packet.Protocol = "udp"
+	packet.SetQuestion("github.com.", TypeA)
+	packet.SetEDNS(&EDNS{UDPSize: 4096, Cookie: append(append([]byte{}, clientCookie...), serverCookie...)})
+	response, _ := packet.ToBytes()
+	response[2] |= 0x80
+	if output := ServerCookie(response, clientCookie); !ByteSliceCompare(serverCookie, output) {
+		t.Errorf("%v: expected, Got %v", serverCookie, output)
+	}
+	if output := ServerCookie(response, NewClientCookie()); output != nil {
+		t.Errorf("%v: expected, Got %v", nil, output)
+	}
+}
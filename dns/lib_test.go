@@ -125,7 +125,7 @@ func TestGetDNSTypeCodeFromString(t *testing.T) {
 	},
 	}
 	for _, obj := range testCase {
-		output := GetDNSTypeCodeFromString(obj.input)
+		output, _ := GetDNSTypeCodeFromString(obj.input)
 		if output != uint16(obj.expect) {
 			t.Errorf("Expect %d: Got %d", obj.expect, output)
 		}
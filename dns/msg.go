@@ -0,0 +1,280 @@
+package dns
+
+import (
+	"encoding/binary"
+	"errors"
+	"strings"
+)
+
+// RR holds a resource record of a parsed message, the rdata
+// is kept in wire format
+type RR struct {
+	Name  string
+	Type  uint16
+	Class uint16
+	TTL   uint32
+	Rdata []byte
+	// Offset is the start position of the record in the message
+	Offset int
+}
+
+// Message holds a parsed dns message
+type Message struct {
+	Header     DNSHeader
+	Question   []Question
+	Answer     []RR
+	Authority  []RR
+	Additional []RR
+}
+
+// EDNSOption holds one option of the OPT record
+type EDNSOption struct {
+	Code uint16
+	Data []byte
+}
+
+var errTruncatedMessage = errors.New("dns message is truncated")
+
+// UnpackDomainName read a domain name from the message start at off
+// and follow the compression pointers, it return the name and the
+// offset after the name
+func UnpackDomainName(msg []byte, off int) (string, int, error) {
+	var labels []string
+	end := -1
+	jumps := 0
+	for {
+		if off >= len(msg) {
+			return "", 0, errTruncatedMessage
+		}
+		c := int(msg[off])
+		switch c & 0xc0 {
+		case 0x00:
+			if c == 0 {
+				if end < 0 {
+					end = off + 1
+				}
+				if len(labels) == 0 {
+					return ".", end, nil
+				}
+				return strings.Join(labels, ".") + ".", end, nil
+			}
+			if off+1+c > len(msg) {
+				return "", 0, errTruncatedMessage
+			}
+			labels = append(labels, string(msg[off+1:off+1+c]))
+			off += 1 + c
+		case 0xc0:
+			if off+2 > len(msg) {
+				return "", 0, errTruncatedMessage
+			}
+			if end < 0 {
+				end = off + 2
+			}
+			jumps++
+			if jumps > maxCompressionPointers {
+				return "", 0, errors.New("too many compression pointers")
+			}
+			off = int(binary.BigEndian.Uint16(msg[off:]) & 0x3fff)
+		default:
+			return "", 0, errors.New("invalid domain name label")
+		}
+	}
+}
+
+const maxCompressionPointers = 126
+
+// UnpackHeader decode the header bits of message
+func UnpackHeader(msg []byte) (DNSHeader, error) {
+	if len(msg) < headerSize {
+		return DNSHeader{}, errTruncatedMessage
+	}
+	bits := binary.BigEndian.Uint16(msg[2:])
+	return DNSHeader{
+		ID:                 binary.BigEndian.Uint16(msg),
+		Response:           bits&_QR != 0,
+		Opcode:             int(bits>>11) & 0xf,
+		Authoritative:      bits&_AA != 0,
+		Truncated:          bits&_TC != 0,
+		RecursionDesired:   bits&_RD != 0,
+		RecursionAvailable: bits&_RA != 0,
+		Zero:               bits&_Z != 0,
+		AuthenticatedData:  bits&_AD != 0,
+		CheckingDisabled:   bits&_CD != 0,
+		Rcode:              int(bits & 0xf),
+	}, nil
+}
+
+// ParseMessage decode the message in wire format
+func ParseMessage(msg []byte) (*Message, error) {
+	header, err := UnpackHeader(msg)
+	if err != nil {
+		return nil, err
+	}
+	message := &Message{Header: header}
+	qdcount := int(binary.BigEndian.Uint16(msg[4:]))
+	counts := []int{
+		int(binary.BigEndian.Uint16(msg[6:])),
+		int(binary.BigEndian.Uint16(msg[8:])),
+		int(binary.BigEndian.Uint16(msg[10:])),
+	}
+	off := headerSize
+	for i := 0; i < qdcount; i++ {
+		name, next, err := UnpackDomainName(msg, off)
+		if err != nil {
+			return message, err
+		}
+		if next+4 > len(msg) {
+			return message, errTruncatedMessage
+		}
+		message.Question = append(message.Question, Question{
+			Name:   name,
+			Qtype:  binary.BigEndian.Uint16(msg[next:]),
+			Qclass: binary.BigEndian.Uint16(msg[next+2:]),
+		})
+		off = next + 4
+	}
+	sections := []*[]RR{&message.Answer, &message.Authority, &message.Additional}
+	for i, section := range sections {
+		for j := 0; j < counts[i]; j++ {
+			var rr RR
+			rr, off, err = unpackRR(msg, off)
+			if err != nil {
+				return message, err
+			}
+			*section = append(*section, rr)
+		}
+	}
+	return message, nil
+}
+
+func unpackRR(msg []byte, off int) (RR, int, error) {
+	rr := RR{Offset: off}
+	name, next, err := UnpackDomainName(msg, off)
+	if err != nil {
+		return rr, 0, err
+	}
+	if next+10 > len(msg) {
+		return rr, 0, errTruncatedMessage
+	}
+	rr.Name = name
+	rr.Type = binary.BigEndian.Uint16(msg[next:])
+	rr.Class = binary.BigEndian.Uint16(msg[next+2:])
+	rr.TTL = binary.BigEndian.Uint32(msg[next+4:])
+	rdlength := int(binary.BigEndian.Uint16(msg[next+8:]))
+	next += 10
+	if next+rdlength > len(msg) {
+		return rr, 0, errTruncatedMessage
+	}
+	rr.Rdata = msg[next : next+rdlength]
+	return rr, next + rdlength, nil
+}
+
+// OPT return the OPT record in additional section, nil if not exist
+func (message *Message) OPT() *RR {
+	for i := range message.Additional {
+		if message.Additional[i].Type == TypeOPT {
+			return &message.Additional[i]
+		}
+	}
+	return nil
+}
+
+// UnpackEDNSOptions decode the options in rdata of OPT record
+func UnpackEDNSOptions(rdata []byte) ([]EDNSOption, error) {
+	var options []EDNSOption
+	for len(rdata) >= 4 {
+		code := binary.BigEndian.Uint16(rdata)
+		length := int(binary.BigEndian.Uint16(rdata[2:]))
+		if 4+length > len(rdata) {
+			return options, errTruncatedMessage
+		}
+		options = append(options, EDNSOption{Code: code, Data: rdata[4 : 4+length]})
+		rdata = rdata[4+length:]
+	}
+	return options, nil
+}
+
+// MessageInfo hold the section counts and the OPT record of a message
+type MessageInfo struct {
+	Answer     int
+	Authority  int
+	Additional int
+	// OPT is true when the message has an OPT record, UDPSize is the
+	// advertised payload size and DO is the DNSSEC OK bit
+	OPT     bool
+	UDPSize uint16
+	DO      bool
+}
+
+// ScanMessage read the section counts and the OPT record of message
+// without decode the records
+func ScanMessage(msg []byte) (MessageInfo, error) {
+	if len(msg) < headerSize {
+		return MessageInfo{}, errTruncatedMessage
+	}
+	info := MessageInfo{
+		Answer:     int(binary.BigEndian.Uint16(msg[6:])),
+		Authority:  int(binary.BigEndian.Uint16(msg[8:])),
+		Additional: int(binary.BigEndian.Uint16(msg[10:])),
+	}
+	off := headerSize
+	var err error
+	for i := binary.BigEndian.Uint16(msg[4:]); i > 0; i-- {
+		if off, err = skipDomainName(msg, off); err != nil {
+			return info, err
+		}
+		off += 4
+	}
+	records := info.Answer + info.Authority + info.Additional
+	for i := 0; i < records; i++ {
+		if off, err = skipDomainName(msg, off); err != nil {
+			return info, err
+		}
+		if off+10 > len(msg) {
+			return info, errTruncatedMessage
+		}
+		if i >= info.Answer+info.Authority && binary.BigEndian.Uint16(msg[off:]) == TypeOPT {
+			info.OPT = true
+			info.UDPSize = binary.BigEndian.Uint16(msg[off+2:])
+			info.DO = binary.BigEndian.Uint16(msg[off+6:])&0x8000 != 0
+		}
+		off += 10 + int(binary.BigEndian.Uint16(msg[off+8:]))
+	}
+	if off > len(msg) {
+		return info, errTruncatedMessage
+	}
+	return info, nil
+}
+
+// skipDomainName return the offset after the domain name start at off
+func skipDomainName(msg []byte, off int) (int, error) {
+	for {
+		if off >= len(msg) {
+			return 0, errTruncatedMessage
+		}
+		c := int(msg[off])
+		switch c & 0xc0 {
+		case 0x00:
+			if c == 0 {
+				return off + 1, nil
+			}
+			off += 1 + c
+		case 0xc0:
+			return off + 2, nil
+		default:
+			return 0, errors.New("invalid domain name label")
+		}
+	}
+}
+
+// QuestionType return the type of the first question of message
+func QuestionType(msg []byte) (uint16, bool) {
+	if len(msg) < headerSize || binary.BigEndian.Uint16(msg[4:]) == 0 {
+		return 0, false
+	}
+	off, err := skipDomainName(msg, headerSize)
+	if err != nil || off+2 > len(msg) {
+		return 0, false
+	}
+	return binary.BigEndian.Uint16(msg[off:]), true
+}
@@ -0,0 +1,74 @@
+package dns
+
+import (
+	"testing"
+)
+
+func TestParseMessage(t *testing.T) {
+	msg := []byte{
+		// header with one question and one answer
+		0x12, 0x34, 0x81, 0x80, 0, 1, 0, 1, 0, 0, 0, 0,
+		// github.com. A IN
+		6, 'g', 'i', 't', 'h', 'u', 'b', 3, 'c', 'o', 'm', 0, 0, 1, 0, 1,
+		// answer with compressed name
+		0xc0, 12, 0, 1, 0, 1, 0, 0, 0, 60, 0, 4, 192, 0, 2, 1,
+	}
+	message, err := ParseMessage(msg)
+	if err != nil {
+		t.Fatalf("%v: expected, Got %v", nil, err)
+	}
+	if message.Header.ID != 0x1234 || !message.Header.Response || message.Header.Rcode != 0 {
+		t.Errorf("unexpected header %+v", message.Header)
+	}
+	if len(message.Question) != 1 || message.Question[0].Name != "github.com." {
+		t.Errorf("unexpected question %+v", message.Question)
+	}
+	if len(message.Answer) != 1 || message.Answer[0].Name != "github.com." || message.Answer[0].TTL != 60 {
+		t.Errorf("unexpected answer %+v", message.Answer)
+	}
+	if _, err := ParseMessage(msg[:len(msg)-2]); err == nil {
+		t.Errorf("expect error for truncated message")
+	}
+	// pointer loop
+	loop := append([]byte{}, msg[:12]...)
+	loop = append(loop, 0xc0, 12)
+	if _, _, err := UnpackDomainName(loop, 12); err == nil {
+		t.Errorf("expect error for compression loop")
+	}
+}
+
+func TestScanMessage(t *testing.T) {
+	msg := []byte{
+		// header with one question, one answer and one additional
+		0x12, 0x34, 0x81, 0xa0, 0, 1, 0, 1, 0, 0, 0, 1,
+		// github.com. A IN
+		6, 'g', 'i', 't', 'h', 'u', 'b', 3, 'c', 'o', 'm', 0, 0, 1, 0, 1,
+		// answer with compressed name
+		0xc0, 12, 0, 1, 0, 1, 0, 0, 0, 60, 0, 4, 192, 0, 2, 1,
+		// OPT with payload size 1232 and DO bit
+		0, 0, 41, 0x04, 0xd0, 0, 0, 0x80, 0, 0, 0,
+	}
+	info, err := ScanMessage(msg)
+	if err != nil {
+		t.Fatalf("%v: expected, Got %v", nil, err)
+	}
+	expected := MessageInfo{Answer: 1, Additional: 1, OPT: true, UDPSize: 1232, DO: true}
+	if info != expected {
+		t.Errorf("%v: expected, Got %v", expected, info)
+	}
+	if _, err := ScanMessage(msg[:len(msg)-3]); err == nil {
+		t.Errorf("expect error for truncated message")
+	}
+}
+
+func TestQuestionType(t *testing.T) {
+	packet := new(Packet)
+	packet.SetQuestion("www.example.com.", TypeAAAA)
+	msg, _ := packet.ToBytes()
+	if qtype, ok := QuestionType(msg); !ok || qtype != TypeAAAA {
+		t.Errorf("%v: expected, Got %v", TypeAAAA, qtype)
+	}
+	if _, ok := QuestionType(msg[:len(msg)-3]); ok {
+		t.Errorf("expect fail for truncated question")
+	}
+}
@@ -0,0 +1,87 @@
+package dns
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// RdataString return the rdata of record in presentation format, the
+// names are in lower case and the unknown types use the generic format
+// of RFC 3597
+func RdataString(msg []byte, rr RR) string {
+	rdata := rr.Rdata
+	_, off, err := UnpackDomainName(msg, rr.Offset)
+	if err != nil {
+		return unknownRdata(rdata)
+	}
+	// skip type, class, ttl and rdlength
+	off += 10
+	switch rr.Type {
+	case TypeA:
+		if len(rdata) == net.IPv4len {
+			return net.IP(rdata).String()
+		}
+	case TypeAAAA:
+		if len(rdata) == net.IPv6len {
+			return net.IP(rdata).String()
+		}
+	case TypeNS, TypeCNAME, TypePTR, TypeDNAME:
+		if names, _, ok := rdataNames(msg, off, 1); ok {
+			return names[0]
+		}
+	case TypeMX:
+		if len(rdata) > 2 {
+			if names, _, ok := rdataNames(msg, off+2, 1); ok {
+				return strconv.Itoa(int(binary.BigEndian.Uint16(rdata))) + " " + names[0]
+			}
+		}
+	case TypeSRV:
+		if len(rdata) > 6 {
+			if names, _, ok := rdataNames(msg, off+6, 1); ok {
+				return strconv.Itoa(int(binary.BigEndian.Uint16(rdata))) + " " +
+					strconv.Itoa(int(binary.BigEndian.Uint16(rdata[2:]))) + " " +
+					strconv.Itoa(int(binary.BigEndian.Uint16(rdata[4:]))) + " " + names[0]
+			}
+		}
+	case TypeSOA:
+		if names, next, ok := rdataNames(msg, off, 2); ok && next+20 == off+len(rdata) {
+			fields := names
+			for i := 0; i < 5; i++ {
+				fields = append(fields, strconv.FormatUint(uint64(binary.BigEndian.Uint32(msg[next+4*i:])), 10))
+			}
+			return strings.Join(fields, " ")
+		}
+	case TypeTXT:
+		var texts []string
+		for len(rdata) > 0 && int(rdata[0]) < len(rdata) {
+			texts = append(texts, strconv.Quote(string(rdata[1:1+rdata[0]])))
+			rdata = rdata[1+rdata[0]:]
+		}
+		if len(rdata) == 0 {
+			return strings.Join(texts, " ")
+		}
+		rdata = rr.Rdata
+	}
+	return unknownRdata(rdata)
+}
+
+// rdataNames read count names from the rdata start at off
+func rdataNames(msg []byte, off, count int) ([]string, int, bool) {
+	var names []string
+	for i := 0; i < count; i++ {
+		name, next, err := UnpackDomainName(msg, off)
+		if err != nil {
+			return nil, 0, false
+		}
+		names = append(names, strings.ToLower(name))
+		off = next
+	}
+	return names, off, true
+}
+
+func unknownRdata(rdata []byte) string {
+	return "\\# " + strconv.Itoa(len(rdata)) + " " + hex.EncodeToString(rdata)
+}
@@ -0,0 +1,32 @@
+package dns
+
+import (
+	"testing"
+)
+
+func TestRdataString(t *testing.T) {
+	msg := []byte{
+		// header with one question and four answers
+		0x12, 0x34, 0x81, 0x80, 0, 1, 0, 4, 0, 0, 0, 0,
+		// Example.com. ANY IN
+		7, 'E', 'x', 'a', 'm', 'p', 'l', 'e', 3, 'c', 'o', 'm', 0, 0, 255, 0, 1,
+		// A 192.0.2.1
+		0xc0, 12, 0, 1, 0, 1, 0, 0, 0, 60, 0, 4, 192, 0, 2, 1,
+		// MX 10 mail.example.com.
+		0xc0, 12, 0, 15, 0, 1, 0, 0, 0, 60, 0, 9, 0, 10, 4, 'm', 'a', 'i', 'l', 0xc0, 12,
+		// TXT "a b" "c"
+		0xc0, 12, 0, 16, 0, 1, 0, 0, 0, 60, 0, 6, 3, 'a', ' ', 'b', 1, 'c',
+		// type 65280 with two bytes
+		0xc0, 12, 0xff, 0, 0, 1, 0, 0, 0, 60, 0, 2, 0xab, 0xcd,
+	}
+	message, err := ParseMessage(msg)
+	if err != nil {
+		t.Fatalf("%v: expected, Got %v", nil, err)
+	}
+	expected := []string{"192.0.2.1", "10 mail.example.com.", `"a b" "c"`, `\# 2 abcd`}
+	for i, rr := range message.Answer {
+		if got := RdataString(msg, rr); got != expected[i] {
+			t.Errorf("%v: expected, Got %v", expected[i], got)
+		}
+	}
+}
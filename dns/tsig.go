@@ -0,0 +1,243 @@
+package dns
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"io/ioutil"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TSIG algorithm names (RFC 8945)
+const (
+	HmacMD5    = "hmac-md5.sig-alg.reg.int."
+	HmacSHA1   = "hmac-sha1."
+	HmacSHA256 = "hmac-sha256."
+)
+
+// DefaultTSIGFudge is the allowed time difference in seconds
+const DefaultTSIGFudge = 300
+
+var tsigAlgorithms = map[string]func() hash.Hash{
+	HmacMD5:    md5.New,
+	HmacSHA1:   sha1.New,
+	HmacSHA256: sha256.New,
+}
+
+// TSIG sign the queries and verify the responses with a shared secret,
+// the hmac instances are pooled so it is safe for concurrent use
+type TSIG struct {
+	KeyName   string
+	Algorithm string
+	Fudge     uint16
+	// keyName and algorithm in canonical wire format
+	keyName   []byte
+	algorithm []byte
+	// variables hold the fixed part of TSIG variables from key name
+	// to algorithm name
+	variables []byte
+	pool      sync.Pool
+}
+
+// NewTSIG create a TSIG signer, the secret is base64 encoded and the
+// algorithm can be hmac-md5, hmac-sha1 or hmac-sha256
+func NewTSIG(keyName, algorithm, secret string) (*TSIG, error) {
+	if keyName == "" {
+		return nil, errors.New("tsig key name is empty")
+	}
+	algorithm = TSIGAlgorithmName(algorithm)
+	newHash, ok := tsigAlgorithms[algorithm]
+	if !ok {
+		return nil, fmt.Errorf("unsupported tsig algorithm %s", algorithm)
+	}
+	key, err := base64.StdEncoding.DecodeString(secret)
+	if err != nil || len(key) == 0 {
+		return nil, errors.New("tsig secret must be base64 encoded")
+	}
+	tsig := &TSIG{
+		KeyName:   FqdnFormat(strings.ToLower(keyName)),
+		Algorithm: algorithm,
+		Fudge:     DefaultTSIGFudge,
+	}
+	tsig.keyName = PackDomainName(tsig.KeyName)
+	tsig.algorithm = PackDomainName(algorithm)
+	tsig.variables = append(tsig.variables, tsig.keyName...)
+	// class ANY and ttl 0
+	tsig.variables = append(tsig.variables, 0, 255, 0, 0, 0, 0)
+	tsig.variables = append(tsig.variables, tsig.algorithm...)
+	tsig.pool.New = func() interface{} {
+		return hmac.New(newHash, key)
+	}
+	return tsig, nil
+}
+
+// TSIGAlgorithmName return the full algorithm name of the short name
+// like hmac-sha256
+func TSIGAlgorithmName(algorithm string) string {
+	algorithm = FqdnFormat(strings.ToLower(strings.TrimSpace(algorithm)))
+	if algorithm == "hmac-md5." {
+		return HmacMD5
+	}
+	return algorithm
+}
+
+var (
+	tsigKeyRegexp       = regexp.MustCompile(`key\s+"?([^"\s{]+)"?\s*\{`)
+	tsigAlgorithmRegexp = regexp.MustCompile(`algorithm\s+"?([^";\s]+)"?\s*;`)
+	tsigSecretRegexp    = regexp.MustCompile(`secret\s+"([^"]+)"\s*;`)
+)
+
+// ParseTSIGKey read the key name, algorithm and secret from a key
+// in bind format, e.g. the output of tsig-keygen
+func ParseTSIGKey(content []byte) (keyName, algorithm, secret string, err error) {
+	key := tsigKeyRegexp.FindSubmatch(content)
+	alg := tsigAlgorithmRegexp.FindSubmatch(content)
+	sec := tsigSecretRegexp.FindSubmatch(content)
+	if key == nil || alg == nil || sec == nil {
+		return "", "", "", errors.New("invalid tsig key file")
+	}
+	return string(key[1]), string(alg[1]), string(sec[1]), nil
+}
+
+// NewTSIGFromFile create a TSIG signer from a key file in bind format
+func NewTSIGFromFile(file string) (*TSIG, error) {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	keyName, algorithm, secret, err := ParseTSIGKey(content)
+	if err != nil {
+		return nil, err
+	}
+	return NewTSIG(keyName, algorithm, secret)
+}
+
+// putTimers write the 48 bits time signed and fudge
+func putTimers(buf []byte, timeSigned uint64, fudge uint16) {
+	buf[0] = byte(timeSigned >> 40)
+	buf[1] = byte(timeSigned >> 32)
+	binary.BigEndian.PutUint32(buf[2:], uint32(timeSigned))
+	binary.BigEndian.PutUint16(buf[6:], fudge)
+}
+
+// Sign append the message with the TSIG record to buf and return the
+// new buffer and the mac, the mac is part of the buffer so it should be
+// copied if it will be used after the buffer changed. requestMAC is only
+// used when signing a response
+func (tsig *TSIG) Sign(buf []byte, msg []byte, requestMAC []byte, timeSigned time.Time) ([]byte, []byte) {
+	// time signed, fudge, error and other len
+	timers := make([]byte, 12)
+	putTimers(timers, uint64(timeSigned.Unix()), tsig.Fudge)
+
+	h := tsig.pool.Get().(hash.Hash)
+	h.Reset()
+	if len(requestMAC) > 0 {
+		h.Write([]byte{byte(len(requestMAC) >> 8), byte(len(requestMAC))})
+		h.Write(requestMAC)
+	}
+	h.Write(msg)
+	h.Write(tsig.variables)
+	h.Write(timers)
+
+	start := len(buf)
+	buf = append(buf, msg...)
+	arcount := binary.BigEndian.Uint16(buf[start+10:])
+	binary.BigEndian.PutUint16(buf[start+10:], arcount+1)
+
+	macSize := h.Size()
+	rdlength := len(tsig.algorithm) + 10 + macSize + 6
+	buf = append(buf, tsig.keyName...)
+	head := make([]byte, 10)
+	binary.BigEndian.PutUint16(head, TypeTSIG)
+	binary.BigEndian.PutUint16(head[2:], ClassANY)
+	binary.BigEndian.PutUint16(head[8:], uint16(rdlength))
+	buf = append(buf, head...)
+	buf = append(buf, tsig.algorithm...)
+	buf = append(buf, timers[:8]...)
+	buf = append(buf, byte(macSize>>8), byte(macSize))
+	macStart := len(buf)
+	buf = h.Sum(buf)
+	tsig.pool.Put(h)
+	// original id, error and other len
+	buf = append(buf, msg[0], msg[1], 0, 0, 0, 0)
+	return buf, buf[macStart : macStart+macSize]
+}
+
+// Verify check the TSIG record of the response with the mac of request
+func (tsig *TSIG) Verify(msg []byte, requestMAC []byte, now time.Time) error {
+	message, err := ParseMessage(msg)
+	if err != nil {
+		return err
+	}
+	if len(message.Additional) == 0 {
+		return errors.New("tsig record not found")
+	}
+	rr := message.Additional[len(message.Additional)-1]
+	if rr.Type != TypeTSIG {
+		return errors.New("tsig record not found")
+	}
+	if !strings.EqualFold(rr.Name, tsig.KeyName) {
+		return fmt.Errorf("unknown tsig key %s", rr.Name)
+	}
+	rdata := rr.Rdata
+	algorithm, off, err := UnpackDomainName(rdata, 0)
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(algorithm, tsig.Algorithm) {
+		return fmt.Errorf("unexpected tsig algorithm %s", algorithm)
+	}
+	if off+10 > len(rdata) {
+		return errTruncatedMessage
+	}
+	timers := rdata[off : off+8]
+	macSize := int(binary.BigEndian.Uint16(rdata[off+8:]))
+	off += 10
+	if off+macSize+6 > len(rdata) {
+		return errTruncatedMessage
+	}
+	mac := rdata[off : off+macSize]
+	off += macSize
+	originalID := rdata[off : off+2]
+	tsigError := binary.BigEndian.Uint16(rdata[off+2:])
+	if tsigError != 0 {
+		return fmt.Errorf("tsig error %d", tsigError)
+	}
+
+	h := tsig.pool.Get().(hash.Hash)
+	defer tsig.pool.Put(h)
+	h.Reset()
+	if len(requestMAC) > 0 {
+		h.Write([]byte{byte(len(requestMAC) >> 8), byte(len(requestMAC))})
+		h.Write(requestMAC)
+	}
+	// message before TSIG record with original id and arcount
+	header := make([]byte, 12)
+	copy(header, msg)
+	copy(header, originalID)
+	binary.BigEndian.PutUint16(header[10:], uint16(len(message.Additional)-1))
+	h.Write(header)
+	h.Write(msg[12:rr.Offset])
+	h.Write(tsig.variables)
+	h.Write(timers)
+	// error, other len and other data
+	h.Write(rdata[off+2:])
+	if !hmac.Equal(h.Sum(nil), mac) {
+		return errors.New("tsig signature mismatch")
+	}
+	timeSigned := uint64(timers[0])<<40 | uint64(timers[1])<<32 | uint64(binary.BigEndian.Uint32(timers[2:]))
+	fudge := int64(binary.BigEndian.Uint16(timers[6:]))
+	if diff := now.Unix() - int64(timeSigned); diff > fudge || diff < -fudge {
+		return errors.New("tsig time signed out of fudge")
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package dns
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseTSIGKey(t *testing.T) {
+	content := []byte(`key "update-key" {
+	algorithm hmac-sha256;
+	secret "c2VjcmV0LWtleS1mb3ItdGVzdA==";
+};`)
+	keyName, algorithm, secret, err := ParseTSIGKey(content)
+	if err != nil {
+		t.Fatalf("%v: expected, Got %v", nil, err)
+	}
+	if keyName != "update-key" || algorithm != "hmac-sha256" || secret != "c2VjcmV0LWtleS1mb3ItdGVzdA==" {
+		t.Errorf("unexpected key %s %s %s", keyName, algorithm, secret)
+	}
+	if _, _, _, err := ParseTSIGKey([]byte("key {}")); err == nil {
+		t.Errorf("expect error for invalid key file")
+	}
+}
+
+func TestTSIGSignAndVerify(t *testing.T) {
+	for _, algorithm := range []string{"hmac-md5", "hmac-sha1", "hmac-sha256"} {
+		tsig, err := NewTSIG("update-key", algorithm, "c2VjcmV0LWtleS1mb3ItdGVzdA==")
+		if err != nil {
+			t.Fatalf("%v: expected, Got %v", nil, err)
+		}
+		packet := new(Packet)
+		packet.Protocol = "udp"
+		packet.SetQuestion("github.com.", TypeA)
+		packet.SetEDNS(&EDNS{UDPSize: 4096})
+		query, _ := packet.ToBytes()
+		now := time.Now()
+		signed, mac := tsig.Sign(nil, query, nil, now)
+		requestMAC := append([]byte{}, mac...)
+		message, err := ParseMessage(signed)
+		if err != nil {
+			t.Fatalf("%v: expected, Got %v", nil, err)
+		}
+		if len(message.Additional) != 2 || message.Additional[1].Type != TypeTSIG {
+			t.Errorf("expect tsig as the last record, Got %+v", message.Additional)
+		}
+
+		response := append([]byte{}, query...)
+		response[2] |= 0x80
+		signedResponse, _ := tsig.Sign(nil, response, requestMAC, now)
+		if err := tsig.Verify(signedResponse, requestMAC, now); err != nil {
+			t.Errorf("%s: %v", algorithm, err)
+		}
+		signedResponse[len(response)-1] ^= 0xff
+		if err := tsig.Verify(signedResponse, requestMAC, now); err == nil {
+			t.Errorf("%s: expect error for modified response", algorithm)
+		}
+		if err := tsig.Verify(response, requestMAC, now); err == nil {
+			t.Errorf("%s: expect error for unsigned response", algorithm)
+		}
+	}
+	if _, err := NewTSIG("key", "hmac-sha512", "c2VjcmV0"); err == nil {
+		t.Errorf("expect error for unsupported algorithm")
+	}
+}
@@ -0,0 +1,68 @@
+package dns
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// Update build the dynamic update messages (RFC 2136) of a zone
+type Update struct {
+	Zone string
+	TTL  uint32
+	// zone name in wire format
+	zone []byte
+}
+
+// NewUpdate create an update builder for the zone
+func NewUpdate(zone string, ttl uint32) (*Update, error) {
+	if zone == "" {
+		return nil, errors.New("update zone is empty")
+	}
+	zone = FqdnFormat(zone)
+	return &Update{
+		Zone: zone,
+		TTL:  ttl,
+		zone: PackDomainName(zone),
+	}, nil
+}
+
+// header append the update header and zone section to buf
+func (update *Update) header(buf []byte, id uint16) []byte {
+	head := make([]byte, 12)
+	binary.BigEndian.PutUint16(head, id)
+	binary.BigEndian.PutUint16(head[2:], uint16(OpcodeUpdate)<<11)
+	// one zone and one update record
+	binary.BigEndian.PutUint16(head[4:], 1)
+	binary.BigEndian.PutUint16(head[8:], 1)
+	buf = append(buf, head...)
+	buf = append(buf, update.zone...)
+	return append(buf, 0, byte(TypeSOA), 0, ClassINET)
+}
+
+// record append a record with the name label.zone to buf, the zone
+// part of name point to the zone section
+func appendUpdateRecord(buf []byte, label string, rrtype, class uint16, ttl uint32, rdata []byte) []byte {
+	buf = append(buf, byte(len(label)))
+	buf = append(buf, label...)
+	// compression pointer to the zone name at offset 12
+	buf = append(buf, 0xc0, 12)
+	rr := make([]byte, 10)
+	binary.BigEndian.PutUint16(rr, rrtype)
+	binary.BigEndian.PutUint16(rr[2:], class)
+	binary.BigEndian.PutUint32(rr[4:], ttl)
+	binary.BigEndian.PutUint16(rr[8:], uint16(len(rdata)))
+	buf = append(buf, rr...)
+	return append(buf, rdata...)
+}
+
+// Add append the message which add the record label.zone to buf
+func (update *Update) Add(buf []byte, id uint16, label string, rrtype uint16, rdata []byte) []byte {
+	buf = update.header(buf, id)
+	return appendUpdateRecord(buf, label, rrtype, ClassINET, update.TTL, rdata)
+}
+
+// Delete append the message which delete the rrset of label.zone to buf
+func (update *Update) Delete(buf []byte, id uint16, label string, rrtype uint16) []byte {
+	buf = update.header(buf, id)
+	return appendUpdateRecord(buf, label, rrtype, ClassANY, 0, nil)
+}
@@ -0,0 +1,130 @@
+package dns
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// NewTransferQuery return the AXFR or IXFR query of the zone in wire
+// format without the tcp length, serial is the current serial of the
+// client used by IXFR
+func NewTransferQuery(zone string, qtype uint16, serial uint32) ([]byte, error) {
+	if qtype != TypeAXFR && qtype != TypeIXFR {
+		return nil, errors.New("transfer query type must be AXFR or IXFR")
+	}
+	packet := new(Packet)
+	packet.SetQuestion(FqdnFormat(zone), qtype)
+	packet.Header.RecursionDesired = false
+	msg, err := packet.ToBytes()
+	if err != nil || qtype == TypeAXFR {
+		return msg, err
+	}
+	// IXFR carry the SOA of client in authority section (RFC 1995)
+	binary.BigEndian.PutUint16(msg[8:], 1)
+	msg = append(msg, 0xc0, 12)
+	rr := make([]byte, 10)
+	binary.BigEndian.PutUint16(rr, TypeSOA)
+	binary.BigEndian.PutUint16(rr[2:], ClassINET)
+	// root mname and rname with serial and four timers
+	binary.BigEndian.PutUint16(rr[8:], 22)
+	msg = append(msg, rr...)
+	rdata := make([]byte, 22)
+	binary.BigEndian.PutUint32(rdata[2:], serial)
+	return append(msg, rdata...), nil
+}
+
+// SOASerial return the serial of SOA record in message
+func SOASerial(msg []byte, rr RR) (uint32, error) {
+	if rr.Type != TypeSOA {
+		return 0, errors.New("not a SOA record")
+	}
+	_, off, err := UnpackDomainName(msg, rr.Offset)
+	if err != nil {
+		return 0, err
+	}
+	// skip type, class, ttl and rdlength then mname and rname
+	off += 10
+	for i := 0; i < 2; i++ {
+		if _, off, err = UnpackDomainName(msg, off); err != nil {
+			return 0, err
+		}
+	}
+	if off+4 > len(msg) {
+		return 0, errTruncatedMessage
+	}
+	return binary.BigEndian.Uint32(msg[off:]), nil
+}
+
+// TransferState follow the records of a zone transfer response stream
+// and detect the terminating SOA
+type TransferState struct {
+	// Incremental is true when the IXFR response is in incremental format
+	Incremental bool
+	Records     uint64
+	ixfr        bool
+	// clientSerial is the serial sent in IXFR query
+	clientSerial uint32
+	serial       uint32
+	soaCount     int
+	done         bool
+}
+
+// NewTransferState create the state of a transfer of qtype AXFR or IXFR
+func NewTransferState(qtype uint16, clientSerial uint32) *TransferState {
+	return &TransferState{
+		ixfr:         qtype == TypeIXFR,
+		clientSerial: clientSerial,
+	}
+}
+
+// Done return true when the transfer is finished
+func (state *TransferState) Done() bool {
+	return state.done
+}
+
+// Add process the answer records of one response message
+func (state *TransferState) Add(msg []byte, answers []RR) error {
+	for _, rr := range answers {
+		if state.done {
+			return errors.New("records after the terminating SOA")
+		}
+		state.Records++
+		if rr.Type != TypeSOA {
+			if state.Records == 1 {
+				return errors.New("transfer response not start with SOA")
+			}
+			continue
+		}
+		serial, err := SOASerial(msg, rr)
+		if err != nil {
+			return err
+		}
+		switch {
+		case state.Records == 1:
+			state.serial = serial
+			// the client is up to date when the server has no newer version
+			if state.ixfr && !serialNewer(serial, state.clientSerial) {
+				state.done = true
+			}
+		case state.Records == 2 && state.ixfr:
+			// the second SOA mean the incremental format
+			state.Incremental = true
+			state.soaCount = 1
+		case state.Incremental:
+			// the SOA of deletions and additions come in pairs, the
+			// terminating SOA is at the position of a deletion SOA
+			state.soaCount++
+			if state.soaCount%2 == 1 && serial == state.serial {
+				state.done = true
+			}
+		default:
+			state.done = serial == state.serial
+		}
+	}
+	return nil
+}
+
+// serialNewer compare the serial numbers with RFC 1982 arithmetic
+func serialNewer(a, b uint32) bool {
+	return a != b && int32(a-b) > 0
+}
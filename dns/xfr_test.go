@@ -0,0 +1,97 @@
+package dns
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+// buildTransferResponse build a response of example.com with the records,
+// a record is a serial of SOA or 0 for an A record
+func buildTransferResponse(records ...uint32) []byte {
+	query, _ := NewTransferQuery("example.com", TypeAXFR, 0)
+	msg := append([]byte{}, query...)
+	msg[2] |= 0x80
+	binary.BigEndian.PutUint16(msg[6:], uint16(len(records)))
+	for _, serial := range records {
+		rr := make([]byte, 12)
+		// compression pointer to the question name
+		rr[0], rr[1] = 0xc0, 12
+		binary.BigEndian.PutUint16(rr[4:], ClassINET)
+		if serial == 0 {
+			binary.BigEndian.PutUint16(rr[2:], TypeA)
+			binary.BigEndian.PutUint16(rr[10:], 4)
+			rr = append(rr, 192, 0, 2, 1)
+		} else {
+			binary.BigEndian.PutUint16(rr[2:], TypeSOA)
+			binary.BigEndian.PutUint16(rr[10:], 22)
+			rdata := make([]byte, 22)
+			binary.BigEndian.PutUint32(rdata[2:], serial)
+			rr = append(rr, rdata...)
+		}
+		msg = append(msg, rr...)
+	}
+	return msg
+}
+
+func TestNewTransferQuery(t *testing.T) {
+	query, err := NewTransferQuery("example.com", TypeIXFR, 2018)
+	if err != nil {
+		t.Fatalf("%v: expected, Got %v", nil, err)
+	}
+	message, err := ParseMessage(query)
+	if err != nil {
+		t.Fatalf("%v: expected, Got %v", nil, err)
+	}
+	if message.Question[0].Qtype != TypeIXFR || len(message.Authority) != 1 {
+		t.Fatalf("unexpected ixfr query %+v", message)
+	}
+	if serial, _ := SOASerial(query, message.Authority[0]); serial != 2018 {
+		t.Errorf("%v: expected, Got %v", 2018, serial)
+	}
+	if _, err := NewTransferQuery("example.com", TypeA, 0); err == nil {
+		t.Errorf("expect error for non transfer type")
+	}
+}
+
+func TestTransferState(t *testing.T) {
+	var cases = []struct {
+		qtype    uint16
+		serial   uint32
+		messages [][]uint32
+		done     bool
+		records  uint64
+	}{
+		// axfr split in two messages
+		{TypeAXFR, 0, [][]uint32{{10, 0, 0}, {0, 10}}, true, 5},
+		{TypeAXFR, 0, [][]uint32{{10, 0, 0}}, false, 3},
+		// ixfr client is up to date
+		{TypeIXFR, 10, [][]uint32{{10}}, true, 1},
+		// ixfr in axfr format
+		{TypeIXFR, 8, [][]uint32{{10, 0, 10}}, true, 3},
+		// ixfr with two incremental changes 8->9->10
+		{TypeIXFR, 8, [][]uint32{{10, 8, 0, 9, 0}, {9, 0, 10, 0, 10}}, true, 10},
+		{TypeIXFR, 8, [][]uint32{{10, 8, 0, 9, 0}, {9, 0, 10, 0}}, false, 9},
+	}
+	for _, test := range cases {
+		state := NewTransferState(test.qtype, test.serial)
+		for _, records := range test.messages {
+			msg := buildTransferResponse(records...)
+			message, err := ParseMessage(msg)
+			if err != nil {
+				t.Fatalf("%v: expected, Got %v", nil, err)
+			}
+			if err := state.Add(msg, message.Answer); err != nil {
+				t.Errorf("%v: expected, Got %v", nil, err)
+			}
+		}
+		if state.Done() != test.done || state.Records != test.records {
+			t.Errorf("%v: done %v records %v expected, Got %v %v", test.messages, test.done, test.records, state.Done(), state.Records)
+		}
+	}
+	state := NewTransferState(TypeAXFR, 0)
+	msg := buildTransferResponse(0, 10)
+	message, _ := ParseMessage(msg)
+	if err := state.Add(msg, message.Answer); err == nil {
+		t.Errorf("expect error when response not start with SOA")
+	}
+}
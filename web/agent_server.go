@@ -1,7 +1,7 @@
 package web
 
 import (
-	"fmt"
+	"net"
 	"net/http"
 	"time"
 
@@ -17,8 +17,9 @@ func getAgentStatus(w http.ResponseWriter, req *http.Request) {
 	r := render.New(render.Options{})
 	app := core.GetGlobalAppController()
 	r.JSON(w, http.StatusOK, JSONResponse{
-		ID:     app.JobConfig.JobID,
-		Status: app.GetCurrentJobStatusString(),
+		ID:          app.JobConfig.JobID,
+		Status:      app.GetCurrentJobStatusString(),
+		AbortReason: app.AbortReason(),
 	})
 }
 
@@ -28,7 +29,7 @@ func NewAgentServer(host, port string) {
 	r.HandleFunc("/start", startDNSTraffic).Methods("POST")
 	r.HandleFunc("/status", getAgentStatus).Methods("GET")
 	r.HandleFunc("/stop", stopDNSTraffic).Methods("GET")
-	err := http.ListenAndServe(fmt.Sprintf("%s:%s", host, port), http.TimeoutHandler(r, time.Second*10, "timeout"))
+	err := http.ListenAndServe(net.JoinHostPort(host, port), http.TimeoutHandler(r, time.Second*10, "timeout"))
 	if err != nil {
 		log.Errorf("start agent server fail: %s", err)
 	}
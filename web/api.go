@@ -0,0 +1,469 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+	"github.com/unrolled/render"
+	"github.com/zhangmingkai4315/dns-loader/core"
+)
+
+// apiUserKey is the context key of the user authenticated by token
+type apiUserKey struct{}
+
+// APIError is the body of all failed api responses
+type APIError struct {
+	Status int    `json:"status"`
+	Error  string `json:"error"`
+}
+
+// APIJob is a job of the query history with its current status
+type APIJob struct {
+	ID        uint           `json:"id"`
+	JobID     string         `json:"job_id"`
+	Status    string         `json:"status"`
+	User      string         `json:"user"`
+	SLO       string         `json:"slo"`
+	CreatedAt time.Time      `json:"created_at"`
+	Config    core.JobConfig `json:"config"`
+	// Warning is set when the job is started but not saved in history
+	Warning string `json:"warning,omitempty"`
+	// AgentErrors is why the agents fail to start the job
+	AgentErrors string `json:"agent_errors,omitempty"`
+}
+
+// APITokenForm define the posted info to create a token
+type APITokenForm struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Name     string `json:"name"`
+}
+
+func apiError(w http.ResponseWriter, status int, message string) {
+	r := render.New(render.Options{})
+	r.JSON(w, status, APIError{Status: status, Error: message})
+}
+
+// apiAuth only allow the request with a bearer token of the user with
+// the role or a higher role
+func apiAuth(role string, f func(w http.ResponseWriter, req *http.Request)) func(w http.ResponseWriter, req *http.Request) {
+	return func(w http.ResponseWriter, req *http.Request) {
+		header := req.Header.Get("Authorization")
+		if !strings.HasPrefix(header, "Bearer ") {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			apiError(w, http.StatusUnauthorized, "bearer token is required")
+			return
+		}
+		user, err := core.GetDBHandler().AuthenticateAPIToken(strings.TrimPrefix(header, "Bearer "))
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			apiError(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+		if !user.Can(role) {
+			log.Warnf("user %s is denied to %s %s", user.Username, req.Method, req.URL.Path)
+			apiError(w, http.StatusForbidden, "permission denied: "+role+" role is required")
+			return
+		}
+		f(w, req.WithContext(context.WithValue(req.Context(), apiUserKey{}, user)))
+	}
+}
+
+// apiUser return the user authenticated by apiAuth
+func apiUser(req *http.Request) *core.User {
+	user, _ := req.Context().Value(apiUserKey{}).(*core.User)
+	return user
+}
+
+// newAPIJob return the job of history with its status
+func newAPIJob(query *core.DNSQuery) APIJob {
+	return APIJob{
+		ID:          query.ID,
+		JobID:       query.JobID,
+		Status:      jobStatus(query),
+		User:        query.User,
+		SLO:         query.SLO,
+		CreatedAt:   query.CreatedAt,
+		Config:      query.JobConfig,
+		AgentErrors: query.AgentErrors,
+	}
+}
+
+// jobStatus return the status of the job in history, finished when the
+// report is saved and stopped when the job stopped without report
+func jobStatus(query *core.DNSQuery) string {
+	app := core.GetGlobalAppController()
+	if app.JobID == query.JobID && app.GetCurrentJobStatus() != core.StatusStopped {
+		return app.GetCurrentJobStatusString()
+	}
+	if query.Report != "" {
+		return "finished"
+	}
+	return "stopped"
+}
+
+func apiCreateToken(w http.ResponseWriter, req *http.Request) {
+	r := render.New(render.Options{})
+	var form APITokenForm
+	if err := json.NewDecoder(req.Body).Decode(&form); err != nil {
+		apiError(w, http.StatusBadRequest, "decode post data fail")
+		return
+	}
+	user, err := core.GetDBHandler().Authenticate(form.Username, form.Password)
+	if err != nil {
+		log.Warnf("user %s create token fail from %s", form.Username, req.RemoteAddr)
+		apiError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+	token, apiToken, err := core.GetDBHandler().CreateAPIToken(user.Username, form.Name)
+	if err != nil {
+		apiError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	log.Infof("user %s create api token %s", user.Username, apiToken.Prefix)
+	r.JSON(w, http.StatusCreated, map[string]interface{}{
+		"token": token,
+		"data":  apiToken,
+	})
+}
+
+func apiListTokens(w http.ResponseWriter, req *http.Request) {
+	r := render.New(render.Options{})
+	username := apiUser(req).Username
+	if apiUser(req).Can(core.RoleAdmin) {
+		username = ""
+	}
+	tokens, err := core.GetDBHandler().GetAPITokens(username)
+	if err != nil {
+		apiError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	r.JSON(w, http.StatusOK, map[string]interface{}{"data": tokens})
+}
+
+func apiDeleteToken(w http.ResponseWriter, req *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(req)["id"])
+	username := apiUser(req).Username
+	if apiUser(req).Can(core.RoleAdmin) {
+		username = ""
+	}
+	if err := core.GetDBHandler().DeleteAPIToken(uint(id), username); err != nil {
+		apiError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func apiGetStatus(w http.ResponseWriter, req *http.Request) {
+	r := render.New(render.Options{})
+	app := core.GetGlobalAppController()
+	r.JSON(w, http.StatusOK, map[string]interface{}{
+		"job_id": app.JobID,
+		"status": app.GetCurrentJobStatusString(),
+		"agents": agentInfos(),
+	})
+}
+
+func apiListJobs(w http.ResponseWriter, req *http.Request) {
+	r := render.New(render.Options{})
+	query := req.URL.Query()
+	offset, _ := strconv.Atoi(query.Get("offset"))
+	limit, err := strconv.Atoi(query.Get("limit"))
+	if err != nil || limit <= 0 {
+		limit = 20
+	}
+	queries, err := core.GetDBHandler().GetDNSQueryHistory(offset, limit, query.Get("search"))
+	if err != nil {
+		apiError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	jobs := []APIJob{}
+	for i := range queries {
+		jobs = append(jobs, newAPIJob(&queries[i]))
+	}
+	r.JSON(w, http.StatusOK, map[string]interface{}{"data": jobs})
+}
+
+func apiStartJob(w http.ResponseWriter, req *http.Request) {
+	// the fields not set in the job use the default values
+	job := core.NewDefaultJobConfig()
+	if err := json.NewDecoder(req.Body).Decode(job); err != nil {
+		apiError(w, http.StatusBadRequest, "decode post data fail: "+err.Error())
+		return
+	}
+	apiRunJob(w, req, job)
+}
+
+// apiRunJob start the job and return the job of history
+func apiRunJob(w http.ResponseWriter, req *http.Request, job *core.JobConfig) {
+	r := render.New(render.Options{})
+	id, agentErrors, err := startJob(job, apiUser(req).Username)
+	if err == errJobNotReady {
+		apiError(w, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		apiError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	recordStartedJob(job, apiUser(req).Username, id, agentErrors)
+	query, err := core.GetDBHandler().GetDNSQuery(strconv.Itoa(int(id)))
+	if err != nil {
+		// the job is running, only its history is missing
+		log.Errorf("get history of job %s fail:%s", job.JobID, err)
+		config := *job
+		config.TSIGSecret = ""
+		config.ReplayData = nil
+		r.JSON(w, http.StatusOK, APIJob{
+			JobID:       job.JobID,
+			Status:      core.GetGlobalAppController().GetCurrentJobStatusString(),
+			User:        apiUser(req).Username,
+			Config:      config,
+			Warning:     "job is started but not saved in history: " + err.Error(),
+			AgentErrors: agentErrors,
+		})
+		return
+	}
+	w.Header().Set("Location", "/api/v1/jobs/"+job.JobID)
+	r.JSON(w, http.StatusCreated, newAPIJob(query))
+}
+
+func apiGetJob(w http.ResponseWriter, req *http.Request) {
+	r := render.New(render.Options{})
+	query, err := core.GetDBHandler().GetDNSQuery(mux.Vars(req)["id"])
+	if err != nil {
+		apiError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	r.JSON(w, http.StatusOK, newAPIJob(query))
+}
+
+func apiGetJobResults(w http.ResponseWriter, req *http.Request) {
+	r := render.New(render.Options{})
+	query, err := core.GetDBHandler().GetDNSQuery(mux.Vars(req)["id"])
+	if err != nil {
+		apiError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if query.Report == "" {
+		apiError(w, http.StatusConflict, "job "+newAPIJob(query).Status+" without results")
+		return
+	}
+	report, err := core.ParseReport([]byte(query.Report))
+	if err != nil {
+		apiError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	r.JSON(w, http.StatusOK, report)
+}
+
+func apiStopJob(w http.ResponseWriter, req *http.Request) {
+	r := render.New(render.Options{})
+	query, err := core.GetDBHandler().GetDNSQuery(mux.Vars(req)["id"])
+	if err != nil {
+		apiError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if query.JobID != core.GetGlobalAppController().JobID {
+		apiError(w, http.StatusConflict, errJobStopped.Error())
+		return
+	}
+	if err := stopJob(); err == errJobStopped {
+		apiError(w, http.StatusConflict, err.Error())
+		return
+	} else if err != nil {
+		apiError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	log.Infof("user %s stop job %s", apiUser(req).Username, query.JobID)
+	r.JSON(w, http.StatusOK, newAPIJob(query))
+}
+
+func apiListAgents(w http.ResponseWriter, req *http.Request) {
+	r := render.New(render.Options{})
+	r.JSON(w, http.StatusOK, map[string]interface{}{"data": agentInfos()})
+}
+
+// agentInfos return the agents with their status ordered by address
+func agentInfos() []core.NodeInfo {
+	agents := []core.NodeInfo{}
+	for _, info := range core.GetNodeManager().NodeInfos {
+		agents = append(agents, info)
+	}
+	sort.Slice(agents, func(i, j int) bool {
+		return agents[i].IPAddrWithPort() < agents[j].IPAddrWithPort()
+	})
+	return agents
+}
+
+func apiAddAgent(w http.ResponseWriter, req *http.Request) {
+	r := render.New(render.Options{})
+	var ipinfo IPWithPort
+	if err := json.NewDecoder(req.Body).Decode(&ipinfo); err != nil {
+		apiError(w, http.StatusBadRequest, "decode post data fail")
+		return
+	}
+	if err := ipinfo.Validate(); err != nil {
+		apiError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := core.GetNodeManager().AddNode(ipinfo.IPAddress, ipinfo.Port); err != nil {
+		apiError(w, http.StatusBadRequest, "add agent fail: "+err.Error())
+		return
+	}
+	log.Infof("user %s add agent %s", apiUser(req).Username, ipinfo.toString(""))
+	// the new agent is enabled
+	ipinfo.Enable = true
+	r.JSON(w, http.StatusCreated, ipinfo)
+}
+
+func apiUpdateAgent(w http.ResponseWriter, req *http.Request) {
+	r := render.New(render.Options{})
+	var ipinfo IPWithPort
+	if err := json.NewDecoder(req.Body).Decode(&ipinfo); err != nil {
+		apiError(w, http.StatusBadRequest, "decode post data fail")
+		return
+	}
+	ipinfo.IPAddress, ipinfo.Port = mux.Vars(req)["ip"], mux.Vars(req)["port"]
+	if err := ipinfo.Validate(); err != nil {
+		apiError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := core.GetNodeManager().UpdateEnableStatusAgent(ipinfo.IPAddress, ipinfo.Port, ipinfo.Enable); err != nil {
+		apiError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	log.Infof("user %s update agent %s", apiUser(req).Username, ipinfo.toString(""))
+	r.JSON(w, http.StatusOK, ipinfo)
+}
+
+func apiDeleteAgent(w http.ResponseWriter, req *http.Request) {
+	ipinfo := IPWithPort{IPAddress: mux.Vars(req)["ip"], Port: mux.Vars(req)["port"]}
+	if err := ipinfo.Validate(); err != nil {
+		apiError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := core.GetNodeManager().RemoveNode(ipinfo.IPAddress, ipinfo.Port); err != nil {
+		apiError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	log.Infof("user %s delete agent %s", apiUser(req).Username, ipinfo.toString(""))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func apiListTemplates(w http.ResponseWriter, req *http.Request) {
+	r := render.New(render.Options{})
+	templates, err := core.GetDBHandler().GetJobTemplates()
+	if err != nil {
+		apiError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	r.JSON(w, http.StatusOK, map[string]interface{}{"data": hideTemplateSecrets(templates)})
+}
+
+func apiCreateTemplate(w http.ResponseWriter, req *http.Request) {
+	r := render.New(render.Options{})
+	var form struct {
+		JobTemplateForm
+		Job json.RawMessage `json:"job"`
+	}
+	if err := json.NewDecoder(req.Body).Decode(&form); err != nil {
+		apiError(w, http.StatusBadRequest, "decode post data fail: "+err.Error())
+		return
+	}
+	if len(form.Job) > 0 {
+		// the fields not set in the job use the default values
+		form.JobTemplateForm.Job = core.NewDefaultJobConfig()
+		if err := json.Unmarshal(form.Job, form.JobTemplateForm.Job); err != nil {
+			apiError(w, http.StatusBadRequest, "decode post data fail: "+err.Error())
+			return
+		}
+	}
+	template, err := saveJobTemplate(&form.JobTemplateForm, apiUser(req).Username)
+	if err != nil {
+		apiError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	log.Infof("user %s save template %s version %d", apiUser(req).Username, template.Name, template.Version)
+	template.Config.TSIGSecret = ""
+	r.JSON(w, http.StatusCreated, template)
+}
+
+func apiGetTemplate(w http.ResponseWriter, req *http.Request) {
+	r := render.New(render.Options{})
+	template, err := getJobTemplate(req)
+	if err != nil {
+		apiError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	template.Config.TSIGSecret = ""
+	r.JSON(w, http.StatusOK, template)
+}
+
+func apiListTemplateVersions(w http.ResponseWriter, req *http.Request) {
+	r := render.New(render.Options{})
+	templates, err := core.GetDBHandler().GetJobTemplateVersions(mux.Vars(req)["name"])
+	if err != nil {
+		apiError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	r.JSON(w, http.StatusOK, map[string]interface{}{"data": hideTemplateSecrets(templates)})
+}
+
+func apiDeleteTemplate(w http.ResponseWriter, req *http.Request) {
+	name := mux.Vars(req)["name"]
+	if err := core.GetDBHandler().DeleteJobTemplate(name); err != nil {
+		apiError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	log.Infof("user %s delete template %s", apiUser(req).Username, name)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func apiStartTemplate(w http.ResponseWriter, req *http.Request) {
+	template, err := getJobTemplate(req)
+	if err != nil {
+		apiError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	apiRunJob(w, req, &template.Config)
+}
+
+func apiNotFound(w http.ResponseWriter, req *http.Request) {
+	apiError(w, http.StatusNotFound, "no api "+req.Method+" "+req.URL.Path)
+}
+
+// newAPIRouter register the handlers of api v1 on the router
+func newAPIRouter(r *mux.Router) {
+	api := r.PathPrefix("/api/v1").Subrouter()
+	api.HandleFunc("/openapi.json", func(w http.ResponseWriter, req *http.Request) {
+		http.ServeFile(w, req, "./web/assets/openapi.json")
+	}).Methods("GET")
+	api.HandleFunc("/tokens", apiCreateToken).Methods("POST")
+	api.HandleFunc("/tokens", apiAuth(core.RoleViewer, apiListTokens)).Methods("GET")
+	api.HandleFunc("/tokens/{id:[0-9]+}", apiAuth(core.RoleViewer, apiDeleteToken)).Methods("DELETE")
+	api.HandleFunc("/status", apiAuth(core.RoleViewer, apiGetStatus)).Methods("GET")
+	api.HandleFunc("/jobs", apiAuth(core.RoleViewer, apiListJobs)).Methods("GET")
+	api.HandleFunc("/jobs", apiAuth(core.RoleOperator, apiStartJob)).Methods("POST")
+	api.HandleFunc("/jobs/{id}", apiAuth(core.RoleViewer, apiGetJob)).Methods("GET")
+	api.HandleFunc("/jobs/{id}/results", apiAuth(core.RoleViewer, apiGetJobResults)).Methods("GET")
+	api.HandleFunc("/jobs/{id}/stop", apiAuth(core.RoleOperator, apiStopJob)).Methods("POST")
+	api.HandleFunc("/templates", apiAuth(core.RoleViewer, apiListTemplates)).Methods("GET")
+	api.HandleFunc("/templates", apiAuth(core.RoleOperator, apiCreateTemplate)).Methods("POST")
+	api.HandleFunc("/templates/{name}", apiAuth(core.RoleViewer, apiGetTemplate)).Methods("GET")
+	api.HandleFunc("/templates/{name}", apiAuth(core.RoleOperator, apiDeleteTemplate)).Methods("DELETE")
+	api.HandleFunc("/templates/{name}/versions", apiAuth(core.RoleViewer, apiListTemplateVersions)).Methods("GET")
+	api.HandleFunc("/templates/{name}/jobs", apiAuth(core.RoleOperator, apiStartTemplate)).Methods("POST")
+	api.HandleFunc("/agents", apiAuth(core.RoleViewer, apiListAgents)).Methods("GET")
+	api.HandleFunc("/agents", apiAuth(core.RoleAdmin, apiAddAgent)).Methods("POST")
+	api.HandleFunc("/agents/{ip}/{port}", apiAuth(core.RoleAdmin, apiUpdateAgent)).Methods("PATCH")
+	api.HandleFunc("/agents/{ip}/{port}", apiAuth(core.RoleAdmin, apiDeleteAgent)).Methods("DELETE")
+	api.PathPrefix("/").HandlerFunc(apiNotFound)
+}
@@ -18,6 +18,24 @@ function getFormData($form) {
     return result
 }
 
+/**
+ * joinHostPort combine the host and port, ipv6 address is enclosed in brackets
+ */
+function joinHostPort(host, port) {
+    if (host.indexOf(":") >= 0) {
+        return "[" + host + "]:" + port
+    }
+    return host + ":" + port
+}
+
+/**
+ * splitHostPort split the address to [host, port]
+ */
+function splitHostPort(address) {
+    var index = address.lastIndexOf(":")
+    return [address.slice(0, index).replace(/^\[|\]$/g, ""), address.slice(index + 1)]
+}
+
 
 /**
  * getFormData serial data from form
@@ -25,9 +43,9 @@ function getFormData($form) {
  * @returns {object} result - the serialized javascript object
  */
 function validateConfig(result) {
-    if (result["server"] === "") {
+    if (result["server"] === "" && $.trim(result["targets"]) === "") {
         $("input[name=server]").addClass("error-input")
-        toastr.error('dns server is empty', 'Config Error')
+        toastr.error('dns server and targets are empty', 'Config Error')
         return false
     }
     if (result["domain"] === "") {
@@ -54,11 +72,121 @@ function validateConfig(result) {
         return false
     }
     if (result["duration"] === "") {
-        result["duration"] = "60s"
+        result["duration"] = result["job_type"] === "replay" ? "" : "60s"
+    }
+    result["ecs_prefix_length"] = isNaN(parseInt(result["ecs_prefix_length"])) ? 0 : parseInt(result["ecs_prefix_length"])
+    if (result["ecs_prefix_length"] < 0 || result["ecs_prefix_length"] > 128) {
+        toastr.error('ECS prefix length should be in [0-128]', 'ECS Error')
+        return false
+    }
+    result["edns_udp_size"] = isNaN(parseInt(result["edns_udp_size"])) ? 0 : parseInt(result["edns_udp_size"])
+    if (result["edns_udp_size"] < 0 || result["edns_udp_size"] > 65535) {
+        toastr.error('EDNS udp size should be in [0-65535]', 'EDNS Error')
+        return false
+    }
+    result["edns_version"] = isNaN(parseInt(result["edns_version"])) ? 0 : parseInt(result["edns_version"])
+    if (result["edns_version"] < 0 || result["edns_version"] > 255) {
+        toastr.error('EDNS version should be in [0-255]', 'EDNS Error')
+        return false
+    }
+    result["edns_padding"] = isNaN(parseInt(result["edns_padding"])) ? 0 : parseInt(result["edns_padding"])
+    if (result["edns_padding"] < 0 || result["edns_padding"] > 65535) {
+        toastr.error('EDNS padding block size should be in [0-65535]', 'EDNS Error')
+        return false
+    }
+    result["update_ttl"] = isNaN(parseInt(result["update_ttl"])) ? 300 : parseInt(result["update_ttl"])
+    if (result["job_type"] === "update" && result["update_zone"] === "") {
+        toastr.error('update zone is empty', 'Config Error')
+        return false
+    }
+    result["transfer_serial"] = isNaN(parseInt(result["transfer_serial"])) ? 0 : parseInt(result["transfer_serial"])
+    if (result["job_type"] === "xfr") {
+        if (result["transfer_zone"] === "") {
+            toastr.error('transfer zone is empty', 'Config Error')
+            return false
+        }
+        result["protocol"] = "tcp"
+    }
+    if (result["job_type"] === "notify" && $.trim(result["notify_zones"] || "") === "") {
+        toastr.error('notify zones is empty', 'Config Error')
+        return false
+    }
+    result["ephemeral_queries"] = isNaN(parseInt(result["ephemeral_queries"])) ? 0 : parseInt(result["ephemeral_queries"])
+    result["fd_budget"] = isNaN(parseInt(result["fd_budget"])) ? 1024 : parseInt(result["fd_budget"])
+    if (result["ephemeral_queries"] < 0 || result["fd_budget"] <= 0) {
+        toastr.error('Ephemeral queries and fd budget should not be nagetive', 'Config Error')
+        return false
+    }
+    if (result["tcp_fallback"] === "true" && result["protocol"] === "tcp") {
+        toastr.error('tcp fallback only work with udp', 'Config Error')
+        return false
+    }
+    if (result["ephemeral_queries"] > 0 && result["protocol"] === "tcp") {
+        toastr.error('ephemeral sockets only support udp', 'Config Error')
+        return false
+    }
+    if (result["source_policy"] === "query" && result["protocol"] === "tcp") {
+        toastr.error('query source policy only support udp', 'Config Error')
+        return false
+    }
+    var abortRatios = ["abort_timeout_ratio", "abort_servfail_ratio", "abort_error_ratio"]
+    for (var i = 0; i < abortRatios.length; i++) {
+        result[abortRatios[i]] = isNaN(parseFloat(result[abortRatios[i]])) ? 0 : parseFloat(result[abortRatios[i]])
+        if (result[abortRatios[i]] < 0 || result[abortRatios[i]] > 100) {
+            toastr.error('Abort ratio should be in [0-100]', 'Abort Error')
+            return false
+        }
+    }
+    result["abort_seconds"] = isNaN(parseInt(result["abort_seconds"])) ? 3 : parseInt(result["abort_seconds"])
+    if (result["abort_seconds"] <= 0) {
+        toastr.error('Abort seconds should be larger than 0', 'Abort Error')
+        return false
+    }
+    result["replay_speed"] = isNaN(parseFloat(result["replay_speed"])) ? 1 : parseFloat(result["replay_speed"])
+    if (result["replay_speed"] <= 0) {
+        toastr.error('Replay speed should be larger than 0', 'Speed Error')
+        return false
     }
     return true
 }
 
+/**
+ * uploadReplayFile upload the capture file of replay job
+ * @param {function} callback - called with the saved file name
+ */
+function uploadReplayFile(callback) {
+    var files = $("input[name=replay_upload]")[0].files
+    if (files.length === 0) {
+        if ($("input[name=replay_file]").val() !== "") {
+            callback($("input[name=replay_file]").val())
+            return
+        }
+        toastr.error('capture file is empty', 'Config Error')
+        return
+    }
+    var formData = new FormData()
+    formData.append("file", files[0])
+    $.ajax({
+        type: "POST",
+        url: "/upload",
+        data: formData,
+        processData: false,
+        contentType: false,
+        success: function (response) {
+            toastr.info("upload " + response["queries"] + " queries success")
+            $("input[name=replay_file]").val(response["file"])
+            callback(response["file"])
+        },
+        error: function (err) {
+            if (err && err.responseJSON && err.responseJSON.error) {
+                toastr.error(err.responseJSON.error, "Upload fail")
+            } else {
+                toastr.error("Upload fail", "Server Fail")
+            }
+        }
+    })
+}
+
 function Logger(id) {
     this.messageArray = [];
     this.logBoxContainer = $("#" + id)
@@ -198,13 +326,20 @@ $(document).ready(function () {
         "dataSrc": "data",
         "pagingType": "simple",
         "columns": [
-            {data: "server"},
+            {
+                "data": function(row){
+                    return row.targets ? row.targets : row.server;
+                },
+            },
+            {data: "resolved_targets"},
             {data: "port"},
             {data: "duration"},
             {data: "qps"},
             {data: "domain"},
             {data: "domain_random_length"},
             {data: "query_type"},
+            {data: "slo"},
+            {data: "user"},
             {
                 "targets": -2,
                 "data": function(row){
@@ -214,15 +349,19 @@ $(document).ready(function () {
             {
                 "targets": -1,
                 "data": null,
-                "defaultContent": "<button>Reload</button>"
+                "defaultContent": "<button class='reload-history'>Reload</button> " +
+                    ($('#history-table').attr("data-operator") === "true" ? "<button class='template-history'>Template</button> " : "") +
+                    "<input type='checkbox' class='compare-select' title='compare'>"
             } 
         ]
     });
-    $(".config-submit").click(function () {
-        var result = getFormData($('form[name="config"]'))
-        if (validateConfig(result) === false) {
-            return
-        }
+    $("input[name=job_type]").change(function () {
+        $(".replay-item").toggleClass("hide", $(this).val() !== "replay")
+        $(".update-item").toggleClass("hide", $(this).val() !== "update")
+        $(".xfr-item").toggleClass("hide", $(this).val() !== "xfr")
+        $(".notify-item").toggleClass("hide", $(this).val() !== "notify")
+    })
+    function startJob(result) {
         $.ajax({
             type: "POST",
             url: "/start",
@@ -231,6 +370,9 @@ $(document).ready(function () {
                 $('.master-running').removeClass("hide")
                 globalJobInfo.id = response["id"]
                 historyTable.ajax.reload();
+                if (response["agent_errors"]) {
+                    toastr.warning(response["agent_errors"], "Agents fail to start the job")
+                }
             },
             error: function (err) {
                 console.log(err)
@@ -242,12 +384,69 @@ $(document).ready(function () {
             },
             contentType: "application/json"
         })
+    }
+    /**
+     * submitConfig validate the config form and call the callback with
+     * the job, the capture file of replay job is uploaded first
+     */
+    function submitConfig(callback) {
+        var result = getFormData($('form[name="config"]'))
+        if (validateConfig(result) === false) {
+            return
+        }
+        if (result["job_type"] === "replay") {
+            uploadReplayFile(function (file) {
+                result["replay_file"] = file
+                callback(result)
+            })
+            return
+        }
+        callback(result)
+    }
+    $(".config-submit").click(function () {
+        submitConfig(startJob)
+    })
+    function postQueue(url, data, title) {
+        $.ajax({
+            type: "POST",
+            url: url,
+            data: JSON.stringify(data),
+            success: function () {
+                toastr.info(title + " success")
+            },
+            error: function (err) {
+                if (err && err.responseJSON && err.responseJSON.error) {
+                    toastr.error(err.responseJSON.error, title + " fail")
+                } else {
+                    toastr.error(title + " fail", "Server Fail")
+                }
+            },
+            contentType: "application/json"
+        })
+    }
+    $(".config-queue").click(function () {
+        submitConfig(function (result) {
+            postQueue("/queue", result, "queue job")
+        })
+    })
+    $(".config-schedule").click(function () {
+        var name = window.prompt("Name of the schedule")
+        if (!name) {
+            return
+        }
+        var cron = window.prompt("Cron expression of the schedule, e.g. 0 2 * * * runs at 02:00 every day", "0 2 * * *")
+        if (!cron) {
+            return
+        }
+        submitConfig(function (result) {
+            postQueue("/schedules", {name: name, cron: cron, job: result}, "add schedule")
+        })
     })
     $("#delete-agent").click(function () {
-        var ipWithPort = $(this).attr("data-item")
+        var ipWithPort = splitHostPort($(this).attr("data-item"))
         var data = {
-            "ipaddress": ipWithPort.split(":")[0],
-            "port": ipWithPort.split(":")[1]
+            "ipaddress": ipWithPort[0],
+            "port": ipWithPort[1]
         }
         $.ajax({
             type: "DELETE",
@@ -292,12 +491,12 @@ $(document).ready(function () {
         })
     }
     $("#disable-agent").click(function () {
-        var ipWithPort = $(this).attr("data-item").split(":")
+        var ipWithPort = splitHostPort($(this).attr("data-item"))
 
         updateAgentEnableStatus(ipWithPort[0],ipWithPort[1],false)
     })
     $("#enable-agent").click(function(){
-        var ipWithPort = $(this).attr("data-item").split(":")
+        var ipWithPort = splitHostPort($(this).attr("data-item"))
         updateAgentEnableStatus(ipWithPort[0],ipWithPort[1],true)
     })
     $("#show-history").click(function () {
@@ -314,12 +513,17 @@ $(document).ready(function () {
         var keys = Object.keys(data)
         console.log(data)
         for(var i = 0; i<keys.length; i++){
-            var inputSelector = "form[name='config'] input[name='"+keys[i]+"']"
+            var inputSelector = "form[name='config'] :input[name='"+keys[i]+"']"
             if($(inputSelector).length===1){
                     $(inputSelector).val(data[keys[i]])
                     continue
             }
-            if($(inputSelector).length===2 && $(inputSelector).is(':radio')){
+            if($(inputSelector).length>=2 && $(inputSelector).is(':radio')){
+                var radioSelector = inputSelector + "[value='" + data[keys[i]] + "']"
+                if($(radioSelector).length===1){
+                    $(radioSelector).prop("checked", true).change()
+                    continue
+                }
                 if(data[keys[i]]==="true"){
                     $(inputSelector).eq(0).attr("checked","checked")
                 }else{
@@ -329,7 +533,7 @@ $(document).ready(function () {
         }
     }
 
-    $('#history-table tbody').on( 'click', 'button', function () {
+    $('#history-table tbody').on( 'click', 'button.reload-history', function () {
         var data = historyTable.row( $(this).parents('tr') ).data();
         // hide the table 
         $(".history-box").addClass("hide")
@@ -337,6 +541,122 @@ $(document).ready(function () {
         updateConfigurationFromData(data)
         
     } );
+    $('#history-table tbody').on('click', 'button.template-history', function () {
+        var data = historyTable.row($(this).parents('tr')).data()
+        var name = window.prompt("Name of the template, the job is saved as a new version when the name exists")
+        if (!name) {
+            return
+        }
+        var description = window.prompt("Description of the template", "") || ""
+        postTemplate({name: name, description: description, history_id: String(data.ID)})
+    })
+    // the template loaded by ?template=name&version=n, it is the default
+    // of the saved template
+    var loadedTemplate = {name: "", description: ""}
+    function postTemplate(data) {
+        $.ajax({
+            type: "POST",
+            url: "/templates",
+            data: JSON.stringify(data),
+            success: function (response) {
+                toastr.info("save template " + response["id"] + " version " + response["status"] + " success")
+                loadedTemplate = {name: data.name, description: data.description}
+            },
+            error: function (err) {
+                if (err && err.responseJSON && err.responseJSON.error) {
+                    toastr.error(err.responseJSON.error, "save template fail")
+                } else {
+                    toastr.error("save template fail", "Server Fail")
+                }
+            },
+            contentType: "application/json"
+        })
+    }
+    $(".config-template").click(function () {
+        var name = window.prompt("Name of the template, the job is saved as a new version when the name exists", loadedTemplate.name)
+        if (!name) {
+            return
+        }
+        var description = window.prompt("Description of the template", loadedTemplate.description)
+        if (description === null) {
+            return
+        }
+        submitConfig(function (result) {
+            postTemplate({name: name, description: description, job: result})
+        })
+    })
+    var templateQuery = new URLSearchParams(window.location.search)
+    if (templateQuery.get("template")) {
+        var templateURL = "/templates/" + encodeURIComponent(templateQuery.get("template"))
+        if (templateQuery.get("version")) {
+            templateURL += "?version=" + encodeURIComponent(templateQuery.get("version"))
+        }
+        $.ajax({
+            type: "GET",
+            url: templateURL,
+            success: function (template) {
+                updateConfigurationFromData(template.config)
+                loadedTemplate = {name: template.name, description: template.description}
+                toastr.info("load template " + template.name + " version " + template.version)
+            },
+            error: function (err) {
+                if (err && err.responseJSON && err.responseJSON.error) {
+                    toastr.error(err.responseJSON.error, "load template fail")
+                } else {
+                    toastr.error("load template fail", "Server Fail")
+                }
+            },
+            contentType: "application/json"
+        })
+    }
+    function showComparison(comparison){
+        var body = $("#compare-table tbody").empty()
+        var diffs = comparison.config_diff || []
+        for(var i = 0; i<diffs.length; i++){
+            body.append($("<tr>").append(
+                $("<td>").text("config " + diffs[i].field),
+                $("<td>").text(diffs[i].a),
+                $("<td>").text(diffs[i].b),
+                $("<td>")))
+        }
+        for(var i = 0; i<comparison.rows.length; i++){
+            var row = comparison.rows[i]
+            body.append($("<tr>").toggleClass("regression", row.regression).append(
+                $("<td>").text(row.metric),
+                $("<td>").text(row.a),
+                $("<td>").text(row.b),
+                $("<td>").text(row.delta)))
+        }
+        $("#compare-summary").text(comparison.regressions + " regressions")
+        $("#myCompareModal").modal("show")
+    }
+
+    $("#compare-history").click(function () {
+        var selected = []
+        $("#history-table .compare-select:checked").each(function () {
+            selected.push(historyTable.row($(this).parents('tr')).data().ID)
+        })
+        if(selected.length !== 2){
+            toastr.error("Select two jobs to compare", "Compare Error")
+            return
+        }
+        // the earlier job is the base
+        selected.sort(function (a, b) { return a - b })
+        $.ajax({
+            type: "GET",
+            url: "/compare?a=" + selected[0] + "&b=" + selected[1],
+            success: showComparison,
+            error: function (err) {
+                if (err && err.responseJSON && err.responseJSON.error) {
+                    toastr.error(err.responseJSON.error, "Compare Error")
+                } else {
+                    toastr.error("ServerFail")
+                }
+            },
+            contentType: "application/json"
+        })
+    })
+
     function updatePingStatus(ipinfo, pingSuccess){
         if(pingSuccess === true){
             $(".agent-ping[data-item='"+ipinfo+"']").find("i").removeClass("hide")
@@ -348,8 +668,8 @@ $(document).ready(function () {
     $(".small-ping-button").click(function () {
         var ipWithPort = $(this).attr("data-item")
         var data = {
-            "ipaddress": ipWithPort.split(":")[0],
-            "port": ipWithPort.split(":")[1]
+            "ipaddress": splitHostPort(ipWithPort)[0],
+            "port": splitHostPort(ipWithPort)[1]
         }
         $.ajax({
             type: "POST",
@@ -391,6 +711,31 @@ $(document).ready(function () {
         })
     })
 
+    $('.change-password').click(function () {
+        var data = getFormData($("form[name='change-password']"))
+        if (data.password === "") {
+            toastr.error('New password is empty', 'Password Error')
+            return
+        }
+        $.ajax({
+            type: "POST",
+            url: "/password",
+            data: JSON.stringify(data),
+            success: function (response) {
+                $("#myPasswordModal").modal("hide")
+                toastr.success("change password success")
+            },
+            error: function (err) {
+                if (err && err.responseJSON && err.responseJSON.error) {
+                    toastr.error(err.responseJSON.error, "Change password fail")
+                } else {
+                    toastr.error("Change password fail", "ServerFail")
+                }
+            },
+            contentType: "application/json"
+        })
+    })
+
     $('.new-agent').click(function () {
         var data = getFormData($("form[name='new-agent']"))
         if (typeof data.ipaddress === 'undefined' || data.ipaddress === "") {
@@ -426,7 +771,7 @@ $(document).ready(function () {
     })
     function updateAgentStatus(nodes){
         nodes.map(function(node){
-            var nodeInfo = node.ip + ":" + node.port;
+            var nodeInfo = joinHostPort(node.ip, node.port);
             if(node.status === "running"){
                 $(".agent-running[data-item='"+nodeInfo+"']").find("i.running-success").removeClass("hide")
             }else{
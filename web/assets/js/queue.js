@@ -0,0 +1,134 @@
+/**
+ * showError show the error message of the ajax request
+ * @param {object} err - the jquery ajax error
+ * @param {string} title - the title of message
+ */
+function showError(err, title) {
+    if (err && err.responseJSON && err.responseJSON.error) {
+        toastr.error(err.responseJSON.error, title)
+    } else {
+        toastr.error(title, "Server Fail")
+    }
+}
+
+/**
+ * request send the json data to url and reload the queue when success
+ */
+function request(type, url, data, title) {
+    $.ajax({
+        type: type,
+        url: url,
+        data: data ? JSON.stringify(data) : null,
+        success: function () {
+            toastr.info(title + " success")
+            loadQueue()
+        },
+        error: function (err) {
+            showError(err, title + " fail")
+        },
+        contentType: "application/json"
+    })
+}
+
+/**
+ * formatTime return the relative time, "-" for the empty time
+ */
+function formatTime(time) {
+    if (!time || moment(time).year() <= 1) {
+        return "-"
+    }
+    return moment(time).fromNow()
+}
+
+/**
+ * loadQueue get the queued jobs and the schedules and render the lists
+ */
+function loadQueue() {
+    var operator = $(".queue-list").attr("data-operator") === "true"
+    $.ajax({
+        type: "GET",
+        url: "/queue/list",
+        success: function (response) {
+            var body = $(".queue-list").empty()
+            var jobs = response.data || []
+            for (var i = 0; i < jobs.length; i++) {
+                var job = jobs[i]
+                var config = job.config || {}
+                var functions = $("<td>")
+                if (operator && (job.state === "queued" || job.state === "start" || job.state === "running")) {
+                    functions.append($("<button class='btn function-btn warning-btn cancel-job'><i class='fa fa-ban' aria-hidden='true'></i> Cancel</button>"))
+                }
+                var state = $("<span>").text(job.state)
+                if (job.error) {
+                    state.attr("title", job.error)
+                }
+                body.append($("<tr>").attr("data-item", job.ID).append(
+                    $("<td>").text(job.ID),
+                    $("<td>").text(config.server + ":" + config.port),
+                    $("<td>").text(config.job_type),
+                    $("<td>").text(config.duration),
+                    $("<td>").text(config.qps),
+                    $("<td>").text(config.domain),
+                    $("<td>").text(job.schedule || "-"),
+                    $("<td>").text(job.user),
+                    $("<td>").text(formatTime(job.CreatedAt)),
+                    $("<td>").append(state),
+                    $("<td>").text(job.history_id || "-"),
+                    functions))
+            }
+            body = $(".schedule-list").empty()
+            var schedules = response.schedules || []
+            for (var j = 0; j < schedules.length; j++) {
+                var schedule = schedules[j]
+                functions = $("<td>")
+                if (operator) {
+                    functions.append(
+                        schedule.enable ?
+                            $("<button class='btn function-btn disable-schedule'><i class='fa fa-eye-slash' aria-hidden='true'></i> Disable</button>") :
+                            $("<button class='btn function-btn enable-schedule'><i class='fa fa-eye' aria-hidden='true'></i> Enable</button>"),
+                        " ",
+                        $("<button class='btn function-btn warning-btn delete-schedule'><i class='fa fa-trash' aria-hidden='true'></i> Delete</button>"))
+                }
+                body.append($("<tr>").attr("data-item", schedule.ID).attr("data-name", schedule.name).append(
+                    $("<td>").text(schedule.name),
+                    $("<td>").text(schedule.cron),
+                    $("<td>").text(schedule.config.server + ":" + schedule.config.port),
+                    $("<td>").text(schedule.enable ? moment(schedule.next_run).format("YYYY-MM-DD HH:mm") : "disabled"),
+                    $("<td>").text(formatTime(schedule.last_run)),
+                    $("<td>").text(schedule.user),
+                    functions))
+            }
+        },
+        error: function (err) {
+            showError(err, "Load queue fail")
+        },
+        contentType: "application/json"
+    })
+}
+
+$(document).ready(function () {
+    loadQueue()
+    setInterval(loadQueue, 3000)
+    $(".queue-list").on("click", ".cancel-job", function () {
+        var id = $(this).parents("tr").attr("data-item")
+        if (!window.confirm("Cancel job " + id + "?")) {
+            return
+        }
+        request("POST", "/queue/" + id + "/cancel", null, "cancel job")
+    })
+    $(".schedule-list").on("click", ".enable-schedule", function () {
+        var id = $(this).parents("tr").attr("data-item")
+        request("POST", "/schedules/" + id, {enable: true}, "enable schedule")
+    })
+    $(".schedule-list").on("click", ".disable-schedule", function () {
+        var id = $(this).parents("tr").attr("data-item")
+        request("POST", "/schedules/" + id, {enable: false}, "disable schedule")
+    })
+    $(".schedule-list").on("click", ".delete-schedule", function () {
+        var name = $(this).parents("tr").attr("data-name")
+        if (!window.confirm("Delete schedule " + name + "?")) {
+            return
+        }
+        request("DELETE", "/schedules/" + $(this).parents("tr").attr("data-item"), null, "delete schedule")
+    })
+})
@@ -0,0 +1,162 @@
+/**
+ * showError show the error message of the ajax request
+ * @param {object} err - the jquery ajax error
+ * @param {string} title - the title of message
+ */
+function showError(err, title) {
+    if (err && err.responseJSON && err.responseJSON.error) {
+        toastr.error(err.responseJSON.error, title)
+    } else {
+        toastr.error(title, "Server Fail")
+    }
+}
+
+/**
+ * request send the json data to url and reload the templates when success
+ */
+function request(type, url, data, title) {
+    $.ajax({
+        type: type,
+        url: url,
+        data: data ? JSON.stringify(data) : null,
+        success: function () {
+            toastr.info(title + " success")
+            loadTemplates()
+        },
+        error: function (err) {
+            showError(err, title + " fail")
+        },
+        contentType: "application/json"
+    })
+}
+
+/**
+ * templateRow return the row of the template version
+ * @param {object} template - the template
+ * @param {boolean} latest - the template is the last version
+ */
+function templateRow(template, latest) {
+    var operator = $(".template-list").attr("data-operator") === "true"
+    var config = template.config || {}
+    var name = encodeURIComponent(template.name)
+    var query = latest ? "" : "?version=" + template.version
+    var functions = $("<td>").append(
+        $("<a class='btn function-btn'><i class='fa fa-pencil' aria-hidden='true'></i> Edit</a>")
+            .attr("href", "/?template=" + name + (latest ? "" : "&version=" + template.version)),
+        " ",
+        $("<a class='btn function-btn'><i class='fa fa-download' aria-hidden='true'></i> Export</a>")
+            .attr("href", "/templates/" + name + "/export" + query))
+    if (operator) {
+        functions.append(" ", $("<button class='btn function-btn start-template'><i class='fa fa-play-circle' aria-hidden='true'></i> Start</button>"))
+    }
+    if (latest) {
+        functions.append(" ", $("<button class='btn function-btn show-versions'><i class='fa fa-history' aria-hidden='true'></i> Versions</button>"))
+        if (operator) {
+            functions.append(" ", $("<button class='btn function-btn warning-btn delete-template'><i class='fa fa-trash' aria-hidden='true'></i> Delete</button>"))
+        }
+    }
+    return $("<tr>").toggleClass("template-version", !latest)
+        .attr("data-item", template.name).attr("data-version", latest ? "" : template.version).append(
+            $("<td>").text(latest ? template.name : ""),
+            $("<td>").text("v" + template.version),
+            $("<td>").text(template.description),
+            $("<td>").text(config.server + ":" + config.port),
+            $("<td>").text(config.job_type),
+            $("<td>").text(config.duration),
+            $("<td>").text(config.qps),
+            $("<td>").text(template.user),
+            $("<td>").text(moment(template.CreatedAt).fromNow()),
+            functions)
+}
+
+/**
+ * loadTemplates get the last version of templates and render the list
+ */
+function loadTemplates() {
+    $.ajax({
+        type: "GET",
+        url: "/templates/list",
+        success: function (response) {
+            var body = $(".template-list").empty()
+            var templates = response.data || []
+            for (var i = 0; i < templates.length; i++) {
+                body.append(templateRow(templates[i], true))
+            }
+        },
+        error: function (err) {
+            showError(err, "Load templates fail")
+        },
+        contentType: "application/json"
+    })
+}
+
+$(document).ready(function () {
+    loadTemplates()
+    $(".template-list").on("click", ".show-versions", function () {
+        var row = $(this).parents("tr")
+        var name = row.attr("data-item")
+        var shown = row.nextUntil(":not(.template-version)")
+        if (shown.length > 0) {
+            shown.remove()
+            return
+        }
+        $.ajax({
+            type: "GET",
+            url: "/templates/" + encodeURIComponent(name) + "/versions",
+            success: function (response) {
+                var versions = response.data || []
+                // the last version is the row itself
+                for (var i = versions.length - 1; i >= 1; i--) {
+                    row.after(templateRow(versions[i], false))
+                }
+            },
+            error: function (err) {
+                showError(err, "Load versions fail")
+            },
+            contentType: "application/json"
+        })
+    })
+    $(".template-list").on("click", ".start-template", function () {
+        var row = $(this).parents("tr")
+        var name = row.attr("data-item")
+        var url = "/templates/" + encodeURIComponent(name) + "/start"
+        if (row.attr("data-version")) {
+            url += "?version=" + row.attr("data-version")
+        }
+        if (!window.confirm("Start template " + name + "?")) {
+            return
+        }
+        request("POST", url, null, "start template")
+    })
+    $(".template-list").on("click", ".delete-template", function () {
+        var name = $(this).parents("tr").attr("data-item")
+        if (!window.confirm("Delete all versions of template " + name + "?")) {
+            return
+        }
+        request("DELETE", "/templates/" + encodeURIComponent(name), null, "delete template")
+    })
+    $(".import-template").click(function () {
+        var files = $("form[name='import-template'] input[name=file]")[0].files
+        if (files.length === 0) {
+            toastr.error("template file is empty", "Import Error")
+            return
+        }
+        var formData = new FormData()
+        formData.append("file", files[0])
+        $.ajax({
+            type: "POST",
+            url: "/templates/import",
+            data: formData,
+            processData: false,
+            contentType: false,
+            success: function (response) {
+                toastr.info("import template " + response["id"] + " version " + response["status"] + " success")
+                $("form[name='import-template']")[0].reset()
+                loadTemplates()
+            },
+            error: function (err) {
+                showError(err, "Import template fail")
+            }
+        })
+    })
+})
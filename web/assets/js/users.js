@@ -0,0 +1,99 @@
+/**
+ * showError show the error message of the ajax request
+ * @param {object} err - the jquery ajax error
+ * @param {string} title - the title of message
+ */
+function showError(err, title) {
+    if (err && err.responseJSON && err.responseJSON.error) {
+        toastr.error(err.responseJSON.error, title)
+    } else {
+        toastr.error(title, "Server Fail")
+    }
+}
+
+/**
+ * request send the json data to url and reload the user list when success
+ */
+function request(type, url, data, title) {
+    $.ajax({
+        type: type,
+        url: url,
+        data: data ? JSON.stringify(data) : null,
+        success: function () {
+            toastr.info(title + " success")
+            loadUsers()
+        },
+        error: function (err) {
+            showError(err, title + " fail")
+        },
+        contentType: "application/json"
+    })
+}
+
+/**
+ * loadUsers get all users and render the user list
+ */
+function loadUsers() {
+    var roles = $(".user-list").attr("data-roles").split(",")
+    $.ajax({
+        type: "GET",
+        url: "/users/list",
+        success: function (response) {
+            var body = $(".user-list").empty()
+            var users = response.data || []
+            for (var i = 0; i < users.length; i++) {
+                var select = $("<select class='user-role'>")
+                for (var j = 0; j < roles.length; j++) {
+                    select.append($("<option>").val(roles[j]).text(roles[j]).prop("selected", roles[j] === users[i].role))
+                }
+                body.append($("<tr>").attr("data-item", users[i].username).append(
+                    $("<td>").append($("<i class='fa fa-user' aria-hidden='true'></i>"), " ", $("<span>").text(users[i].username)),
+                    $("<td>").append(select),
+                    $("<td>").text(moment(users[i].CreatedAt).fromNow()),
+                    $("<td>").append(
+                        $("<button class='btn function-btn reset-password'><i class='fa fa-key' aria-hidden='true'></i> Password</button>"),
+                        " ",
+                        $("<button class='btn function-btn warning-btn delete-user'><i class='fa fa-trash' aria-hidden='true'></i> Delete</button>"))))
+            }
+        },
+        error: function (err) {
+            showError(err, "Load users fail")
+        },
+        contentType: "application/json"
+    })
+}
+
+$(document).ready(function () {
+    loadUsers()
+    $(".new-user").click(function () {
+        var data = {}
+        $.map($("form[name='new-user']").serializeArray(), function (n) {
+            data[n["name"]] = n["value"]
+        })
+        if (data.username === "" || data.password === "") {
+            toastr.error('Username and password should not be empty', 'User Error')
+            return
+        }
+        request("POST", "/users", data, "add user")
+        $("form[name='new-user']")[0].reset()
+    })
+    $(".user-list").on("change", ".user-role", function () {
+        var username = $(this).parents("tr").attr("data-item")
+        request("POST", "/users/" + encodeURIComponent(username), {role: $(this).val()}, "update role")
+    })
+    $(".user-list").on("click", ".reset-password", function () {
+        var username = $(this).parents("tr").attr("data-item")
+        var password = window.prompt("New password of " + username)
+        if (!password) {
+            return
+        }
+        request("POST", "/users/" + encodeURIComponent(username), {password: password}, "reset password")
+    })
+    $(".user-list").on("click", ".delete-user", function () {
+        var username = $(this).parents("tr").attr("data-item")
+        if (!window.confirm("Delete user " + username + "?")) {
+            return
+        }
+        request("DELETE", "/users/" + encodeURIComponent(username), null, "delete user")
+    })
+})
@@ -0,0 +1,193 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+	"github.com/unrolled/render"
+	"github.com/zhangmingkai4315/dns-loader/core"
+)
+
+// JobTemplateForm define the posted template, the job is saved from the
+// history when history id is set
+type JobTemplateForm struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	HistoryID   string          `json:"history_id"`
+	Job         *core.JobConfig `json:"job"`
+}
+
+// saveJobTemplate save the job of form as a new version of the template
+func saveJobTemplate(form *JobTemplateForm, username string) (*core.JobTemplate, error) {
+	dbHandler := core.GetDBHandler()
+	if form.HistoryID != "" {
+		return dbHandler.CreateJobTemplateFromHistory(form.Name, form.Description, form.HistoryID, username)
+	}
+	if form.Job == nil {
+		return nil, errors.New("job of template is empty")
+	}
+	if err := confineTSIGKeyFile(form.Job); err != nil {
+		return nil, err
+	}
+	if err := form.Job.ValidateJob(); err != nil {
+		return nil, err
+	}
+	return dbHandler.SaveJobTemplate(form.Name, form.Description, form.Job, username)
+}
+
+// getJobTemplate return the template of url, the version query select a
+// version other than the last one
+func getJobTemplate(req *http.Request) (*core.JobTemplate, error) {
+	version, _ := strconv.Atoi(req.URL.Query().Get("version"))
+	return core.GetDBHandler().GetJobTemplate(mux.Vars(req)["name"], version)
+}
+
+// hideTemplateSecrets blank the tsig secret of templates in response
+func hideTemplateSecrets(templates []core.JobTemplate) []core.JobTemplate {
+	for i := range templates {
+		templates[i].Config.TSIGSecret = ""
+	}
+	return templates
+}
+
+func templatesPage(w http.ResponseWriter, req *http.Request) {
+	r := render.New(render.Options{})
+	r.HTML(w, http.StatusOK, "jobtemplates", map[string]interface{}{
+		"user": currentUser(req),
+	})
+}
+
+func listJobTemplates(w http.ResponseWriter, req *http.Request) {
+	r := render.New(render.Options{})
+	templates, err := core.GetDBHandler().GetJobTemplates()
+	if err != nil {
+		r.JSON(w, http.StatusInternalServerError, JSONResponse{Error: err.Error()})
+		return
+	}
+	r.JSON(w, http.StatusOK, map[string]interface{}{"data": hideTemplateSecrets(templates)})
+}
+
+func showJobTemplate(w http.ResponseWriter, req *http.Request) {
+	r := render.New(render.Options{})
+	template, err := getJobTemplate(req)
+	if err != nil {
+		r.JSON(w, http.StatusNotFound, JSONResponse{Error: err.Error()})
+		return
+	}
+	template.Config.TSIGSecret = ""
+	r.JSON(w, http.StatusOK, template)
+}
+
+func listJobTemplateVersions(w http.ResponseWriter, req *http.Request) {
+	r := render.New(render.Options{})
+	templates, err := core.GetDBHandler().GetJobTemplateVersions(mux.Vars(req)["name"])
+	if err != nil {
+		r.JSON(w, http.StatusNotFound, JSONResponse{Error: err.Error()})
+		return
+	}
+	r.JSON(w, http.StatusOK, map[string]interface{}{"data": hideTemplateSecrets(templates)})
+}
+
+func createJobTemplate(w http.ResponseWriter, req *http.Request) {
+	r := render.New(render.Options{})
+	var form JobTemplateForm
+	if err := json.NewDecoder(req.Body).Decode(&form); err != nil {
+		r.JSON(w, http.StatusBadRequest, JSONResponse{Error: "decode post data fail"})
+		return
+	}
+	user := currentUser(req)
+	template, err := saveJobTemplate(&form, user.Username)
+	if err != nil {
+		r.JSON(w, http.StatusBadRequest, JSONResponse{Error: "save template fail:" + err.Error()})
+		return
+	}
+	log.Infof("user %s save template %s version %d", user.Username, template.Name, template.Version)
+	r.JSON(w, http.StatusOK, JSONResponse{ID: template.Name, Status: strconv.Itoa(template.Version)})
+}
+
+func importJobTemplate(w http.ResponseWriter, req *http.Request) {
+	r := render.New(render.Options{})
+	file, _, err := req.FormFile("file")
+	if err != nil {
+		r.JSON(w, http.StatusBadRequest, JSONResponse{Error: "read upload file fail: " + err.Error()})
+		return
+	}
+	defer file.Close()
+	content, err := ioutil.ReadAll(file)
+	if err != nil {
+		r.JSON(w, http.StatusBadRequest, JSONResponse{Error: "read upload file fail: " + err.Error()})
+		return
+	}
+	template, err := core.ParseJobTemplateYAML(content)
+	if err != nil {
+		r.JSON(w, http.StatusBadRequest, JSONResponse{Error: err.Error()})
+		return
+	}
+	user := currentUser(req)
+	template, err = saveJobTemplate(&JobTemplateForm{
+		Name:        template.Name,
+		Description: template.Description,
+		Job:         &template.Config,
+	}, user.Username)
+	if err != nil {
+		r.JSON(w, http.StatusBadRequest, JSONResponse{Error: "import template fail:" + err.Error()})
+		return
+	}
+	log.Infof("user %s import template %s version %d", user.Username, template.Name, template.Version)
+	r.JSON(w, http.StatusOK, JSONResponse{ID: template.Name, Status: strconv.Itoa(template.Version)})
+}
+
+func exportJobTemplate(w http.ResponseWriter, req *http.Request) {
+	r := render.New(render.Options{})
+	template, err := getJobTemplate(req)
+	if err != nil {
+		r.JSON(w, http.StatusNotFound, JSONResponse{Error: err.Error()})
+		return
+	}
+	content, err := template.YAML()
+	if err != nil {
+		r.JSON(w, http.StatusInternalServerError, JSONResponse{Error: err.Error()})
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-yaml")
+	w.Header().Set("Content-Disposition", "attachment; filename="+template.Name+".yaml")
+	w.Write(content)
+}
+
+func startJobTemplate(w http.ResponseWriter, req *http.Request) {
+	r := render.New(render.Options{})
+	template, err := getJobTemplate(req)
+	if err != nil {
+		r.JSON(w, http.StatusNotFound, JSONResponse{Error: err.Error()})
+		return
+	}
+	user := currentUser(req)
+	historyID, agentErrors, err := startJob(&template.Config, user.Username)
+	if err != nil {
+		r.JSON(w, http.StatusBadRequest, JSONResponse{Error: err.Error()})
+		return
+	}
+	recordStartedJob(&template.Config, user.Username, historyID, agentErrors)
+	log.Infof("user %s start template %s version %d", user.Username, template.Name, template.Version)
+	r.JSON(w, http.StatusOK, JSONResponse{
+		ID:          template.Config.JobID,
+		Status:      core.GetGlobalAppController().GetCurrentJobStatusString(),
+		AgentErrors: agentErrors,
+	})
+}
+
+func deleteJobTemplate(w http.ResponseWriter, req *http.Request) {
+	r := render.New(render.Options{})
+	name := mux.Vars(req)["name"]
+	if err := core.GetDBHandler().DeleteJobTemplate(name); err != nil {
+		r.JSON(w, http.StatusBadRequest, JSONResponse{Error: "delete template fail:" + err.Error()})
+		return
+	}
+	log.Infof("user %s delete template %s", currentUser(req).Username, name)
+	r.JSON(w, http.StatusOK, JSONResponse{})
+}
@@ -0,0 +1,237 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+	"github.com/unrolled/render"
+	"github.com/zhangmingkai4315/dns-loader/core"
+)
+
+// queueHistoryLength is the number of jobs left the queue to show
+const queueHistoryLength = 20
+
+// QueueItem is a job of queue with the status of its run
+type QueueItem struct {
+	core.QueuedJob
+	Schedule string `json:"schedule"`
+	State    string `json:"state"`
+}
+
+// ScheduleForm define the posted schedule
+type ScheduleForm struct {
+	Name   string         `json:"name"`
+	Cron   string         `json:"cron"`
+	Enable bool           `json:"enable"`
+	Job    core.JobConfig `json:"job"`
+}
+
+// runQueue queue the jobs of the due schedules and start the queued jobs
+// in order when no job is running
+func runQueue() {
+	dbHandler := core.GetDBHandler()
+	for range time.Tick(time.Second) {
+		if err := dbHandler.EnqueueDueSchedules(time.Now()); err != nil {
+			log.Errorf("queue the jobs of schedules fail:%s", err)
+		}
+		if atomic.LoadInt32(&jobActive) != 0 {
+			continue
+		}
+		queued, err := dbHandler.NextQueuedJob()
+		if err != nil {
+			log.Errorf("get queued job fail:%s", err)
+			continue
+		}
+		if queued == nil {
+			continue
+		}
+		job := queued.Config
+		// a job started directly by the user may win the race, the
+		// queued job is started after it
+		historyID, agentErrors, err := startJob(&job, queued.User)
+		if err == errJobNotReady {
+			continue
+		}
+		now := time.Now()
+		queued.StartedAt = &now
+		queued.Status = core.QueueStatusStarted
+		queued.HistoryID = historyID
+		queued.Error = agentErrors
+		if err == nil && historyID == 0 {
+			// the job is running but its run can't be followed
+			err = errors.New("job is started but not saved in history")
+		}
+		if err != nil {
+			queued.Status = core.QueueStatusFailed
+			queued.Error = err.Error()
+			log.Errorf("start queued job %d fail:%s", queued.ID, err)
+		} else {
+			log.Infof("start queued job %d of user %s", queued.ID, queued.User)
+		}
+		if err := dbHandler.Save(queued).Error; err != nil {
+			log.Errorf("save queued job fail:%s", err)
+		}
+	}
+}
+
+// recordStartedJob add the job started directly by the user to the queue,
+// the direct start preempt the queued jobs
+func recordStartedJob(job *core.JobConfig, user string, historyID uint, agentErrors string) {
+	if _, err := core.GetDBHandler().RecordStartedJob(job, user, historyID, agentErrors); err != nil {
+		log.Errorf("record started job in queue fail:%s", err)
+	}
+}
+
+func queuePage(w http.ResponseWriter, req *http.Request) {
+	r := render.New(render.Options{})
+	r.HTML(w, http.StatusOK, "queue", map[string]interface{}{
+		"user": currentUser(req),
+	})
+}
+
+func listQueue(w http.ResponseWriter, req *http.Request) {
+	r := render.New(render.Options{})
+	dbHandler := core.GetDBHandler()
+	jobs, err := dbHandler.GetQueuedJobs(queueHistoryLength)
+	if err != nil {
+		r.JSON(w, http.StatusInternalServerError, JSONResponse{Error: err.Error()})
+		return
+	}
+	schedules, err := dbHandler.GetSchedules()
+	if err != nil {
+		r.JSON(w, http.StatusInternalServerError, JSONResponse{Error: err.Error()})
+		return
+	}
+	names := map[uint]string{}
+	for i := range schedules {
+		names[schedules[i].ID] = schedules[i].Name
+		schedules[i].Config.TSIGSecret = ""
+	}
+	items := []QueueItem{}
+	for _, job := range jobs {
+		item := QueueItem{QueuedJob: job, Schedule: names[job.ScheduleID], State: job.Status}
+		item.Config.TSIGSecret = ""
+		if job.Status == core.QueueStatusStarted {
+			if query, err := dbHandler.GetDNSQuery(strconv.Itoa(int(job.HistoryID))); err == nil {
+				item.State = jobStatus(query)
+			}
+		}
+		items = append(items, item)
+	}
+	r.JSON(w, http.StatusOK, map[string]interface{}{
+		"data":      items,
+		"schedules": schedules,
+	})
+}
+
+func enqueueJob(w http.ResponseWriter, req *http.Request) {
+	r := render.New(render.Options{})
+	job := core.JobConfig{}
+	if err := json.NewDecoder(req.Body).Decode(&job); err != nil {
+		r.JSON(w, http.StatusBadRequest, JSONResponse{Error: "decode post data fail"})
+		return
+	}
+	if err := confineTSIGKeyFile(&job); err != nil {
+		r.JSON(w, http.StatusBadRequest, JSONResponse{Error: err.Error()})
+		return
+	}
+	if err := job.ValidateJob(); err != nil {
+		r.JSON(w, http.StatusBadRequest, JSONResponse{Error: err.Error()})
+		return
+	}
+	user := currentUser(req)
+	queued, err := core.GetDBHandler().EnqueueJob(&job, user.Username, 0)
+	if err != nil {
+		r.JSON(w, http.StatusInternalServerError, JSONResponse{Error: err.Error()})
+		return
+	}
+	log.Infof("user %s queue job %d", user.Username, queued.ID)
+	r.JSON(w, http.StatusOK, JSONResponse{ID: strconv.Itoa(int(queued.ID)), Status: queued.Status})
+}
+
+// cancelQueuedJob cancel the job waiting in queue or stop the job when
+// it is running
+func cancelQueuedJob(w http.ResponseWriter, req *http.Request) {
+	r := render.New(render.Options{})
+	dbHandler := core.GetDBHandler()
+	id, _ := strconv.Atoi(mux.Vars(req)["id"])
+	queued, err := dbHandler.GetQueuedJob(uint(id))
+	if err != nil {
+		r.JSON(w, http.StatusNotFound, JSONResponse{Error: err.Error()})
+		return
+	}
+	if queued.Status == core.QueueStatusStarted {
+		query, err := dbHandler.GetDNSQuery(strconv.Itoa(int(queued.HistoryID)))
+		if err != nil || query.JobID != core.GetGlobalAppController().JobID {
+			r.JSON(w, http.StatusBadRequest, JSONResponse{Error: errJobStopped.Error()})
+			return
+		}
+		if err := stopJob(); err != nil {
+			r.JSON(w, http.StatusBadRequest, JSONResponse{Error: err.Error()})
+			return
+		}
+	} else if err := dbHandler.CancelQueuedJob(queued.ID); err != nil {
+		r.JSON(w, http.StatusBadRequest, JSONResponse{Error: err.Error()})
+		return
+	}
+	log.Infof("user %s cancel queued job %d", currentUser(req).Username, queued.ID)
+	r.JSON(w, http.StatusOK, JSONResponse{})
+}
+
+func createSchedule(w http.ResponseWriter, req *http.Request) {
+	r := render.New(render.Options{})
+	var form ScheduleForm
+	if err := json.NewDecoder(req.Body).Decode(&form); err != nil {
+		r.JSON(w, http.StatusBadRequest, JSONResponse{Error: "decode post data fail"})
+		return
+	}
+	if err := confineTSIGKeyFile(&form.Job); err != nil {
+		r.JSON(w, http.StatusBadRequest, JSONResponse{Error: err.Error()})
+		return
+	}
+	if err := form.Job.ValidateJob(); err != nil {
+		r.JSON(w, http.StatusBadRequest, JSONResponse{Error: err.Error()})
+		return
+	}
+	user := currentUser(req)
+	schedule, err := core.GetDBHandler().CreateSchedule(form.Name, form.Cron, &form.Job, user.Username)
+	if err != nil {
+		r.JSON(w, http.StatusBadRequest, JSONResponse{Error: "add schedule fail:" + err.Error()})
+		return
+	}
+	log.Infof("user %s add schedule %s at %s", user.Username, schedule.Name, schedule.Cron)
+	r.JSON(w, http.StatusOK, JSONResponse{ID: strconv.Itoa(int(schedule.ID))})
+}
+
+func updateSchedule(w http.ResponseWriter, req *http.Request) {
+	r := render.New(render.Options{})
+	var form ScheduleForm
+	if err := json.NewDecoder(req.Body).Decode(&form); err != nil {
+		r.JSON(w, http.StatusBadRequest, JSONResponse{Error: "decode post data fail"})
+		return
+	}
+	id, _ := strconv.Atoi(mux.Vars(req)["id"])
+	if err := core.GetDBHandler().UpdateScheduleEnable(uint(id), form.Enable); err != nil {
+		r.JSON(w, http.StatusBadRequest, JSONResponse{Error: "update schedule fail:" + err.Error()})
+		return
+	}
+	log.Infof("user %s update schedule %d enable to %v", currentUser(req).Username, id, form.Enable)
+	r.JSON(w, http.StatusOK, JSONResponse{})
+}
+
+func deleteSchedule(w http.ResponseWriter, req *http.Request) {
+	r := render.New(render.Options{})
+	id, _ := strconv.Atoi(mux.Vars(req)["id"])
+	if err := core.GetDBHandler().DeleteSchedule(uint(id)); err != nil {
+		r.JSON(w, http.StatusBadRequest, JSONResponse{Error: "delete schedule fail:" + err.Error()})
+		return
+	}
+	log.Infof("user %s delete schedule %d", currentUser(req).Username, id)
+	r.JSON(w, http.StatusOK, JSONResponse{})
+}
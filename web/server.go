@@ -2,15 +2,23 @@ package web
 
 import (
 	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
 	"net/http"
+	"os"
+	"path/filepath"
 	"strconv"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/gorilla/sessions"
+	uuid "github.com/nu7hatch/gouuid"
 	log "github.com/sirupsen/logrus"
 	"github.com/unrolled/render"
 	"github.com/zhangmingkai4315/dns-loader/core"
+	"github.com/zhangmingkai4315/dns-loader/dns"
 )
 
 var currentPath string
@@ -23,36 +31,65 @@ type JSONResponse struct {
 	Status          string          `json:"status"`
 	Error           string          `json:"error"`
 	NodeInfos       []core.NodeInfo `json:"nodes"`
+	AbortReason     string          `json:"abort_reason,omitempty"`
+	// AgentErrors is why the agents fail to start the job
+	AgentErrors string `json:"agent_errors,omitempty"`
 }
 
 func auth(f func(w http.ResponseWriter, req *http.Request)) func(w http.ResponseWriter, req *http.Request) {
+	return authRole(core.RoleViewer, f)
+}
 
+// authRole only allow the login user with the role or a higher role
+func authRole(role string, f func(w http.ResponseWriter, req *http.Request)) func(w http.ResponseWriter, req *http.Request) {
 	return func(w http.ResponseWriter, req *http.Request) {
-		session, _ := store.Get(req, "dns-loader")
-		if user, ok := session.Values["username"].(string); !ok || user == "" {
+		user := currentUser(req)
+		if user == nil {
 			http.Redirect(w, req, "/login", 302)
 			return
 		}
+		if !user.Can(role) {
+			r := render.New(render.Options{})
+			r.JSON(w, http.StatusForbidden, JSONResponse{
+				Error: "permission denied: " + role + " role is required",
+			})
+			log.Warnf("user %s is denied to %s %s", user.Username, req.Method, req.URL.Path)
+			return
+		}
 		f(w, req)
 	}
+}
 
+// currentUser return the login user of request, nil when not login or
+// the user has been removed
+func currentUser(req *http.Request) *core.User {
+	session, _ := store.Get(req, "dns-loader")
+	username, ok := session.Values["username"].(string)
+	if !ok || username == "" {
+		return nil
+	}
+	user, err := core.GetDBHandler().GetUser(username)
+	if err != nil {
+		return nil
+	}
+	return user
 }
 
 func login(app *core.AppController) func(w http.ResponseWriter, req *http.Request) {
 	return func(w http.ResponseWriter, req *http.Request) {
 		session, _ := store.Get(req, "dns-loader")
-		if user, ok := session.Values["username"].(string); ok && user != "" {
+		if currentUser(req) != nil {
 			http.Redirect(w, req, "/", 302)
 			return
 		}
 		if req.Method == "POST" {
-			user := req.FormValue("username")
-			password := req.FormValue("password")
-			if user == app.AppConfig.User && password == app.AppConfig.Password {
-				session.Values["username"] = user
+			user, err := core.GetDBHandler().Authenticate(req.FormValue("username"), req.FormValue("password"))
+			if err == nil {
+				session.Values["username"] = user.Username
 				session.Save(req, w)
 				http.Redirect(w, req, "/", 302)
 			} else {
+				log.Warnf("user %s login fail from %s", req.FormValue("username"), req.RemoteAddr)
 				http.Redirect(w, req, "/login", 401)
 			}
 		}
@@ -76,6 +113,7 @@ func index(w http.ResponseWriter, req *http.Request) {
 	nodeManager := core.GetNodeManager()
 	data := map[string]interface{}{
 		"agents": nodeManager.Agents(),
+		"user":   currentUser(req),
 	}
 	r := render.New(render.Options{})
 	r.HTML(w, http.StatusOK, "index", data)
@@ -84,15 +122,6 @@ func index(w http.ResponseWriter, req *http.Request) {
 func startDNSTraffic(w http.ResponseWriter, req *http.Request) {
 	r := render.New(render.Options{})
 	app := core.GetGlobalAppController()
-	if app.Status != core.StatusStopped {
-		r.JSON(w, http.StatusBadRequest, JSONResponse{
-			Error:  "benchmark is not ready",
-			ID:     app.JobID,
-			Status: app.GetCurrentJobStatusString(),
-		})
-		log.Errorln("start fail: benchmark is not ready")
-		return
-	}
 	job := core.JobConfig{}
 	decoder := json.NewDecoder(req.Body)
 	err := decoder.Decode(&job)
@@ -104,58 +133,184 @@ func startDNSTraffic(w http.ResponseWriter, req *http.Request) {
 		log.Errorf("decode post request infomation fail:%s", err)
 		return
 	}
-	err = job.ValidateJob()
+	var username string
+	if app.IsMaster == true {
+		if user := currentUser(req); user != nil {
+			username = user.Username
+		}
+	} else {
+		log.Infof("agent receive new query job from %s", req.RemoteAddr)
+	}
+	historyID, agentErrors, err := startJob(&job, username)
 	if err != nil {
 		r.JSON(w, http.StatusBadRequest, JSONResponse{
-			Error: err.Error(),
+			Error:  err.Error(),
+			ID:     app.JobID,
+			Status: app.GetCurrentJobStatusString(),
 		})
-		log.Errorf("validate post infomation fail:%s", err)
 		return
 	}
-	app.JobConfig = &job
+	if app.IsMaster == true {
+		recordStartedJob(&job, username, historyID, agentErrors)
+	}
+	r.JSON(w, http.StatusOK, JSONResponse{
+		ID:          app.JobConfig.JobID,
+		Status:      app.GetCurrentJobStatusString(),
+		AgentErrors: agentErrors,
+	})
+}
+
+// errJobNotReady is returned when a job is started before the last job
+// stopped
+var errJobNotReady = errors.New("benchmark is not ready")
+
+// errTSIGKeyFile hide the reason why the key file can't be read
+var errTSIGKeyFile = errors.New("read tsig key file fail")
+
+// jobActive is 1 from a job is started until its report is saved
+var jobActive int32
+
+// confineTSIGKeyFile keep the tsig key file of the job submitted by users
+// in the upload directory, the master never read other files for them and
+// the error does not tell whether a file exists
+func confineTSIGKeyFile(job *core.JobConfig) error {
+	if job.TSIGKeyFile == "" {
+		return nil
+	}
+	app := core.GetGlobalAppController()
+	job.TSIGKeyFile = filepath.Join(app.UploadDir, filepath.Base(job.TSIGKeyFile))
+	if job.TSIGSecret != "" {
+		return nil
+	}
+	if _, err := dns.NewTSIGFromFile(job.TSIGKeyFile); err != nil {
+		log.Errorf("read tsig key file fail:%s", err)
+		return errTSIGKeyFile
+	}
+	return nil
+}
+
+// startJob validate the job and run it, the master send the job to the
+// agents and save it in the history as launched by the user. It return
+// the id of the job history (0 on agent) and why the agents fail to start
+// the job, the job still run on master and the other agents
+func startJob(job *core.JobConfig, username string) (uint, string, error) {
+	app := core.GetGlobalAppController()
+	if app.GetCurrentJobStatus() != core.StatusStopped {
+		log.Errorln("start fail: benchmark is not ready")
+		return 0, "", errJobNotReady
+	}
+	if err := confineTSIGKeyFile(job); err != nil {
+		return 0, "", err
+	}
+	err := job.ValidateJob()
+	if err != nil {
+		log.Errorf("validate post infomation fail:%s", err)
+		return 0, "", err
+	}
+	if app.IsMaster == true && job.JobType == core.JobTypeReplay {
+		// load the uploaded capture and ship it to agents with the job
+		job.ReplayFile = filepath.Join(app.UploadDir, filepath.Base(job.ReplayFile))
+		job.ReplayData, err = ioutil.ReadFile(job.ReplayFile)
+		if err != nil {
+			log.Errorf("read replay file fail:%s", err)
+			return 0, "", errors.New("read replay file fail: " + err.Error())
+		}
+	}
+	if app.IsMaster == true && job.TSIGKeyFile != "" && job.TSIGSecret == "" {
+		// agents may not have the key file, ship the key with the job
+		content, err := ioutil.ReadFile(job.TSIGKeyFile)
+		if err == nil {
+			job.TSIGKeyName, job.TSIGAlgorithm, job.TSIGSecret, err = dns.ParseTSIGKey(content)
+		}
+		if err != nil {
+			log.Errorf("read tsig key file fail:%s", err)
+			return 0, "", errTSIGKeyFile
+		}
+	}
+	// another job may be submitted while this one is validated, and the
+	// last job may be stopped but its report is not saved yet
+	if !atomic.CompareAndSwapInt32(&jobActive, 0, 1) {
+		log.Errorln("start fail: benchmark is not ready")
+		return 0, "", errJobNotReady
+	}
+	if !app.ClaimJobStatus() {
+		atomic.StoreInt32(&jobActive, 0)
+		log.Errorln("start fail: benchmark is not ready")
+		return 0, "", errJobNotReady
+	}
+	app.JobConfig = job
+	var historyID uint
+	var agentErrors string
 	if app.IsMaster == true {
 		nodeManager := core.GetNodeManager()
-		err := core.GetDBHandler().CreateDNSQueryHistory(app)
+		// agents resolve the targets by themselves, the addresses resolved
+		// by master are recorded in history
+		if _, _, err := app.JobConfig.ResolveAddresses(); err != nil {
+			log.Warnf("resolve dns targets fail:%s", err)
+		}
+		// wait the agents so their rejections are saved with the job
+		log.Infoln("master send new query job to agents")
+		if err := nodeManager.Call(core.Start, *job); err != nil {
+			agentErrors = err.Error()
+		}
+		historyID, err = core.GetDBHandler().CreateDNSQueryHistory(app, username, agentErrors)
 		if err != nil {
 			log.Errorf("save query histroy fail:%s", err)
 		}
-		log.Infoln("master send new query job to agents")
-		go nodeManager.Call(core.Start, job)
-	} else {
-		log.Infof("agent receive new query job from %s", req.RemoteAddr)
 	}
 
-	go core.GenTrafficFromConfig(app)
+	go func() {
+		defer atomic.StoreInt32(&jobActive, 0)
+		if err := core.GenTrafficFromConfig(app); err != nil {
+			app.SetCurrentJobStatus(core.StatusStopped)
+			return
+		}
+		if historyID == 0 || app.LastReport() == nil {
+			return
+		}
+		if err := core.GetDBHandler().SaveDNSQueryReport(historyID, app.LastReport()); err != nil {
+			log.Errorf("save query report fail:%s", err)
+		}
+	}()
+	return historyID, agentErrors, nil
+}
 
+func stopDNSTraffic(w http.ResponseWriter, req *http.Request) {
+	r := render.New(render.Options{})
+	app := core.GetGlobalAppController()
+	if err := stopJob(); err != nil {
+		status := http.StatusInternalServerError
+		if err == errJobStopped {
+			status = http.StatusBadRequest
+		}
+		r.JSON(w, status, JSONResponse{
+			Error: err.Error(),
+		})
+		return
+	}
 	r.JSON(w, http.StatusOK, JSONResponse{
-		ID:     app.JobConfig.JobID,
+		ID:     app.JobID,
 		Status: app.GetCurrentJobStatusString(),
 	})
 }
 
-func stopDNSTraffic(w http.ResponseWriter, req *http.Request) {
-	r := render.New(render.Options{})
+// errJobStopped is returned when stop a job not running
+var errJobStopped = errors.New("job is already stopped")
+
+// stopJob stop the running job, the master also stop the agents
+func stopJob() error {
 	app := core.GetGlobalAppController()
 	if app.LoadManager == nil || app.LoadManager.Status() != core.StatusRunning {
-		r.JSON(w, http.StatusBadRequest, JSONResponse{
-			Error: "job is already stopped",
-		})
-		return
+		return errJobStopped
 	}
 	if stopStatus := app.LoadManager.Stop(); true != stopStatus {
-		r.JSON(w, http.StatusInternalServerError, JSONResponse{
-			Error: "server fail, please try again later",
-		})
-		return
+		return errors.New("server fail, please try again later")
 	}
 	if app.IsMaster == true {
 		nodeManager := core.GetNodeManager()
 		go nodeManager.Call(core.Kill, nil)
 	}
-	r.JSON(w, http.StatusOK, JSONResponse{
-		ID:     app.JobID,
-		Status: app.GetCurrentJobStatusString(),
-	})
+	return nil
 }
 
 func getCurrentStatus(w http.ResponseWriter, req *http.Request) {
@@ -249,6 +404,51 @@ func deleteNode(w http.ResponseWriter, req *http.Request) {
 	r.JSON(w, http.StatusOK, JSONResponse{})
 }
 
+func uploadReplayFile(w http.ResponseWriter, req *http.Request) {
+	r := render.New(render.Options{})
+	app := core.GetGlobalAppController()
+	file, header, err := req.FormFile("file")
+	if err != nil {
+		r.JSON(w, http.StatusBadRequest, JSONResponse{Error: "read upload file fail: " + err.Error()})
+		return
+	}
+	defer file.Close()
+	queries, err := core.ReadCaptureQueries(file)
+	if err != nil {
+		r.JSON(w, http.StatusBadRequest, JSONResponse{Error: "invalid capture file: " + err.Error()})
+		return
+	}
+	if len(queries) == 0 {
+		r.JSON(w, http.StatusBadRequest, JSONResponse{Error: "no dns query found in capture file"})
+		return
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		r.JSON(w, http.StatusInternalServerError, JSONResponse{Error: err.Error()})
+		return
+	}
+	if err := os.MkdirAll(app.UploadDir, 0755); err != nil {
+		r.JSON(w, http.StatusInternalServerError, JSONResponse{Error: "create upload directory fail: " + err.Error()})
+		return
+	}
+	id, _ := uuid.NewV4()
+	name := id.String() + filepath.Ext(header.Filename)
+	out, err := os.Create(filepath.Join(app.UploadDir, name))
+	if err != nil {
+		r.JSON(w, http.StatusInternalServerError, JSONResponse{Error: "save upload file fail: " + err.Error()})
+		return
+	}
+	defer out.Close()
+	if _, err := io.Copy(out, file); err != nil {
+		r.JSON(w, http.StatusInternalServerError, JSONResponse{Error: "save upload file fail: " + err.Error()})
+		return
+	}
+	log.Infof("upload capture file %s with %d queries", header.Filename, len(queries))
+	r.JSON(w, http.StatusOK, map[string]interface{}{
+		"file":    name,
+		"queries": len(queries),
+	})
+}
+
 // HistoryResponse return data for history query
 
 func getQueryHistory(w http.ResponseWriter, req *http.Request) {
@@ -271,6 +471,44 @@ func getQueryHistory(w http.ResponseWriter, req *http.Request) {
 	})
 }
 
+func getQueryReport(w http.ResponseWriter, req *http.Request) {
+	r := render.New(render.Options{})
+	id, _ := strconv.Atoi(mux.Vars(req)["id"])
+	report, err := core.GetDBHandler().GetDNSQueryReport(uint(id))
+	if err != nil {
+		r.JSON(w, http.StatusNotFound, JSONResponse{Error: err.Error()})
+		return
+	}
+	r.JSON(w, http.StatusOK, report)
+}
+
+func compareQueryHistory(w http.ResponseWriter, req *http.Request) {
+	r := render.New(render.Options{})
+	query := req.URL.Query()
+	var reports []*core.Report
+	for _, key := range []string{"a", "b"} {
+		id, _ := strconv.Atoi(query.Get(key))
+		report, err := core.GetDBHandler().GetDNSQueryReport(uint(id))
+		if err != nil {
+			r.JSON(w, http.StatusNotFound, JSONResponse{Error: err.Error()})
+			return
+		}
+		reports = append(reports, report)
+	}
+	thresholds := core.DefaultCompareThresholds
+	for key, threshold := range map[string]*float64{
+		"qps_drop":         &thresholds.QPSDrop,
+		"rcode_change":     &thresholds.RcodeChange,
+		"timeout_increase": &thresholds.TimeoutIncrease,
+		"latency_increase": &thresholds.LatencyIncrease,
+	} {
+		if value, err := strconv.ParseFloat(query.Get(key), 64); err == nil {
+			*threshold = value
+		}
+	}
+	r.JSON(w, http.StatusOK, core.CompareReports(reports[0], reports[1], thresholds))
+}
+
 // NewServer function create the http api
 func NewServer() error {
 	app := core.GetGlobalAppController()
@@ -281,14 +519,41 @@ func NewServer() error {
 	r.HandleFunc("/", auth(index)).Methods("GET")
 	r.HandleFunc("/logout", logout).Methods("POST", "GET")
 	r.HandleFunc("/history", auth(getQueryHistory)).Methods("GET")
+	r.HandleFunc("/history/{id:[0-9]+}/report", auth(getQueryReport)).Methods("GET")
+	r.HandleFunc("/compare", auth(compareQueryHistory)).Methods("GET")
 	r.HandleFunc("/login", login(app)).Methods("GET", "POST")
-	r.HandleFunc("/nodes", auth(addNode)).Methods("POST")
-	r.HandleFunc("/update-node", auth(updateNodeEnableStatus)).Methods("POST")
-	r.HandleFunc("/nodes", auth(deleteNode)).Methods("DELETE")
-	r.HandleFunc("/start", auth(startDNSTraffic)).Methods("POST")
-	r.HandleFunc("/stop", auth(stopDNSTraffic)).Methods("GET")
+	r.HandleFunc("/nodes", authRole(core.RoleAdmin, addNode)).Methods("POST")
+	r.HandleFunc("/update-node", authRole(core.RoleAdmin, updateNodeEnableStatus)).Methods("POST")
+	r.HandleFunc("/nodes", authRole(core.RoleAdmin, deleteNode)).Methods("DELETE")
+	r.HandleFunc("/start", authRole(core.RoleOperator, startDNSTraffic)).Methods("POST")
+	r.HandleFunc("/upload", authRole(core.RoleOperator, uploadReplayFile)).Methods("POST")
+	r.HandleFunc("/stop", authRole(core.RoleOperator, stopDNSTraffic)).Methods("GET")
 	r.HandleFunc("/status", auth(getCurrentStatus)).Methods("GET")
+	r.HandleFunc("/users", authRole(core.RoleAdmin, usersPage)).Methods("GET")
+	r.HandleFunc("/users/list", authRole(core.RoleAdmin, listUsers)).Methods("GET")
+	r.HandleFunc("/users", authRole(core.RoleAdmin, createUser)).Methods("POST")
+	r.HandleFunc("/users/{username}", authRole(core.RoleAdmin, updateUser)).Methods("POST")
+	r.HandleFunc("/users/{username}", authRole(core.RoleAdmin, deleteUser)).Methods("DELETE")
+	r.HandleFunc("/password", auth(changePassword)).Methods("POST")
+	r.HandleFunc("/queue", auth(queuePage)).Methods("GET")
+	r.HandleFunc("/queue/list", auth(listQueue)).Methods("GET")
+	r.HandleFunc("/queue", authRole(core.RoleOperator, enqueueJob)).Methods("POST")
+	r.HandleFunc("/queue/{id:[0-9]+}/cancel", authRole(core.RoleOperator, cancelQueuedJob)).Methods("POST")
+	r.HandleFunc("/schedules", authRole(core.RoleOperator, createSchedule)).Methods("POST")
+	r.HandleFunc("/schedules/{id:[0-9]+}", authRole(core.RoleOperator, updateSchedule)).Methods("POST")
+	r.HandleFunc("/schedules/{id:[0-9]+}", authRole(core.RoleOperator, deleteSchedule)).Methods("DELETE")
+	r.HandleFunc("/templates", auth(templatesPage)).Methods("GET")
+	r.HandleFunc("/templates/list", auth(listJobTemplates)).Methods("GET")
+	r.HandleFunc("/templates", authRole(core.RoleOperator, createJobTemplate)).Methods("POST")
+	r.HandleFunc("/templates/import", authRole(core.RoleOperator, importJobTemplate)).Methods("POST")
+	r.HandleFunc("/templates/{name}", auth(showJobTemplate)).Methods("GET")
+	r.HandleFunc("/templates/{name}", authRole(core.RoleOperator, deleteJobTemplate)).Methods("DELETE")
+	r.HandleFunc("/templates/{name}/versions", auth(listJobTemplateVersions)).Methods("GET")
+	r.HandleFunc("/templates/{name}/export", auth(exportJobTemplate)).Methods("GET")
+	r.HandleFunc("/templates/{name}/start", authRole(core.RoleOperator, startJobTemplate)).Methods("POST")
+	newAPIRouter(r)
 	r.PathPrefix("/public/").Handler(http.StripPrefix("/public", http.FileServer(http.Dir("./web/assets"))))
+	go runQueue()
 	err := http.ListenAndServe(app.AppConfig.HTTPServer, http.TimeoutHandler(r, time.Second*10, "timeout"))
 	return err
 }
@@ -1,7 +1,8 @@
 package web
 
 import (
-	"fmt"
+	"net"
+	"strings"
 
 	"github.com/asaskevich/govalidator"
 )
@@ -17,8 +18,13 @@ type IPWithPort struct {
 	Enable    bool   `json:"enable" valid:"-"`
 }
 
-// Validate if ip and port infomation is valid
+// Validate if ip and port infomation is valid, the ipv6 address
+// in brackets is accepted and saved in canonical form
 func (ipp *IPWithPort) Validate() error {
+	ipp.IPAddress = strings.TrimSuffix(strings.TrimPrefix(ipp.IPAddress, "["), "]")
+	if ip := net.ParseIP(ipp.IPAddress); ip != nil {
+		ipp.IPAddress = ip.String()
+	}
 	_, err := govalidator.ValidateStruct(ipp)
 	if err != nil {
 		return err
@@ -29,5 +35,5 @@ func (ipp *IPWithPort) toString(defaultPort string) string {
 	if ipp.Port == "" {
 		ipp.Port = defaultPort
 	}
-	return fmt.Sprintf("%s:%s", ipp.IPAddress, ipp.Port)
+	return net.JoinHostPort(ipp.IPAddress, ipp.Port)
 }
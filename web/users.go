@@ -0,0 +1,106 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+	"github.com/unrolled/render"
+	"github.com/zhangmingkai4315/dns-loader/core"
+)
+
+// UserForm define the posted user info, the empty password and role are
+// not changed when update the user
+type UserForm struct {
+	Username    string `json:"username"`
+	Password    string `json:"password"`
+	OldPassword string `json:"old_password"`
+	Role        string `json:"role"`
+}
+
+func usersPage(w http.ResponseWriter, req *http.Request) {
+	r := render.New(render.Options{})
+	r.HTML(w, http.StatusOK, "users", map[string]interface{}{
+		"user":  currentUser(req),
+		"roles": []string{core.RoleViewer, core.RoleOperator, core.RoleAdmin},
+	})
+}
+
+func listUsers(w http.ResponseWriter, req *http.Request) {
+	r := render.New(render.Options{})
+	users, err := core.GetDBHandler().GetUsers()
+	if err != nil {
+		r.JSON(w, http.StatusInternalServerError, JSONResponse{Error: err.Error()})
+		return
+	}
+	r.JSON(w, http.StatusOK, map[string]interface{}{
+		"data": users,
+	})
+}
+
+func createUser(w http.ResponseWriter, req *http.Request) {
+	r := render.New(render.Options{})
+	var form UserForm
+	if err := json.NewDecoder(req.Body).Decode(&form); err != nil {
+		r.JSON(w, http.StatusBadRequest, JSONResponse{Error: "decode post data fail"})
+		return
+	}
+	if _, err := core.GetDBHandler().CreateUser(form.Username, form.Password, form.Role); err != nil {
+		r.JSON(w, http.StatusBadRequest, JSONResponse{Error: "add user fail:" + err.Error()})
+		return
+	}
+	log.Infof("user %s add user %s with role %s", currentUser(req).Username, form.Username, form.Role)
+	r.JSON(w, http.StatusOK, JSONResponse{})
+}
+
+func updateUser(w http.ResponseWriter, req *http.Request) {
+	r := render.New(render.Options{})
+	var form UserForm
+	if err := json.NewDecoder(req.Body).Decode(&form); err != nil {
+		r.JSON(w, http.StatusBadRequest, JSONResponse{Error: "decode post data fail"})
+		return
+	}
+	username := mux.Vars(req)["username"]
+	if err := core.GetDBHandler().UpdateUser(username, form.Password, form.Role); err != nil {
+		r.JSON(w, http.StatusBadRequest, JSONResponse{Error: "update user fail:" + err.Error()})
+		return
+	}
+	log.Infof("user %s update user %s", currentUser(req).Username, username)
+	r.JSON(w, http.StatusOK, JSONResponse{})
+}
+
+func deleteUser(w http.ResponseWriter, req *http.Request) {
+	r := render.New(render.Options{})
+	username := mux.Vars(req)["username"]
+	if err := core.GetDBHandler().DeleteUser(username); err != nil {
+		r.JSON(w, http.StatusBadRequest, JSONResponse{Error: "delete user fail:" + err.Error()})
+		return
+	}
+	log.Infof("user %s delete user %s", currentUser(req).Username, username)
+	r.JSON(w, http.StatusOK, JSONResponse{})
+}
+
+// changePassword change the password of the login user
+func changePassword(w http.ResponseWriter, req *http.Request) {
+	r := render.New(render.Options{})
+	var form UserForm
+	if err := json.NewDecoder(req.Body).Decode(&form); err != nil {
+		r.JSON(w, http.StatusBadRequest, JSONResponse{Error: "decode post data fail"})
+		return
+	}
+	user := currentUser(req)
+	if !user.CheckPassword(form.OldPassword) {
+		r.JSON(w, http.StatusBadRequest, JSONResponse{Error: "old password is wrong"})
+		return
+	}
+	if form.Password == "" {
+		r.JSON(w, http.StatusBadRequest, JSONResponse{Error: "new password is empty"})
+		return
+	}
+	if err := core.GetDBHandler().UpdateUser(user.Username, form.Password, ""); err != nil {
+		r.JSON(w, http.StatusBadRequest, JSONResponse{Error: "change password fail:" + err.Error()})
+		return
+	}
+	r.JSON(w, http.StatusOK, JSONResponse{})
+}